@@ -3,3 +3,5 @@ package main
 import "errors"
 
 var errMissingSecretOrToken = errors.New("missing ROOT_TOKEN or DUMP_TOKEN env vars")
+
+var errMissingRecoveryDirs = errors.New("recovery needs both WAL_DIR and PERSISTENCE_DIR set (storage.wal_dir and storage.persistence_dir)")
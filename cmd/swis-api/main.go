@@ -24,7 +24,19 @@
 // has its routes, models, and controllers (handler functions) defined in its own directory.
 package main
 
+import (
+	"flag"
+)
+
 func main() {
+	recoverUntil := flag.String("recover-until", "", "rebuild persisted caches from WAL_DIR up to the given RFC 3339 time, then exit")
+	flag.Parse()
+
+	if *recoverUntil != "" {
+		runRecovery(*recoverUntil)
+		return
+	}
+
 	server := newServer()
 	server.Run()
 }
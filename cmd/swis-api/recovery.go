@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	gin "github.com/gin-gonic/gin"
+
+	"go.vxn.dev/swis/v5/pkg/config"
+	"go.vxn.dev/swis/v5/pkg/core"
+)
+
+// runRecovery rebuilds the persisted caches by replaying the write-ahead log up to the given point in time.
+// The server is not started, previous persisted logs are kept aside with the '.pre-recovery' suffix.
+func runRecovery(until string) {
+	untilTime, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		log.Fatalf("invalid recovery time '%s': %s", until, err.Error())
+	}
+
+	// The server's settings are not needed, so the configuration is read without the validation.
+	cfg, err := config.Read()
+	if err != nil {
+		log.Fatalf("cannot read the configuration: %s", err.Error())
+	}
+
+	walDir := cfg.Storage.WALDir
+	persistenceDir := cfg.Storage.PersistenceDir
+
+	if walDir == "" || persistenceDir == "" {
+		log.Fatal(errMissingRecoveryDirs)
+	}
+
+	// The sealed secrets in the WAL can be opened with the same key only.
+	if err := core.SetSecretKey(cfg.Secrets.Key); err != nil {
+		log.Fatal(err)
+	}
+
+	// Register all caches empty: no persisted data loaded, no operations logged during the replay.
+	if err := core.SetPersistenceDir(""); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := core.SetWALDir(""); err != nil {
+		log.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	if err := core.MountMany(gin.New(), nil, packages()...); err != nil {
+		log.Fatal(err)
+	}
+
+	count, err := core.ReplayWAL(walDir, untilTime)
+	if err != nil {
+		log.Fatalf("WAL replay failed after %d records: %s", count, err.Error())
+	}
+
+	log.Printf("replayed %d WAL records up to %s", count, untilTime.Format(time.RFC3339))
+
+	if err := os.MkdirAll(persistenceDir, 0o750); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := core.WriteSnapshots(persistenceDir, ".pre-recovery"); err != nil {
+		log.Fatalf("cannot write recovered caches: %s", err.Error())
+	}
+
+	log.Printf("recovered caches written to %s", persistenceDir)
+}
@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -15,6 +17,7 @@ import (
 	gin "github.com/gin-gonic/gin"
 
 	"go.vxn.dev/swis/v5/pkg/alvax"
+	"go.vxn.dev/swis/v5/pkg/audit"
 	"go.vxn.dev/swis/v5/pkg/auth"
 	"go.vxn.dev/swis/v5/pkg/backups"
 	"go.vxn.dev/swis/v5/pkg/business"
@@ -23,14 +26,17 @@ import (
 	"go.vxn.dev/swis/v5/pkg/depots"
 	"go.vxn.dev/swis/v5/pkg/dish"
 	"go.vxn.dev/swis/v5/pkg/finance"
+	"go.vxn.dev/swis/v5/pkg/follower"
 	"go.vxn.dev/swis/v5/pkg/infra"
 	"go.vxn.dev/swis/v5/pkg/links"
 	"go.vxn.dev/swis/v5/pkg/news"
 	"go.vxn.dev/swis/v5/pkg/projects"
 	"go.vxn.dev/swis/v5/pkg/queue"
 	"go.vxn.dev/swis/v5/pkg/roles"
+	"go.vxn.dev/swis/v5/pkg/services"
 	"go.vxn.dev/swis/v5/pkg/system"
 	"go.vxn.dev/swis/v5/pkg/users"
+	"go.vxn.dev/swis/v5/pkg/webhooks"
 )
 
 type server struct {
@@ -74,8 +80,20 @@ func (s *server) handleSignals() {
 	go func() {
 		defer s.wg.Done()
 
-		// Wait for a signal.
-		sig := <-sigs
+		// Wait for a signal, SIGHUP reloads the configuration.
+		var sig os.Signal
+		for sig = range sigs {
+			if sig != syscall.SIGHUP {
+				break
+			}
+
+			if _, err := config.Load(); err != nil {
+				log.Printf("trap signal: %s, configuration reload failed, keeping the current one: %s", sig.String(), err.Error())
+				continue
+			}
+
+			log.Printf("trap signal: %s, configuration reloaded", sig.String())
+		}
 		signal.Stop(sigs)
 
 		log.Printf("trap signal: %s, graceful shutdown invoked...", sig.String())
@@ -106,9 +124,21 @@ func (s *server) handleSignals() {
 }
 
 func (s *server) setupRouter() {
+	// Read the configuration: the defaults, CONFIG_FILE and the environment, in this order.
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("cannot load the configuration, refusing to start the server: %s", err.Error())
+	}
+
 	// Blank gin without any middleware.
 	s.router = gin.New()
 
+	// The client addresses (keying the lockouts and rate limits) are taken from X-Forwarded-For of the trusted
+	// proxies only.
+	if err := s.router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("cannot set TRUSTED_PROXIES: %s", err.Error())
+	}
+
 	// Recovery middleware recovers from any panics and writes a 500 if there was one.
 	s.router.Use(gin.Recovery())
 
@@ -147,23 +177,39 @@ func (s *server) setupRouter() {
 	s.router.Use(auth.AuthenticationMiddleware())
 	s.router.Use(auth.AuthorizationMiddleware())
 
+	// A follower instance refuses the writes (or proxies them to the leader) until promoted.
+	s.router.Use(follower.Middleware())
+
+	// Record every mutating request with the changes of items it made, optionally persisted to AUDIT_DIR.
+	audit.SetMaxRecords(cfg.Storage.AuditMaxRecords)
+	if err := audit.SetDir(cfg.Storage.AuditDir); err != nil {
+		log.Fatalf("cannot initialize AUDIT_DIR: %s", err.Error())
+	}
+	s.router.Use(audit.Middleware())
+
+	// Replicate the successful mutating requests to the MIRROR_PEERS instances.
+	s.router.Use(config.MirrorMiddleware())
+
 	// Root path
 	s.router.GET("/", func(c *gin.Context) {
+		params, _ := auth.FromContext(c)
+		app := config.Current().App
+
 		c.IndentedJSON(http.StatusOK, gin.H{
 			"header_title": "sakalWebIS v5 RESTful API -- root route",
-			"message":      "welcome to swis, " + auth.Params.User.Name + "!",
+			"message":      "welcome to swis, " + params.User.Name + "!",
 			"code":         http.StatusOK,
 			"app_env": gin.H{
-				"app_mode_environment": os.Getenv("APP_ENVIRONMENT"),
-				"instance_name":        os.Getenv("HOSTNAME"),
-				"alpine_version":       os.Getenv("ALPINE_VERSION"),
-				"app_version":          os.Getenv("APP_VERSION"),
-				"golang_version":       os.Getenv("GOLANG_VERSION"),
+				"app_mode_environment": app.Environment,
+				"instance_name":        app.Instance,
+				"alpine_version":       app.AlpineVersion,
+				"app_version":          app.Version,
+				"golang_version":       app.GolangVersion,
 			},
 			"timestamp": time.Now().Unix(),
 			"user": gin.H{
-				"acl":   auth.Params.ACL,
-				"roles": auth.Params.Roles,
+				"acl":   params.ACL,
+				"roles": params.Roles,
 			},
 		})
 	})
@@ -172,11 +218,61 @@ func (s *server) setupRouter() {
 	// swis pkg registration
 	//
 
+	// The secret fields are sealed with the master key, it has to be set before the persisted data are loaded.
+	if err := core.SetSecretKey(cfg.Secrets.Key); err != nil {
+		log.Fatalf("cannot initialize SECRETS_KEY: %s", err.Error())
+	}
+
+	if cfg.Secrets.Key == "" {
+		log.Print("SECRETS_KEY not provided, the secret fields are stored in clear text")
+	}
+
+	// Enable the write-through persistence of caches if requested, persisted data are loaded on mount.
+	if err := core.SetPersistenceDir(cfg.Storage.PersistenceDir); err != nil {
+		log.Fatalf("cannot initialize PERSISTENCE_DIR: %s", err.Error())
+	}
+
+	// Log every cache operation to the write-ahead log if requested.
+	if err := core.SetWALDir(cfg.Storage.WALDir); err != nil {
+		log.Fatalf("cannot initialize WAL_DIR: %s", err.Error())
+	}
+
+	core.SetWALRetention(time.Duration(cfg.Storage.WALRetention))
+
 	// Preregister system cache to track registered packages.
-	core.MountPackage(s.router, system.Package)
+	if err := core.MountPackage(s.router, system.Package); err != nil {
+		log.Fatalf("refusing to start the server: %s", err.Error())
+	}
 
 	// Bulk registration and mounting of packages.
-	core.MountMany(s.router, &system.Cache,
+	if err := core.MountMany(s.router, system.Cache, packages()...); err != nil {
+		log.Fatalf("refusing to start the server: %s", err.Error())
+	}
+
+	// Checkpoint the loaded data, the recovery can start there.
+	if err := core.CheckpointWAL(); err != nil {
+		log.Fatalf("cannot write the WAL checkpoint: %s", err.Error())
+	}
+
+	// Keep the latest changes for the followers (and other readers of the change feed).
+	core.SetFeedSize(cfg.Feed.Size)
+
+	// Follow the leader instance if requested: load its snapshot, then apply its changes.
+	if leader := cfg.Follower.Leader; leader != "" {
+		follower.Start(strings.TrimSuffix(leader, "/"), cfg.Follower.LeaderToken, cfg.Follower.ProxyWrites)
+	}
+
+	// Initialize other components.
+	dish.Dispatcher = dish.NewDispatcher()
+
+	// Deliver the changes to the registered webhooks.
+	webhooks.Start(context.Background())
+
+}
+
+// packages returns the list of all swis packages to be mounted.
+func packages() []*core.Package {
+	return []*core.Package{
 		alvax.Package,
 		backups.Package,
 		business.Package,
@@ -189,15 +285,9 @@ func (s *server) setupRouter() {
 		projects.Package,
 		queue.Package,
 		roles.Package,
+		services.Package,
 		users.Package,
-	)
-
-	// Initialize other components.
-	dish.Dispatcher = dish.NewDispatcher()
-
-	// Attach router to http.Server and start it, check for SERVER_PORT env variable.
-	if os.Getenv("SERVER_PORT") == "" {
-		log.Fatal("SERVER_PORT environment variable not provided! refusing to start the server...")
+		webhooks.Package,
 	}
 }
 
@@ -207,7 +297,7 @@ func (s *server) setupServer() {
 	}
 
 	var err error
-	if s.listener, err = net.Listen("tcp", ":"+os.Getenv("SERVER_PORT")); err != nil {
+	if s.listener, err = net.Listen("tcp", ":"+strconv.Itoa(config.Current().Server.Port)); err != nil {
 		panic(err)
 	}
 
@@ -224,7 +314,7 @@ func (s *server) setupServer() {
 }
 
 func (s *server) serve() {
-	log.Printf("init done, starting the HTTP server (v%s)", os.Getenv("APP_VERSION"))
+	log.Printf("init done, starting the HTTP server (v%s)", config.Current().App.Version)
 
 	if err := s.srv.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
@@ -7,10 +7,10 @@ import (
 )
 
 var (
-	Cache *core.Cache
+	Cache = &core.Cache[ConfigRoot]{}
 
-	caches = []**core.Cache{
-		&Cache,
+	caches = []core.CacheInterface{
+		Cache,
 	}
 	pkgName string = "alvax"
 )
@@ -23,11 +23,10 @@ var Package *core.Package = &core.Package{
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"Cache"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
 }
 
 // GetConfigs function dumps the alvax cache contents.
@@ -78,6 +77,18 @@ func UpdateConfigByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch alvax config by its ID
+// @Description patch alvax config by its ID (JSON merge patch)
+// @Tags alvax
+// @Produce json
+// @Param request body alvax.ConfigRoot true "merge patch of the item"
+// @Success 200 {object} alvax.ConfigRoot
+// @Router /alvax/{key} [patch]
+func PatchConfigByKey(ctx *gin.Context) {
+	core.PatchItemByParam[ConfigRoot](ctx, Cache, pkgName, ConfigRoot{})
+	return
+}
+
 // @Summary Delete alvax config by its key
 // @Description delete alvax config by its key
 // @Tags alvax
@@ -1,5 +1,7 @@
 package alvax
 
+import "go.vxn.dev/swis/v5/pkg/core"
+
 type ConfigRootMap struct {
 	Items map[string]ConfigRoot `json:"items"`
 }
@@ -41,7 +43,7 @@ type ChannelsTelegram struct {
 	Name            string                          `json:"name"`
 	Integrate       bool                            `json:"integrate"`
 	BaseUrl         string                          `json:"baseUrl"`
-	Token           string                          `json:"token"`
+	Token           core.Secret                     `json:"token"`
 	WebhookEndpoint string                          `json:"webhookEndpoint"`
 	WebhookUrl      string                          `json:"webhookUrl"`
 	ChannelSpecific ChannelsTelegramChannelSpecific `json:"channelSpecific"`
@@ -60,11 +62,11 @@ type ChannelsDiscord struct {
 	Name            string                 `json:"name"`
 	Integrate       bool                   `json:"integrate"`
 	BaseUrl         string                 `json:"baseUrl"`
-	BotToken        string                 `json:"botToken"`
+	BotToken        core.Secret            `json:"botToken"`
 	WebhookEndpoint string                 `json:"webhookEndpoint"`
 	ProdWebhook     string                 `json:"prodWebhook"`
 	Methods         ChannelsDiscordMethods `json:"methods"`
-	Token           string                 `json:"token"`
+	Token           core.Secret            `json:"token"`
 	Commands        []interface{}          `json:"commands"`
 }
 
@@ -14,6 +14,8 @@ func Routes(g *gin.RouterGroup) {
 		GetConfigByKey)
 	g.PUT("/:key",
 		UpdateConfigByKey)
+	g.PATCH("/:key",
+		PatchConfigByKey)
 	g.DELETE("/:key",
 		DeleteConfigByKey)
 	g.POST("/restore",
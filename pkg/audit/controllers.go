@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pkgName is the package the audit routes are served by.
+var pkgName string = "system"
+
+// GetRecords lists the audit records, the newest first.
+// @Summary Get audit records
+// @Description get audit records of mutating requests, filtered by user_name, package, cache, key, method, op, since, until, before and limit
+// @Tags system
+// @Produce json
+// @Success 200 {object} []audit.Record
+// @Router /system/audit [get]
+func GetRecords(ctx *gin.Context) {
+	filter, err := ParseFilter(ctx.Request.URL.Query())
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   err.Error(),
+			"message": "invalid audit filter",
+			"package": pkgName,
+		})
+		return
+	}
+
+	records := trail.list(filter)
+	if records == nil {
+		records = []Record{}
+	}
+
+	// The next page continues before the last listed record.
+	var next string
+	if filter.Limit > 0 && len(records) == filter.Limit {
+		next = records[len(records)-1].ID
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"count":   len(records),
+		"items":   records,
+		"message": "ok, listing audit records",
+		"next":    next,
+		"package": pkgName,
+	})
+	return
+}
+
+// ExportRecords streams the audit records as JSON lines, the oldest first.
+// @Summary Export audit records
+// @Description export audit records as JSON lines, filtered the same way as the listing
+// @Tags system
+// @Produce application/x-ndjson
+// @Router /system/audit/export [get]
+func ExportRecords(ctx *gin.Context) {
+	filter, err := ParseFilter(ctx.Request.URL.Query())
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   err.Error(),
+			"message": "invalid audit filter",
+			"package": pkgName,
+		})
+		return
+	}
+
+	records := trail.list(filter)
+
+	fileName := fmt.Sprintf("swis-audit-%s.jsonl", time.Now().Format("20060102-150405"))
+
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	ctx.Status(http.StatusOK)
+
+	enc := json.NewEncoder(ctx.Writer)
+
+	for idx := len(records) - 1; idx >= 0; idx-- {
+		// Headers are already sent, so a failure can be only logged.
+		if err := enc.Encode(records[idx]); err != nil {
+			log.Printf("audit: export failed: %s", err.Error())
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,239 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type socket struct {
+	ID     string `json:"id" required:"true" readonly:"true"`
+	Host   string `json:"host"`
+	Muted  bool   `json:"muted"`
+	Expiry int64  `json:"expiry"`
+}
+
+var testCache = &core.Cache[socket]{Name: "dish/sockets"}
+
+// setupAuditRouter returns a router serving the generic item routes and the audit records as alice.
+func setupAuditRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set(core.ContextUserName, "alice")
+	})
+	router.Use(Middleware())
+
+	router.POST("/dish/sockets", func(ctx *gin.Context) {
+		core.AddNewItem(ctx, testCache, "dish", socket{})
+	})
+	router.PUT("/dish/sockets/:key", func(ctx *gin.Context) {
+		core.UpdateItemByParam(ctx, testCache, "dish", socket{})
+	})
+	router.DELETE("/dish/sockets/:key", func(ctx *gin.Context) {
+		core.DeleteItemByParam(ctx, testCache, "dish")
+	})
+
+	router.GET("/system/audit", GetRecords)
+	router.GET("/system/audit/export", ExportRecords)
+
+	return router
+}
+
+/*
+ *  unit/integration tests
+ */
+
+func TestAuditRecords(t *testing.T) {
+	r := setupAuditRouter()
+
+	for _, step := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", "/dish/sockets", `{"id": "web", "host": "example.com", "expiry": 1715600000000000001}`, http.StatusCreated},
+		{"PUT", "/dish/sockets/web", `{"id": "web", "host": "example.com", "muted": true, "expiry": 1715600000000000002}`, http.StatusOK},
+		{"DELETE", "/dish/sockets/unknown", ``, http.StatusNotFound},
+		{"DELETE", "/dish/sockets/web", ``, http.StatusOK},
+	} {
+		req, _ := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, step.code, w.Code, "%s %s", step.method, step.path)
+	}
+
+	req, _ := http.NewRequest("GET", "/system/audit?key=web&method=PUT", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var list = struct {
+		Records []Record `json:"items"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &list)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.Len(t, list.Records, 1) {
+		rec := list.Records[0]
+
+		assert.Equal(t, "alice", rec.User)
+		assert.Equal(t, "dish", rec.Package)
+		assert.Equal(t, "dish/sockets", rec.Cache)
+		assert.Equal(t, "set", rec.Op)
+
+		changed := make(map[string][2]any)
+		for _, change := range rec.Diff {
+			changed[change.Field] = [2]any{change.Before, change.After}
+		}
+
+		assert.Equal(t, map[string][2]any{
+			"expiry": {1715600000000000001.0, 1715600000000000002.0},
+			"muted":  {false, true},
+		}, changed)
+	}
+
+	// all the requests are listed, the newest first, even the failed one
+	req, _ = http.NewRequest("GET", "/system/audit?user_name=alice&limit=2", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	json.Unmarshal(w.Body.Bytes(), &list)
+
+	if assert.Len(t, list.Records, 2) {
+		assert.Equal(t, "delete", list.Records[0].Op)
+		assert.Equal(t, http.StatusNotFound, list.Records[1].Status)
+		assert.Equal(t, "unknown", list.Records[1].Key)
+	}
+
+	req, _ = http.NewRequest("GET", "/system/audit?color=red", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportRecords(t *testing.T) {
+	r := setupAuditRouter()
+
+	req, _ := http.NewRequest("GET", "/system/audit/export?package=dish", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var methods []string
+
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var rec Record
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+
+		methods = append(methods, rec.Method)
+	}
+
+	assert.Equal(t, []string{"POST", "PUT", "DELETE", "DELETE"}, methods)
+}
+
+func TestEraseUser(t *testing.T) {
+	assert.NoError(t, SetDir(t.TempDir()))
+	defer SetDir("")
+
+	path := trail.path
+	r := setupAuditRouter()
+
+	req, _ := http.NewRequest("POST", "/dish/sockets", bytes.NewBufferString(`{"id": "alice", "host": "alice"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	req, _ = http.NewRequest("POST", "/dish/sockets", bytes.NewBufferString(`{"id": "mail", "host": "alice"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, EraseUser(&gin.Context{}, "alice", "[erased]"))
+
+	recs := trail.list(&Filter{})
+	if assert.Len(t, recs, 2) {
+		// the user's own item is recorded without its values
+		assert.Equal(t, "[erased]", recs[1].User)
+		assert.Equal(t, "[erased]", recs[1].Key)
+		assert.Empty(t, recs[1].Diff)
+
+		assert.Equal(t, "[erased]", recs[0].User)
+		assert.Equal(t, "mail", recs[0].Key)
+		assert.Contains(t, recs[0].Diff, FieldChange{Field: "host", Before: nil, After: "[erased]"})
+	}
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "alice")
+
+	// the records are appended to the rewritten file
+	req, _ = http.NewRequest("DELETE", "/dish/sockets/mail", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.NoError(t, SetDir(filepath.Dir(path)))
+	assert.Len(t, trail.list(&Filter{}), 3)
+}
+
+type vaultItem struct {
+	ID    string      `json:"id"`
+	Token core.Secret `json:"token"`
+}
+
+func TestRecordedValues(t *testing.T) {
+	vault := &core.Cache[vaultItem]{}
+	core.SetupTestEnv(&core.Package{
+		Name:   "vault",
+		Cache:  []core.CacheInterface{vault},
+		Routes: func(r *gin.RouterGroup) {},
+	})
+
+	assert.NoError(t, SetDir(""))
+	SetMaxRecords(2)
+	defer SetMaxRecords(0)
+
+	r := setupAuditRouter()
+	r.POST("/vault", func(ctx *gin.Context) {
+		core.AddNewItem(ctx, vault, "vault", vaultItem{})
+	})
+
+	// the secrets are recorded redacted
+	req, _ := http.NewRequest("POST", "/vault", bytes.NewBufferString(`{"id": "k", "token": "s3cret"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	recs := trail.list(&Filter{})
+	if assert.Len(t, recs, 1) {
+		assert.Contains(t, recs[0].Diff, FieldChange{Field: "token", Before: nil, After: core.RedactedSecret})
+	}
+
+	data, _ := json.Marshal(recs)
+	assert.NotContains(t, string(data), "s3cret")
+
+	// only the newest records are kept
+	for range 3 {
+		req, _ = http.NewRequest("DELETE", "/dish/sockets/unknown", nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	recs = trail.list(&Filter{})
+	if assert.Len(t, recs, 2) {
+		assert.Equal(t, "unknown", recs[1].Key)
+	}
+}
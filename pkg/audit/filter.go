@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter narrows the listed records, blank fields match any record.
+type Filter struct {
+	User    string
+	Package string
+	Cache   string
+	Key     string
+	Method  string
+	Op      string
+
+	// Since and Until limit the records' timestamps (both inclusive).
+	Since time.Time
+	Until time.Time
+
+	// Before continues the listing after the record of such ID (the listing goes from the newest records).
+	Before string
+
+	// Limit is the maximum count of records listed, zero means no limit.
+	Limit int
+}
+
+// ParseFilter reads the filter from the URL query parameters: user_name, package, cache, key, method, op, since
+// and until (RFC 3339 timestamps), before (record ID) and limit.
+func ParseFilter(values url.Values) (*Filter, error) {
+	f := &Filter{}
+
+	for param, vals := range values {
+		value := vals[len(vals)-1]
+
+		var err error
+
+		switch param {
+		case "user_name":
+			f.User = value
+		case "package":
+			f.Package = value
+		case "cache":
+			f.Cache = value
+		case "key":
+			f.Key = value
+		case "method":
+			f.Method = strings.ToUpper(value)
+		case "op":
+			f.Op = value
+		case "since":
+			f.Since, err = time.Parse(time.RFC3339, value)
+		case "until":
+			f.Until, err = time.Parse(time.RFC3339, value)
+		case "before":
+			_, err = strconv.ParseUint(value, 10, 64)
+			f.Before = value
+		case "limit":
+			f.Limit, err = strconv.Atoi(value)
+			if err == nil && f.Limit < 0 {
+				err = fmt.Errorf("negative limit")
+			}
+		default:
+			return nil, fmt.Errorf("unknown parameter '%s'", param)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s'", param, value)
+		}
+	}
+
+	return f, nil
+}
+
+func (f *Filter) match(rec Record) bool {
+	switch {
+	case f.User != "" && rec.User != f.User,
+		f.Package != "" && rec.Package != f.Package,
+		f.Cache != "" && rec.Cache != f.Cache,
+		f.Key != "" && rec.Key != f.Key,
+		f.Method != "" && rec.Method != f.Method,
+		f.Op != "" && rec.Op != f.Op,
+		!f.Since.IsZero() && rec.Timestamp.Before(f.Since),
+		!f.Until.IsZero() && rec.Timestamp.After(f.Until):
+		return false
+	}
+
+	if f.Before != "" {
+		id, _ := strconv.ParseUint(rec.ID, 10, 64)
+		before, _ := strconv.ParseUint(f.Before, 10, 64)
+		return id < before
+	}
+
+	return true
+}
@@ -0,0 +1,325 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileName is the name of the audit log file in the audit directory.
+const fileName = "audit.jsonl"
+
+type auditLog struct {
+	mu      sync.RWMutex
+	records []Record
+
+	// seq is the last record ID issued.
+	seq uint64
+
+	// max caps the records held in memory, the oldest ones are dropped (0 keeps all).
+	max int
+
+	// fileMu serializes the file writes, they are done outside of mu so that the readers are not held up by them.
+	fileMu sync.Mutex
+
+	// file is the optional JSON lines file the records are appended to, path is its location.
+	file *os.File
+	path string
+}
+
+// trail holds the (newest) records in the order they were written.
+var trail = &auditLog{}
+
+// SetMaxRecords caps the records held in memory (and listed), 0 keeps all. The file keeps all of them.
+func SetMaxRecords(max int) {
+	trail.mu.Lock()
+	defer trail.mu.Unlock()
+
+	trail.max = max
+	trail.trim()
+}
+
+// SetDir makes the audit log persistent in such directory, the records already written there are loaded. Blank dir
+// keeps the log in memory only.
+func SetDir(dir string) error {
+	trail.fileMu.Lock()
+	defer trail.fileMu.Unlock()
+
+	trail.mu.Lock()
+	defer trail.mu.Unlock()
+
+	if trail.file != nil {
+		trail.file.Close()
+		trail.file = nil
+		trail.path = ""
+	}
+
+	trail.records = nil
+
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, fileName)
+
+	if err := trail.load(path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+
+	trail.file = file
+	trail.path = path
+	return nil
+}
+
+// load reads the records of the file, the lock has to be held by the caller.
+func (l *auditLog) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+
+	for line := 1; scanner.Scan(); line++ {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		if id, err := strconv.ParseUint(rec.ID, 10, 64); err == nil && id > l.seq {
+			l.seq = id
+		}
+
+		l.records = append(l.records, rec)
+		l.trim()
+	}
+
+	return scanner.Err()
+}
+
+// trim drops the oldest records over the cap, the lock has to be held by the caller.
+func (l *auditLog) trim() {
+	if l.max > 0 && len(l.records) > l.max {
+		l.records = l.records[len(l.records)-l.max:]
+	}
+}
+
+// append assigns the records their IDs and writes them.
+func (l *auditLog) append(recs ...Record) error {
+	l.fileMu.Lock()
+	defer l.fileMu.Unlock()
+
+	l.mu.Lock()
+	for idx := range recs {
+		// IDs are based on the time, so that they keep increasing after the log is cleared.
+		id := uint64(time.Now().UnixNano())
+		if id <= l.seq {
+			id = l.seq + 1
+		}
+		l.seq = id
+
+		recs[idx].ID = strconv.FormatUint(id, 10)
+	}
+
+	l.records = append(l.records, recs...)
+	l.trim()
+
+	file := l.file
+	l.mu.Unlock()
+
+	if file == nil {
+		return nil
+	}
+
+	var data []byte
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+
+		data = append(append(data, line...), '\n')
+	}
+
+	_, err := file.Write(data)
+	return err
+}
+
+// redact replaces such user in all the records (see redactRecord), the file is rewritten, as it may hold more
+// records than the memory.
+func (l *auditLog) redact(name, replacement string) error {
+	l.fileMu.Lock()
+	defer l.fileMu.Unlock()
+
+	l.mu.Lock()
+	for idx := range l.records {
+		redactRecord(&l.records[idx], name, replacement)
+	}
+	l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	return l.rewrite(func(rec *Record) {
+		redactRecord(rec, name, replacement)
+	})
+}
+
+// rewrite replaces the file with its records changed by the fn, the file lock has to be held by the caller.
+func (l *auditLog) rewrite(fn func(rec *Record)) error {
+	src, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := l.path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+
+	writer := bufio.NewWriter(file)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			file.Close()
+			return err
+		}
+
+		fn(&rec)
+
+		data, err := json.Marshal(rec)
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		writer.Write(append(data, '\n'))
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+
+	// Reopen the file as the old descriptor points to the replaced one.
+	reopened, err := os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.file.Close()
+	l.file = reopened
+	l.mu.Unlock()
+
+	return nil
+}
+
+// redactRecord replaces such user's name in the record: the user, the key, the path segments and the changed
+// values. The values changed on the user's own item (the one keyed by the name) are dropped.
+func redactRecord(rec *Record, name, replacement string) {
+	if rec.User == name {
+		rec.User = replacement
+	}
+
+	if rec.Key == name {
+		rec.Key = replacement
+		rec.Diff = nil
+	}
+
+	segments := strings.Split(rec.Path, "/")
+	for idx, segment := range segments {
+		if segment == name {
+			segments[idx] = replacement
+		}
+	}
+	rec.Path = strings.Join(segments, "/")
+
+	for idx := range rec.Diff {
+		rec.Diff[idx].Before = redactValue(rec.Diff[idx].Before, name, replacement)
+		rec.Diff[idx].After = redactValue(rec.Diff[idx].After, name, replacement)
+	}
+}
+
+// redactValue replaces the strings equal to the name in the generic JSON value.
+func redactValue(value any, name, replacement string) any {
+	switch value := value.(type) {
+	case string:
+		if value == name {
+			return replacement
+		}
+
+	case map[string]any:
+		for key, item := range value {
+			value[key] = redactValue(item, name, replacement)
+		}
+
+	case []any:
+		for idx, item := range value {
+			value[idx] = redactValue(item, name, replacement)
+		}
+	}
+
+	return value
+}
+
+// list returns the records matching the filter, the newest first.
+func (l *auditLog) list(f *Filter) []Record {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var recs []Record
+
+	for idx := len(l.records) - 1; idx >= 0; idx-- {
+		if f.Limit > 0 && len(recs) == f.Limit {
+			break
+		}
+
+		if f.match(l.records[idx]) {
+			recs = append(recs, l.records[idx])
+		}
+	}
+
+	return recs
+}
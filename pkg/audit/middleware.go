@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey is the gin.Context key holding the request's changes collected by the change hook.
+const contextKey = "auditChanges"
+
+// changeSet collects the item changes done while serving a single request.
+type changeSet struct {
+	mu      sync.Mutex
+	changes []core.Change
+
+	// erased is the user whose data the request erases, it is replaced in the request's records, see EraseUser.
+	erased      string
+	replacement string
+}
+
+var registerHook sync.Once
+
+// Middleware records every mutating request (POST, PUT, PATCH and DELETE) with the changes of the items it made. It
+// has to follow the authentication middleware, so that the user is known.
+func Middleware() gin.HandlerFunc {
+	registerHook.Do(func() {
+		core.OnChange(collectChange)
+	})
+
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			ctx.Next()
+			return
+		}
+
+		set := &changeSet{}
+		ctx.Set(contextKey, set)
+
+		ctx.Next()
+
+		if err := trail.append(buildRecords(ctx, set)...); err != nil {
+			log.Printf("audit: cannot write the record of %s %s: %s", ctx.Request.Method, ctx.Request.URL.Path, err.Error())
+		}
+	}
+}
+
+// EraseUser replaces such user with the replacement in all the records written so far and in the request's ones,
+// whose changed values are omitted (only the changed items are recorded).
+func EraseUser(ctx *gin.Context, name, replacement string) error {
+	if set, ok := ctx.Value(contextKey).(*changeSet); ok {
+		set.mu.Lock()
+		set.erased = name
+		set.replacement = replacement
+		set.mu.Unlock()
+	}
+
+	return trail.redact(name, replacement)
+}
+
+// collectChange is the change hook adding the change to the request's change set, if any. The hooks are run with
+// the cache's lock held, so the records are built and written once the request has been served.
+func collectChange(ctx context.Context, change core.Change) {
+	set, ok := ctx.Value(contextKey).(*changeSet)
+	if !ok {
+		return
+	}
+
+	set.mu.Lock()
+	set.changes = append(set.changes, change)
+	set.mu.Unlock()
+}
+
+func buildRecords(ctx *gin.Context, set *changeSet) []Record {
+	user, _ := ctx.Value(core.ContextUserName).(string)
+
+	base := Record{
+		Timestamp: time.Now(),
+		User:      user,
+		Method:    ctx.Request.Method,
+		Path:      ctx.Request.URL.Path,
+		Status:    ctx.Writer.Status(),
+		Package:   strings.SplitN(strings.TrimPrefix(ctx.Request.URL.Path, "/"), "/", 2)[0],
+		Key:       ctx.Param("key"),
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	recs := make([]Record, 0, len(set.changes))
+	if len(set.changes) == 0 {
+		recs = append(recs, base)
+	}
+
+	for _, change := range set.changes {
+		rec := base
+		rec.Package = change.Package
+		rec.Cache = change.Cache
+		rec.Key = change.Key
+		rec.Op = change.Op
+
+		// The values are recorded as the requester is served them, the secrets are redacted.
+		if set.erased == "" {
+			change = core.ViewChange(ctx, change)
+			rec.Diff = diff(change.Before, change.After)
+		}
+
+		recs = append(recs, rec)
+	}
+
+	if set.erased != "" {
+		for idx := range recs {
+			redactRecord(&recs[idx], set.erased, set.replacement)
+		}
+	}
+
+	return recs
+}
+
+// diff compares the JSON encodings of the items field by field, nested objects are compared by their fields.
+func diff(before, after any) []FieldChange {
+	changes := []FieldChange{}
+	compareValues("", toValue(before), toValue(after), &changes)
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes
+}
+
+func compareValues(field string, before, after any, changes *[]FieldChange) {
+	beforeObj, beforeIsObj := before.(map[string]any)
+	afterObj, afterIsObj := after.(map[string]any)
+
+	// Compare the objects field by field, missing objects (created and deleted items) are handled as empty ones.
+	if (beforeIsObj || before == nil) && (afterIsObj || after == nil) && (beforeIsObj || afterIsObj) {
+		names := make(map[string]bool)
+		for name := range beforeObj {
+			names[name] = true
+		}
+		for name := range afterObj {
+			names[name] = true
+		}
+
+		for name := range names {
+			path := name
+			if field != "" {
+				path = field + "." + name
+			}
+
+			compareValues(path, beforeObj[name], afterObj[name], changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, FieldChange{Field: field, Before: before, After: after})
+	}
+}
+
+// toValue converts the item to its generic JSON form.
+func toValue(item any) any {
+	if item == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil
+	}
+
+	// Keep the large integers (e.g. UNIX nano timestamps) precise.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil
+	}
+
+	return value
+}
@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"time"
+)
+
+// Record is a single audited change, a mutating request produces a record per changed item (or a single one when
+// nothing has been changed).
+type Record struct {
+	// ID is the unique and increasing identifier of the record.
+	ID string `json:"id"`
+
+	// Timestamp of the request.
+	Timestamp time.Time `json:"timestamp"`
+
+	// User is the name of the authenticated user.
+	User string `json:"user_name"`
+
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+
+	// Path is the requested URL path.
+	Path string `json:"path"`
+
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+
+	// Package is the name of the package of the changed item (or of the request path).
+	Package string `json:"package"`
+
+	// Cache is the full name of the changed item's cache (e.g. dish/sockets).
+	Cache string `json:"cache,omitempty"`
+
+	// Key is the changed item's key.
+	Key string `json:"key,omitempty"`
+
+	// Op is the operation done on the item: set or delete.
+	Op string `json:"op,omitempty"`
+
+	// Diff lists the changed fields of the item.
+	Diff []FieldChange `json:"diff,omitempty"`
+}
+
+// FieldChange is a single changed field, nested fields are referenced by a dotted path (e.g. vm_info.os).
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
@@ -3,97 +3,200 @@ package auth
 import (
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"go.vxn.dev/swis/v5/pkg/config"
+	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/services"
 	"go.vxn.dev/swis/v5/pkg/users"
 
 	"github.com/gin-gonic/gin"
 )
 
-var Params = AuthParams{
-	// Wipe Token string at every request not to allow token forgery.
-	BearerToken: "",
+// ContextKey is the gin.Context key holding the request's *AuthParams.
+const ContextKey = "auth"
+
+// FromContext returns the authentication result of the request, it is set by AuthenticationMiddleware.
+func FromContext(ctx *gin.Context) (*AuthParams, bool) {
+	raw, ok := ctx.Get(ContextKey)
+	if !ok {
+		return nil, false
+	}
+
+	params, ok := raw.(*AuthParams)
+	return params, ok && params != nil
 }
 
 // https://sosedoff.com/2014/12/21/gin-middleware.html
 func AuthenticationMiddleware() gin.HandlerFunc {
-	rootToken := os.Getenv("ROOT_TOKEN")
+	// stop server if root token is not set, it is read per request then, so that it can be reloaded
+	if config.Current().Auth.RootToken == "" {
+		log.Fatal("ROOT_TOKEN not provided! stopping the server now...")
+	}
 
-	// stop server if root token environment var is not set
-	if rootToken == "" {
-		log.Fatal("ROOT_TOKEN environment variable not provided! stopping the server now...")
+	// The JWT bearer authentication is optional.
+	verifier, err := newJWTVerifier()
+	if err != nil {
+		log.Fatalf("cannot load the JWT verification keys: %s", err.Error())
 	}
 
+	// Clients sending invalid tokens repeatedly are locked out for a while.
+	settings := config.Current().Auth
+	guard := newLockout(settings.LockoutAttempts, time.Duration(settings.LockoutDuration))
+
 	return func(ctx *gin.Context) {
-		Params.BearerToken = ""
-		Params.BearerToken = ctx.Request.Header.Get("X-Auth-Token")
-		//c.ShouldBindHeader(&Params)
+		token := ctx.Request.Header.Get("X-Auth-Token")
+		bearer, isBearer := strings.CutPrefix(ctx.Request.Header.Get("Authorization"), "Bearer ")
 
-		// empty token is disallowed
-		if Params.BearerToken == "" {
-			respondWithError(ctx, http.StatusUnauthorized, "empty token")
+		client := ctx.ClientIP()
+		now := time.Now()
+
+		if wait, locked := guard.locked(client, now); locked {
+			ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+			respondWithError(ctx, http.StatusTooManyRequests, "too many invalid tokens, try again later")
 			return
 		}
 
-		// try root token
-		if Params.BearerToken == rootToken {
-			// pass root name and continue
-			Params.User = users.User{Name: "root"}
-			ctx.Next()
+		// empty token is disallowed
+		if token == "" && (!isBearer || verifier == nil) {
+			respondWithError(ctx, http.StatusUnauthorized, "empty token")
 			return
 		}
 
-		// look for token's non-root _active_ owner
-		if authUser := users.FindUserByToken(Params.BearerToken); authUser == nil {
+		// The results are kept per request, so that concurrent requests never share them.
+		var params *AuthParams
+
+		if token == "" {
+			// verify the signed JWT and map its claims to the user
+			claims, err := verifier.verify(bearer, now)
+			if err != nil {
+				guard.fail(client, "", now)
+				respondWithError(ctx, http.StatusUnauthorized, "invalid bearer token: "+err.Error())
+				return
+			}
+
+			authUser, roles := verifier.findUser(claims)
+			if authUser == nil {
+				claimed, _ := claims[verifier.userClaim].(string)
+				guard.fail(client, claimed, now)
+				respondWithError(ctx, http.StatusUnauthorized, "no active user for the bearer token")
+				return
+			}
+
+			params = &AuthParams{
+				User:  *authUser,
+				Roles: roles,
+				ACL:   authUser.ACL,
+			}
+		} else if token == config.Current().Auth.RootToken {
+			// pass root name and continue
+			params = &AuthParams{User: users.User{Name: "root"}}
+		} else if account := services.FindServiceAccountByToken(token); account != nil {
+			// machine clients are limited to their scopes
+			params = &AuthParams{
+				User:    users.User{Name: services.ContextNamePrefix + account.ID},
+				Service: account,
+			}
+		} else if authUser := users.FindUserByToken(token); authUser == nil {
+			// look for token's non-root _active_ owner
+			guard.fail(client, "", now)
 			respondWithError(ctx, http.StatusUnauthorized, "invalid token")
 			return
 		} else {
 			// found, ergo assign that user to auth context
-			Params.User = *authUser
-			Params.Roles = authUser.Roles
-			Params.ACL = authUser.ACL
-
-			ctx.Set("user", Params.User)
+			params = &AuthParams{
+				User:  *authUser,
+				Roles: authUser.Roles,
+				ACL:   authUser.ACL,
+			}
 		}
 
-		//ctx.Next()
+		guard.succeed(client, params.User.Name)
+
+		ctx.Set(ContextKey, params)
+		ctx.Set(core.ContextUserName, params.User.Name)
+		ctx.Set(core.ContextUserRoles, params.Roles)
+		ctx.Next()
 	}
 }
 
 func AuthorizationMiddleware() gin.HandlerFunc {
+	limiter := newRateLimiter()
+
 	return func(ctx *gin.Context) {
+		params, ok := FromContext(ctx)
+		if !ok {
+			respondWithError(ctx, http.StatusUnauthorized, "unauthenticated")
+			return
+		}
+
 		// grant all to root
-		if Params.User.Name == "root" {
+		if params.User.Name == "root" {
 			ctx.Next()
 			return
 		}
 
-		// implement authorization ACL
-		for _, item := range Params.ACL {
-			path := strings.Split(ctx.FullPath(), "/")
+		now := time.Now()
 
-			// serve root path for everyone
-			if ctx.FullPath() == "/" {
-				ctx.Next()
-				return
-			}
+		// Each package is limited per client IP and per user, the most limiting bucket is reported.
+		pkg := strings.Split(strings.TrimPrefix(ctx.Request.URL.Path, "/"), "/")[0]
 
-			// check first requested path "item" against ACL
-			if len(path) > 1 && path[1] == item {
-				// check the persmission for the requested method usage
-				if ok := checkMethodUsagePermission(Params, ctx); !ok {
-					respondWithError(ctx, http.StatusForbidden, "forbidden")
-					return
-				}
+		var statuses []rateStatus
 
-				// access granted according to ACL item and role by method type
-				ctx.Next()
+		if limit := rateLimitOf(config.Current().RateLimit, pkg); limit > 0 {
+			statuses = append(statuses,
+				limiter.take("ip:"+ctx.ClientIP()+"/"+pkg, limit, now),
+				limiter.take("user:"+params.User.Name+"/"+pkg, limit, now),
+			)
+		}
+
+		// service accounts have their own limit across the packages
+		if account := params.Service; account != nil && account.RateLimit > 0 {
+			statuses = append(statuses, limiter.take(params.User.Name, account.RateLimit, now))
+		}
+
+		if !writeRateHeaders(ctx, statuses...) {
+			return
+		}
+
+		// service accounts are checked against their scopes only
+		if account := params.Service; account != nil {
+			if !account.Allows(ctx.Request.Method, ctx.FullPath(), ctx.Param) {
+				respondWithError(ctx, http.StatusForbidden, "forbidden")
 				return
 			}
+
+			ctx.Next()
+			return
+		}
+
+		// serve root path for everyone
+		if ctx.FullPath() == "/" {
+			ctx.Next()
+			return
+		}
+
+		// check the requested path against ACL
+		allowed, own := matchACL(params.ACL, ctx.Request.URL.Path)
+		if !allowed {
+			respondWithError(ctx, http.StatusNotFound, "resource not found")
+			return
+		}
+
+		// check the persmission for the requested method usage
+		if ok := checkMethodUsagePermission(params, ctx); !ok {
+			respondWithError(ctx, http.StatusForbidden, "forbidden")
+			return
+		}
+
+		// limit the request to the user's own items
+		if own {
+			ctx.Set(core.ContextOwnerScope, params.User.Name)
 		}
 
-		respondWithError(ctx, http.StatusNotFound, "resource not found")
-		return
+		// access granted according to ACL item and role by method type
+		ctx.Next()
 	}
 }
@@ -0,0 +1,679 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/roles"
+	"go.vxn.dev/swis/v5/pkg/services"
+	"go.vxn.dev/swis/v5/pkg/users"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+ *  unit/integration tests
+ */
+
+// setupAuthRouter returns a router echoing the authenticated user of each request.
+func setupAuthRouter(t *testing.T) *gin.Engine {
+	t.Setenv("ROOT_TOKEN", "root_token")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	router.Use(AuthenticationMiddleware())
+	router.Use(AuthorizationMiddleware())
+
+	router.Any("/whoami", func(ctx *gin.Context) {
+		params, ok := FromContext(ctx)
+		if !ok {
+			ctx.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"acl":   params.ACL,
+			"name":  params.User.Name,
+			"roles": params.Roles,
+		})
+	})
+
+	users.Cache.Set("alice", users.User{
+		ID:        "alice",
+		Name:      "alice",
+		Active:    true,
+		TokenHash: hashToken(t, "alice_token"),
+		ACL:       []string{"whoami"},
+		Roles:     []string{"admin"},
+	})
+
+	users.Cache.Set("bob", users.User{
+		ID:        "bob",
+		Name:      "bob",
+		Active:    true,
+		TokenHash: hashToken(t, "bob_token"),
+		ACL:       []string{"whoami"},
+	})
+
+	return router
+}
+
+// hashToken keeps the legacy user token the way it is stored.
+func hashToken(t *testing.T, token string) users.TokenHash {
+	hash, err := users.HashToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+type whoami struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+func TestAuthenticationMiddleware(t *testing.T) {
+	r := setupAuthRouter(t)
+
+	for token, code := range map[string]int{
+		"":            http.StatusUnauthorized,
+		"nobody":      http.StatusUnauthorized,
+		"root_token":  http.StatusOK,
+		"alice_token": http.StatusOK,
+	} {
+		req, _ := http.NewRequest("GET", "/whoami", nil)
+		req.Header.Set("X-Auth-Token", token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, code, w.Code, "token '%s'", token)
+	}
+}
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	r := setupAuthRouter(t)
+
+	// only alice holds the admin role allowing DELETE
+	for token, code := range map[string]int{
+		"alice_token": http.StatusOK,
+		"bob_token":   http.StatusForbidden,
+	} {
+		req, _ := http.NewRequest("DELETE", "/whoami", nil)
+		req.Header.Set("X-Auth-Token", token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, code, w.Code, "token '%s'", token)
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	r := setupAuthRouter(t)
+
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+	r.GET("/dish/sockets", ok)
+	r.POST("/dish/sockets/results", ok)
+	r.PUT("/dish/sockets/:key", ok)
+
+	roles.Cache.Set("dish-agent", roles.Role{
+		ID:     "dish-agent",
+		Name:   "dish-agent",
+		Active: true,
+		Permissions: []roles.Permission{
+			{Package: "dish", Path: "/sockets/results", Methods: []string{"POST"}},
+		},
+	})
+
+	roles.Cache.Set("dish-operator", roles.Role{
+		ID:     "dish-operator",
+		Name:   "dish-operator",
+		Active: false,
+		Permissions: []roles.Permission{
+			{Package: "dish", Methods: []string{"read", "write"}},
+		},
+	})
+
+	users.Cache.Set("carol", users.User{
+		ID:        "carol",
+		Name:      "carol",
+		Active:    true,
+		TokenHash: hashToken(t, "carol_token"),
+		ACL:       []string{"dish"},
+		Roles:     []string{"dish-agent", "dish-operator"},
+	})
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{"POST", "/dish/sockets/results", http.StatusOK},
+		{"GET", "/dish/sockets", http.StatusForbidden},
+		// the operator role is inactive
+		{"PUT", "/dish/sockets/mysocket", http.StatusForbidden},
+	} {
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("X-Auth-Token", "carol_token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "%s %s", tc.method, tc.path)
+	}
+}
+
+func TestMatchACL(t *testing.T) {
+	acl := []string{"dish", "finance/accounts:own", "infra/hosts/*/facts", "depots:own", "depots/items"}
+
+	for path, want := range map[string][2]bool{
+		"/dish/sockets/mysocket":    {true, false},
+		"/dishes":                   {false, false},
+		"/finance/accounts":         {true, true},
+		"/finance/accounts/acc":     {true, true},
+		"/finance/items":            {false, false},
+		"/infra/hosts/myhost/facts": {true, false},
+		"/infra/hosts/myhost":       {false, false},
+		"/depots/items/owner/alice": {true, false},
+		"/depots/restore":           {true, true},
+		"/":                         {false, false},
+	} {
+		allowed, own := matchACL(acl, path)
+		assert.Equal(t, want, [2]bool{allowed, own}, path)
+	}
+}
+
+func TestServiceAccount(t *testing.T) {
+	r := setupAuthRouter(t)
+
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+	r.GET("/infra/hosts", ok)
+	r.POST("/infra/hosts/:key/facts", ok)
+
+	services.Cache.Set("facts-uploader", services.ServiceAccount{
+		ID:        "facts-uploader",
+		Name:      "Ansible facts uploader",
+		Active:    true,
+		RateLimit: 4,
+		Scopes: []services.Scope{
+			{Method: "POST", Path: "/infra/hosts/:key/facts", Params: map[string]string{"key": "myhost"}},
+			{Method: "GET", Path: "/infra/hosts"},
+		},
+	})
+
+	tok, token, _ := users.NewToken("facts-uploader", "ansible", nil)
+	services.CacheTokens.Set(tok.ID, tok)
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{"POST", "/infra/hosts/myhost/facts", http.StatusOK},
+		{"GET", "/infra/hosts", http.StatusOK},
+		{"POST", "/infra/hosts/otherhost/facts", http.StatusForbidden},
+		{"GET", "/whoami", http.StatusForbidden},
+		// the fifth request within a minute
+		{"GET", "/infra/hosts", http.StatusTooManyRequests},
+	} {
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("X-Auth-Token", token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "%s %s", tc.method, tc.path)
+	}
+}
+
+func TestParamsForServiceAccount(t *testing.T) {
+	setupAuthRouter(t)
+
+	services.Cache.Set("sockets-watcher", services.ServiceAccount{
+		ID:     "sockets-watcher",
+		Name:   "dish sockets watcher",
+		Active: true,
+		Scopes: []services.Scope{
+			{Method: "GET", Path: "/dish/sockets/:key", Params: map[string]string{"key": "a"}},
+		},
+	})
+	services.Cache.Set("retired", services.ServiceAccount{ID: "retired", Name: "retired"})
+
+	params, ok := ParamsFor(services.ContextNamePrefix + "sockets-watcher")
+	if assert.True(t, ok) {
+		allowed, own := params.CanReadItem("dish/sockets", "a")
+		assert.True(t, allowed)
+		assert.False(t, own)
+
+		// the items out of the account's scopes cannot be read
+		allowed, _ = params.CanReadItem("dish/sockets", "b")
+		assert.False(t, allowed)
+
+		allowed, _ = params.CanReadItem("dish/incidents", "a")
+		assert.False(t, allowed)
+	}
+
+	for _, name := range []string{services.ContextNamePrefix + "retired", services.ContextNamePrefix + "unknown"} {
+		_, ok := ParamsFor(name)
+		assert.False(t, ok, name)
+	}
+}
+
+// Run with the race detector (go test -race) to check the auth context is not shared among requests.
+func TestParallelRequestsIdentity(t *testing.T) {
+	r := setupAuthRouter(t)
+
+	expected := map[string]whoami{
+		"alice_token": {Name: "alice", Roles: []string{"admin"}},
+		"bob_token":   {Name: "bob"},
+		"root_token":  {Name: "root"},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 300)
+
+	for i := 0; i < 100; i++ {
+		for token, want := range expected {
+			wg.Add(1)
+
+			go func(token string, want whoami) {
+				defer wg.Done()
+
+				req, _ := http.NewRequest("GET", "/whoami", nil)
+				req.Header.Set("X-Auth-Token", token)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				var got whoami
+				json.Unmarshal(w.Body.Bytes(), &got)
+
+				if w.Code != http.StatusOK || got.Name != want.Name || len(got.Roles) != len(want.Roles) {
+					errs <- fmt.Errorf("token '%s': got %d %+v, want %+v", token, w.Code, got, want)
+				}
+			}(token, want)
+		}
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// signJWT returns the compact JWS of the claims signed by the RSA (RS256) or ECDSA (ES256) key.
+func signJWT(t *testing.T, key crypto.Signer, kid string, claims map[string]any) string {
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+
+	header, _ := json.Marshal(map[string]any{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+
+	var signature []byte
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest.Sum(nil)); err != nil {
+			t.Fatal(err)
+		}
+
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTBearerAuthentication(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	// the SSO keys are published as JWKS
+	jwks, _ := json.Marshal(map[string]any{
+		"keys": []any{map[string]any{
+			"kty": "RSA",
+			"kid": "sso",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		}},
+	})
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(jwksFile, jwks, 0o600)
+
+	t.Setenv("JWT_JWKS_FILE", jwksFile)
+	t.Setenv("JWT_ISSUER", "https://sso.example.com")
+
+	r := setupAuthRouter(t)
+
+	users.Cache.Set("dave", users.User{
+		ID:        "dave",
+		Name:      "dave",
+		Active:    true,
+		EmailMain: "dave@example.com",
+		ACL:       []string{"whoami"},
+	})
+
+	// the inactive users do not make the claims ambiguous, the active ones do
+	users.Cache.Set("dave-old", users.User{ID: "dave-old", Name: "dave", EmailMain: "dave@example.com"})
+	users.Cache.Set("erin", users.User{ID: "erin", Name: "erin", Active: true, EmailMain: "ops@example.com"})
+	users.Cache.Set("erin-ops", users.User{ID: "erin-ops", Name: "erin", Active: true, EmailMain: "ops@example.com"})
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	for _, tc := range []struct {
+		name   string
+		token  string
+		code   int
+		expect whoami
+	}{
+		{
+			name:   "by name with claimed roles",
+			token:  signJWT(t, rsaKey, "sso", map[string]any{"iss": "https://sso.example.com", "exp": exp, "preferred_username": "alice", "roles": []string{"power"}}),
+			code:   http.StatusOK,
+			expect: whoami{Name: "alice", Roles: []string{"admin", "power"}},
+		},
+		{
+			name:   "by e-mail",
+			token:  signJWT(t, rsaKey, "sso", map[string]any{"iss": "https://sso.example.com", "exp": exp, "email": "dave@example.com"}),
+			code:   http.StatusOK,
+			expect: whoami{Name: "dave"},
+		},
+		{
+			name:  "expired",
+			token: signJWT(t, rsaKey, "sso", map[string]any{"iss": "https://sso.example.com", "exp": time.Now().Add(-time.Hour).Unix(), "preferred_username": "alice"}),
+			code:  http.StatusUnauthorized,
+		},
+		{
+			name:  "foreign issuer",
+			token: signJWT(t, rsaKey, "sso", map[string]any{"iss": "https://evil.example.com", "exp": exp, "preferred_username": "alice"}),
+			code:  http.StatusUnauthorized,
+		},
+		{
+			name:  "foreign key",
+			token: signJWT(t, otherKey, "sso", map[string]any{"iss": "https://sso.example.com", "exp": exp, "preferred_username": "alice"}),
+			code:  http.StatusUnauthorized,
+		},
+		{
+			name:  "ambiguous name",
+			token: signJWT(t, rsaKey, "sso", map[string]any{"iss": "https://sso.example.com", "exp": exp, "preferred_username": "erin"}),
+			code:  http.StatusUnauthorized,
+		},
+		{
+			name:  "ambiguous e-mail",
+			token: signJWT(t, rsaKey, "sso", map[string]any{"iss": "https://sso.example.com", "exp": exp, "email": "ops@example.com"}),
+			code:  http.StatusUnauthorized,
+		},
+		{
+			name:  "no user claims",
+			token: signJWT(t, rsaKey, "sso", map[string]any{"iss": "https://sso.example.com", "exp": exp}),
+			code:  http.StatusUnauthorized,
+		},
+		{
+			name:  "unknown user",
+			token: signJWT(t, rsaKey, "sso", map[string]any{"iss": "https://sso.example.com", "exp": exp, "preferred_username": "mallory"}),
+			code:  http.StatusUnauthorized,
+		},
+	} {
+		req, _ := http.NewRequest("GET", "/whoami", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var got whoami
+		json.Unmarshal(w.Body.Bytes(), &got)
+
+		assert.Equal(t, tc.code, w.Code, tc.name)
+		if tc.code == http.StatusOK {
+			assert.Equal(t, tc.expect.Name, got.Name, tc.name)
+			assert.ElementsMatch(t, tc.expect.Roles, got.Roles, tc.name)
+		}
+	}
+}
+
+func TestJWTLocalKey(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	der, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+
+	t.Setenv("JWT_PUBLIC_KEY_FILE", keyFile)
+
+	r := setupAuthRouter(t)
+
+	token := signJWT(t, ecKey, "", map[string]any{"exp": time.Now().Add(time.Hour).Unix(), "preferred_username": "bob"})
+
+	req, _ := http.NewRequest("GET", "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the X-Auth-Token still works alongside
+	req, _ = http.NewRequest("GET", "/whoami", nil)
+	req.Header.Set("X-Auth-Token", "bob_token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Setenv("RATE_LIMIT", "3")
+	t.Setenv("RATE_LIMIT_HEALTH", "0")
+	r := setupAuthRouter(t)
+
+	r.GET("/health", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	request := func(path, token, ip string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("X-Auth-Token", token)
+		req.RemoteAddr = ip + ":1234"
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for idx := range 3 {
+		w := request("/whoami", "alice_token", "192.0.2.10")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, fmt.Sprint(2-idx), w.Header().Get("RateLimit-Remaining"))
+	}
+
+	w := request("/whoami", "alice_token", "192.0.2.10")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// the user is limited from other addresses too, while other users are not
+	assert.Equal(t, http.StatusTooManyRequests, request("/whoami", "alice_token", "192.0.2.11").Code)
+	assert.Equal(t, http.StatusOK, request("/whoami", "bob_token", "192.0.2.11").Code)
+
+	// the address is limited for all users
+	assert.Equal(t, http.StatusTooManyRequests, request("/whoami", "bob_token", "192.0.2.10").Code)
+
+	// the package without limit and root are not limited
+	w = request("/health", "alice_token", "192.0.2.10")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+
+	assert.Equal(t, http.StatusOK, request("/whoami", "root_token", "192.0.2.10").Code)
+}
+
+func TestTokenBucket(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Now()
+
+	for range 60 {
+		assert.True(t, limiter.take("client", 60, now).allowed)
+	}
+
+	status := limiter.take("client", 60, now)
+	assert.False(t, status.allowed)
+	assert.Equal(t, time.Second, status.retry)
+
+	// a token per second is refilled
+	status = limiter.take("client", 60, now.Add(time.Second))
+	assert.True(t, status.allowed)
+	assert.Equal(t, 0, status.remaining)
+	assert.Equal(t, time.Minute, status.reset)
+}
+
+func TestLimiterCap(t *testing.T) {
+	defer func(max int) { maxClients = max }(maxClients)
+	maxClients = 2
+
+	limiter := newRateLimiter()
+	now := time.Now()
+
+	// the clients over the cap share a bucket
+	assert.True(t, limiter.take("a", 1, now).allowed)
+	assert.True(t, limiter.take("b", 1, now).allowed)
+	assert.True(t, limiter.take("c", 1, now).allowed)
+	assert.False(t, limiter.take("d", 1, now).allowed)
+	assert.Len(t, limiter.buckets, 3)
+
+	// the refilled buckets are swept once per window
+	later := now.Add(rateWindow)
+	assert.True(t, limiter.take("d", 1, later).allowed)
+	assert.Len(t, limiter.buckets, 1)
+
+	guard := newLockout(2, time.Hour)
+
+	guard.fail("a", "", now)
+	guard.fail("b", "", now)
+	guard.fail("c", "", now)
+	guard.fail("d", "", now)
+	assert.Len(t, guard.clients, 3)
+
+	_, locked := guard.locked("e", now)
+	assert.True(t, locked)
+
+	_, locked = guard.locked("a", now)
+	assert.False(t, locked)
+
+	// the forgotten failures are swept, the lockout of the shared entry included
+	later = now.Add(time.Hour)
+	guard.fail("e", "", later)
+	assert.Len(t, guard.clients, 1)
+
+	_, locked = guard.locked("f", later)
+	assert.False(t, locked)
+}
+
+func TestInvalidTokenLockout(t *testing.T) {
+	t.Setenv("AUTH_LOCKOUT_ATTEMPTS", "3")
+	t.Setenv("AUTH_LOCKOUT_DURATION", "1h")
+	r := setupAuthRouter(t)
+
+	// no proxy is trusted, so the forwarded addresses are ignored
+	r.SetTrustedProxies(nil)
+
+	request := func(token, ip string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/whoami", nil)
+		req.Header.Set("X-Auth-Token", token)
+		req.Header.Set("X-Forwarded-For", token+".example.com")
+		req.RemoteAddr = ip + ":1234"
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// a valid token does not reset the failures of the others
+	assert.Equal(t, http.StatusUnauthorized, request("guess_1", "192.0.2.20").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("guess_2", "192.0.2.20").Code)
+	assert.Equal(t, http.StatusOK, request("bob_token", "192.0.2.20").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("guess_3", "192.0.2.20").Code)
+
+	// locked out, valid tokens included
+	w := request("bob_token", "192.0.2.20")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+	// other clients are not affected
+	assert.Equal(t, http.StatusOK, request("bob_token", "192.0.2.21").Code)
+}
+
+func TestLockoutIdentities(t *testing.T) {
+	guard := newLockout(3, time.Hour)
+	now := time.Now()
+
+	// the success resets the failures recorded for the same identity only
+	guard.fail("client", "alice", now)
+	guard.fail("client", "", now)
+	guard.succeed("client", "alice")
+	guard.succeed("client", "bob")
+
+	guard.fail("client", "", now)
+	_, locked := guard.locked("client", now)
+	assert.False(t, locked)
+
+	guard.fail("client", "bob", now)
+	_, locked = guard.locked("client", now)
+	assert.True(t, locked)
+}
+
+func TestPackageRateLimit(t *testing.T) {
+	t.Setenv("RATE_LIMIT", "0")
+	r := setupAuthRouter(t)
+
+	core.MountPackage(r, &core.Package{
+		Name:      "limited",
+		RateLimit: 2,
+		Routes: func(g *gin.RouterGroup) {
+			g.GET("", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+		},
+	})
+
+	// the package's own limit applies without the default one
+	req, _ := http.NewRequest("GET", "/limited", nil)
+	req.Header.Set("X-Auth-Token", "alice_token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+
+	req, _ = http.NewRequest("GET", "/whoami", nil)
+	req.Header.Set("X-Auth-Token", "alice_token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
@@ -1,32 +1,177 @@
 package auth
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"strings"
 
-// contains checks if a string is present in a slice
-// https://freshman.tech/snippets/go/check-if-slice-contains-element/
-func contains(s []string, str string) bool {
-	for _, v := range s {
-		if v == str {
+	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/roles"
+	"go.vxn.dev/swis/v5/pkg/services"
+	"go.vxn.dev/swis/v5/pkg/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ownScope is the ACL entry suffix limiting the access to the user's own items (e.g. finance/accounts:own).
+const ownScope = ":own"
+
+// matchACL checks the request path against the ACL entries. An entry is a path pattern covering the path and all
+// its sub-paths (e.g. finance, or infra/hosts/*/facts), * and :param segments match any single segment. The own
+// result tells the matching entries limit the access to the user's own items.
+func matchACL(acl []string, path string) (allowed, own bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, entry := range acl {
+		pattern, scoped := strings.CutSuffix(entry, ownScope)
+
+		if !matchPath(strings.Split(strings.Trim(pattern, "/"), "/"), segments) {
+			continue
+		}
+
+		// An unlimited entry wins over the limited ones.
+		if !scoped {
+			return true, false
+		}
+
+		allowed, own = true, true
+	}
+
+	return allowed, own
+}
+
+func matchPath(pattern, segments []string) bool {
+	if len(pattern) > len(segments) {
+		return false
+	}
+
+	for idx, part := range pattern {
+		if part == "*" || strings.HasPrefix(part, ":") {
+			continue
+		}
+
+		if part != segments[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkMethodUsagePermission resolves the user's roles against the roles package, a user with no active role is
+// allowed to read only.
+func checkMethodUsagePermission(pp *AuthParams, ctx *gin.Context) bool {
+	method := ctx.Request.Method
+
+	resolved := roles.Resolve(pp.Roles)
+	if len(resolved) == 0 {
+		return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+	}
+
+	// The route pattern is split to the package and the rest of the path, e.g. dish and /sockets/:key.
+	pkg, path, _ := strings.Cut(strings.TrimPrefix(ctx.FullPath(), "/"), "/")
+	if path != "" {
+		path = "/" + path
+	}
+
+	for _, role := range resolved {
+		if role.Allows(pkg, path, method) {
 			return true
 		}
 	}
+
 	return false
 }
 
-// helper function
-func checkMethodUsagePermission(pp AuthParams, ctx *gin.Context) bool {
-	roles := pp.Roles
-	method := ctx.Request.Method
+// ParamsFor returns the auth params of the active user of such name (or root, or the active service account named
+// as in the requests' context), so that the actions made on the user's behalf outside of the requests (e.g. the
+// webhook deliveries) are checked as the user's requests are.
+func ParamsFor(name string) (*AuthParams, bool) {
+	if name == "root" {
+		return &AuthParams{User: users.User{Name: "root"}}, true
+	}
 
-	switch method {
-	case "PUT", "POST", "PATCH", "UPDATE":
-		return contains(roles, "power") || contains(roles, "admin")
+	if id, ok := strings.CutPrefix(name, services.ContextNamePrefix); ok {
+		account, ok := services.Cache.Get(id)
+		if !ok || !account.Active {
+			return nil, false
+		}
 
-	case "DELETE":
-		return contains(roles, "admin")
+		return &AuthParams{User: users.User{Name: name}, Service: &account}, true
 	}
 
-	return true
+	for _, user := range users.Cache.Lookup("name", name) {
+		if user.Active {
+			return &AuthParams{User: user, Roles: user.Roles, ACL: user.ACL}, true
+		}
+	}
+
+	return nil, false
+}
+
+// CanReadItem reports whether the params allow reading the item of such cache (e.g. dish/sockets), own tells the
+// access is limited to the user's own items.
+func (p *AuthParams) CanReadItem(cacheName, key string) (allowed, own bool) {
+	if p.User.Name == "root" {
+		return true, false
+	}
+
+	// The item's route, e.g. dish and /sockets/:key.
+	pkg, sub, _ := strings.Cut(cacheName, "/")
+	path := "/:key"
+	if sub != "" {
+		path = "/" + sub + path
+	}
+
+	// service accounts are checked against their scopes only
+	if p.Service != nil {
+		return p.Service.Allows(http.MethodGet, "/"+pkg+path, func(name string) string {
+			if name == "key" {
+				return key
+			}
+			return ""
+		}), false
+	}
+
+	allowed, own = matchACL(p.ACL, "/"+cacheName+"/"+key)
+	if !allowed {
+		return false, false
+	}
+
+	resolved := roles.Resolve(p.Roles)
+	if len(resolved) == 0 {
+		return true, own
+	}
+
+	for _, role := range resolved {
+		if role.Allows(pkg, path, http.MethodGet) {
+			return true, own
+		}
+	}
+
+	return false, false
+}
+
+// FeedEventFor returns the change feed event as the user would read its item, if the user may read it at all.
+func FeedEventFor(user string, ev core.FeedEvent) (core.FeedEvent, bool) {
+	params, ok := ParamsFor(user)
+	if !ok {
+		return ev, false
+	}
+
+	allowed, own := params.CanReadItem(ev.Cache, ev.Key)
+	if !allowed {
+		return ev, false
+	}
+
+	ctx := &gin.Context{}
+	ctx.Set(core.ContextUserName, params.User.Name)
+	ctx.Set(core.ContextUserRoles, params.Roles)
+
+	if own {
+		ctx.Set(core.ContextOwnerScope, params.User.Name)
+	}
+
+	return core.ViewFeedEvent(ctx, ev)
 }
 
 func respondWithError(ctx *gin.Context, code int, message interface{}) {
@@ -0,0 +1,426 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/config"
+	"go.vxn.dev/swis/v5/pkg/users"
+)
+
+// jwtLeeway is the clock skew tolerated when checking the token's time claims.
+const jwtLeeway = time.Minute
+
+var (
+	errJWTMalformed = errors.New("malformed token")
+	errJWTKey       = errors.New("no key to verify the token")
+	errJWTSignature = errors.New("invalid token signature")
+	errJWTExpired   = errors.New("token expired or not valid yet")
+	errJWTClaims    = errors.New("token not issued for this server")
+)
+
+// jwtVerifier verifies the signed JWTs (JWS compact serialization) against the configured public keys.
+type jwtVerifier struct {
+	// keys maps the key IDs to the public keys, a key without ID is stored under the blank one.
+	keys map[string]crypto.PublicKey
+
+	// issuer and audience are checked against the iss and aud claims, if set.
+	issuer   string
+	audience string
+
+	// The claims holding the user's name, e-mail address and the roles.
+	userClaim  string
+	emailClaim string
+	rolesClaim string
+}
+
+// jsonWebKey is a single public key of the JWKS (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+
+	// RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP keys.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// newJWTVerifier configures the verifier by the jwt section: the jwks_file (a JSON Web Key Set) or the
+// public_key_file (a PEM-encoded public key), optionally the issuer, the audience and the claim names. It returns nil
+// when no key is configured.
+func newJWTVerifier() (*jwtVerifier, error) {
+	cfg := config.Current().JWT
+	jwksFile, keyFile := cfg.JWKSFile, cfg.PublicKeyFile
+
+	if jwksFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	v := &jwtVerifier{
+		keys:       make(map[string]crypto.PublicKey),
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		userClaim:  cfg.UserClaim,
+		emailClaim: cfg.EmailClaim,
+		rolesClaim: cfg.RolesClaim,
+	}
+
+	if jwksFile != "" {
+		if err := v.loadJWKS(jwksFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if keyFile != "" {
+		if err := v.loadPEM(keyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+func (v *jwtVerifier) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, jwk := range set.Keys {
+		// Encryption keys are of no use here.
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return fmt.Errorf("%s: key '%s': %w", path, jwk.Kid, err)
+		}
+
+		v.keys[jwk.Kid] = key
+	}
+
+	if len(v.keys) == 0 {
+		return fmt.Errorf("%s: no signing keys", path)
+	}
+
+	return nil
+}
+
+func (v *jwtVerifier) loadPEM(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM data", path)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	v.keys[""] = key
+	return nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+
+		curve, ok := curves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve '%s'", jwk.Crv)
+		}
+
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported curve '%s'", jwk.Crv)
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type '%s'", jwk.Kty)
+}
+
+// verify checks the token's signature and its time, issuer and audience claims. It returns the claims.
+func (v *jwtVerifier) verify(token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errJWTMalformed
+	}
+
+	// A token without the key ID can be verified by the only key configured.
+	key, ok := v.keys[header.Kid]
+	if !ok && header.Kid == "" && len(v.keys) == 1 {
+		for _, only := range v.keys {
+			key, ok = only, true
+		}
+	}
+
+	if !ok {
+		return nil, errJWTKey
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+
+	if !verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, errJWTSignature
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errJWTMalformed
+	}
+
+	// The expiration is required, the tokens are bearer ones.
+	exp, ok := numericClaim(claims, "exp")
+	if !ok || now.After(exp.Add(jwtLeeway)) {
+		return nil, errJWTExpired
+	}
+
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(jwtLeeway).Before(nbf) {
+		return nil, errJWTExpired
+	}
+
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return nil, errJWTClaims
+	}
+
+	if v.audience != "" && !contains(stringsClaim(claims, "aud"), v.audience) {
+		return nil, errJWTClaims
+	}
+
+	return claims, nil
+}
+
+// verifySignature checks the signature by the algorithm, which has to match the key type. Symmetric algorithms
+// (and none) are refused, as only the public keys are configured.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) bool {
+	hashes := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+
+	if alg == "EdDSA" {
+		pub, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, signed, signature)
+	}
+
+	if len(alg) != 5 {
+		return false
+	}
+
+	hash, ok := hashes[alg[2:]]
+	if !ok {
+		return false
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(pub, hash, digest, signature, nil) == nil
+
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+
+		// The signature is the fixed-size concatenation of R and S.
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func numericClaim(claims map[string]any, name string) (time.Time, bool) {
+	num, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	secs, err := num.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(secs), 0), true
+}
+
+// stringsClaim returns the claim as a list, single strings included.
+func stringsClaim(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+
+	case []any:
+		var list []string
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+
+	return nil
+}
+
+// findUser maps the claims to the active user by the name, or by the e-mail address. The ambiguous claims (matching
+// more than one active user) are refused. The roles claimed are added to the user's own roles.
+func (v *jwtVerifier) findUser(claims map[string]any) (*users.User, []string) {
+	var found *users.User
+
+	lookups := []struct{ claim, field string }{
+		{v.userClaim, "name"},
+		{v.emailClaim, "email_main"},
+	}
+
+	for _, lookup := range lookups {
+		value, _ := claims[lookup.claim].(string)
+		if value == "" {
+			continue
+		}
+
+		var active []users.User
+		for _, user := range users.Cache.Lookup(lookup.field, value) {
+			if user.Active {
+				active = append(active, user)
+			}
+		}
+
+		if len(active) > 1 {
+			log.Printf("auth: bearer token claims %s '%s' of %d active users, refusing it", lookup.field, value, len(active))
+			return nil, nil
+		}
+
+		if len(active) == 1 {
+			found = &active[0]
+			break
+		}
+	}
+
+	if found == nil {
+		return nil, nil
+	}
+
+	roles := append([]string{}, found.Roles...)
+	for _, role := range stringsClaim(claims, v.rolesClaim) {
+		if !contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	return found, roles
+}
+
+// contains checks if a string is present in a slice.
+func contains(s []string, str string) bool {
+	for _, v := range s {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/config"
+	"go.vxn.dev/swis/v5/pkg/core"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateWindow is the period the rate limits are set for: the limit of 60 allows a request per second on average,
+// with bursts of up to 60 requests.
+const rateWindow = time.Minute
+
+// overflowClient is the entry shared by the clients over maxClients, so that the limiter and the lockout cannot grow
+// unbounded (e.g. by the requests from many addresses).
+const overflowClient = "*"
+
+// maxClients caps the clients tracked by the limiter and by the lockout, the overflow entry aside.
+var maxClients = 1 << 16
+
+// rateLimiter is a token-bucket limiter of the clients' requests.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	// swept is the time of the last sweep of the refilled buckets, they are swept once per rateWindow.
+	swept time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateStatus describes the client's bucket after a request.
+type rateStatus struct {
+	allowed bool
+
+	limit     int
+	remaining int
+
+	// reset is the time until the bucket is full again, retry the time until the next request is allowed.
+	reset time.Duration
+	retry time.Duration
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*bucket)}
+}
+
+// take takes a token from the client's bucket of such limit per rateWindow.
+func (l *rateLimiter) take(client string, limit int, now time.Time) rateStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rate := float64(limit) / rateWindow.Seconds()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		l.sweep(now)
+
+		if len(l.buckets) >= maxClients {
+			b, ok = l.buckets[overflowClient]
+			client = overflowClient
+		}
+	}
+
+	if !ok {
+		b = &bucket{tokens: float64(limit), last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	status := rateStatus{limit: limit}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		status.allowed = true
+	} else {
+		status.retry = seconds((1 - b.tokens) / rate)
+	}
+
+	status.remaining = int(b.tokens)
+	status.reset = seconds((float64(limit) - b.tokens) / rate)
+
+	return status
+}
+
+// sweep drops the refilled buckets, at most once per rateWindow. The lock has to be held by the caller.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateWindow {
+		return
+	}
+	l.swept = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= rateWindow {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// writeRateHeaders sets the RateLimit-* headers by the most limiting status. If any of them was exceeded, the request
+// is refused with Retry-After and false is returned.
+func writeRateHeaders(ctx *gin.Context, statuses ...rateStatus) bool {
+	if len(statuses) == 0 {
+		return true
+	}
+
+	worst := statuses[0]
+	for _, status := range statuses[1:] {
+		if worst.allowed && (!status.allowed || status.remaining < worst.remaining) {
+			worst = status
+		}
+	}
+
+	ctx.Header("RateLimit-Limit", strconv.Itoa(worst.limit))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(worst.remaining))
+	ctx.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(worst.reset)))
+
+	if !worst.allowed {
+		ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(worst.retry)))
+		respondWithError(ctx, http.StatusTooManyRequests, "rate limit exceeded")
+		return false
+	}
+
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// rateLimitOf returns the requests per minute allowed to a single client of such package: the override set by
+// rate_limit.packages (or RATE_LIMIT_<PACKAGE>) replaces the package's own limit, the default (RATE_LIMIT) applies to
+// the others. Zero disables the limiting.
+func rateLimitOf(limits config.RateLimitConfig, pkg string) int {
+	if limit, ok := limits.Packages[strings.ReplaceAll(pkg, "-", "_")]; ok {
+		return limit
+	}
+
+	if limit := core.PackageRateLimit(pkg); limit > 0 {
+		return limit
+	}
+
+	return limits.Default
+}
+
+// lockout locks the clients out after repeated authentication failures.
+type lockout struct {
+	// attempts is the count of failures the client is locked out after, zero disables the lockout.
+	attempts int
+
+	// duration is the lockout duration, the failures older than that are forgotten.
+	duration time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*failures
+
+	// swept is the time of the last sweep of the forgotten failures, they are swept once per duration.
+	swept time.Time
+}
+
+type failures struct {
+	count int
+	last  time.Time
+	until time.Time
+
+	// identities counts the failures by the identities they were recorded for (the user claimed by a bearer token
+	// with no active user), the failures of unknown identities are counted in count only.
+	identities map[string]int
+}
+
+func newLockout(attempts int, duration time.Duration) *lockout {
+	return &lockout{attempts: attempts, duration: duration, clients: make(map[string]*failures)}
+}
+
+// locked returns the remaining lockout time of the client.
+func (l *lockout) locked(client string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.clients[client]
+	if !ok && len(l.clients) >= maxClients {
+		f, ok = l.clients[overflowClient]
+	}
+
+	if !ok || !now.Before(f.until) {
+		return 0, false
+	}
+
+	return f.until.Sub(now), true
+}
+
+// fail counts the client's failure, the identity is blank if unknown.
+func (l *lockout) fail(client, identity string, now time.Time) {
+	if l.attempts <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.clients[client]
+	if !ok {
+		l.sweep(now)
+
+		if len(l.clients) >= maxClients {
+			f, ok = l.clients[overflowClient]
+			client = overflowClient
+		}
+	}
+
+	if !ok || now.Sub(f.last) >= l.duration {
+		f = &failures{}
+		l.clients[client] = f
+	}
+
+	f.count++
+	f.last = now
+
+	if identity != "" {
+		if f.identities == nil {
+			f.identities = make(map[string]int)
+		}
+		f.identities[identity]++
+	}
+
+	if f.count >= l.attempts {
+		f.count = 0
+		f.identities = nil
+		f.until = now.Add(l.duration)
+	}
+}
+
+// sweep drops the forgotten failures of the clients not locked out, at most once per duration. The lock has to be
+// held by the caller.
+func (l *lockout) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.duration {
+		return
+	}
+	l.swept = now
+
+	for key, f := range l.clients {
+		if now.Sub(f.last) >= l.duration && !now.Before(f.until) {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// succeed forgets the client's failures recorded for the identity that authenticated, so that a valid token does not
+// reset the guesses of the others.
+func (l *lockout) succeed(client, identity string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.clients[client]
+	if !ok {
+		return
+	}
+
+	f.count -= f.identities[identity]
+	delete(f.identities, identity)
+
+	if f.count <= 0 && f.until.IsZero() {
+		delete(l.clients, client)
+	}
+}
@@ -1,13 +1,12 @@
 package auth
 
 import (
+	"go.vxn.dev/swis/v5/pkg/services"
 	"go.vxn.dev/swis/v5/pkg/users"
 )
 
+// AuthParams is the authentication result of a single request, see FromContext.
 type AuthParams struct {
-	// Token string to load and verify against internal 'users' module, authentication.
-	BearerToken string `header:"X-Auth-Token" binding:"required" verification:"required"`
-
 	// User object to add to server context.
 	User users.User
 
@@ -17,4 +16,7 @@ type AuthParams struct {
 
 	// Access Control List. List of allowed modules to access.
 	ACL []string
+
+	// Service is the service account of the request, the User is not a real one then.
+	Service *services.ServiceAccount
 }
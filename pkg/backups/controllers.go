@@ -9,10 +9,10 @@ import (
 )
 
 var (
-	Cache *core.Cache
+	Cache = &core.Cache[Backup]{}
 
-	caches = []**core.Cache{
-		&Cache,
+	caches = []core.CacheInterface{
+		Cache,
 	}
 	pkgName string = "backups"
 )
@@ -25,11 +25,10 @@ var Package *core.Package = &core.Package{
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"Cache"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
 }
 
 // @Summary Get all backed up services
@@ -108,12 +107,11 @@ func ListTypes(ctx *gin.Context) {
 // @Success 200 {object} backups.Backup
 // @Router /backups/{key} [put]
 func UpdateBackupStatusByServiceKey(ctx *gin.Context) {
-	var updatedService Backup
 	var postedService Backup
 
 	var name string = ctx.Param("key")
 
-	rawService, found := Cache.Get(name)
+	updatedService, found := Cache.Get(name)
 	if !found {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
@@ -123,15 +121,6 @@ func UpdateBackupStatusByServiceKey(ctx *gin.Context) {
 		return
 	}
 
-	updatedService, ok := rawService.(Backup)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"message": "cannot assert data type, database internal error",
-			"code":    http.StatusInternalServerError,
-		})
-		return
-	}
-
 	if err := ctx.BindJSON(&postedService); err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
 			"code":    http.StatusBadRequest,
@@ -147,7 +136,7 @@ func UpdateBackupStatusByServiceKey(ctx *gin.Context) {
 	updatedService.FileName = postedService.FileName
 	updatedService.Size = postedService.Size
 
-	if saved := Cache.Set(name, updatedService); !saved {
+	if saved := Cache.SetContext(ctx, name, updatedService); !saved {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "backed up service couldn't be saved to database",
@@ -163,6 +152,18 @@ func UpdateBackupStatusByServiceKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch backup by its service key
+// @Description patch backup by its service key (JSON merge patch)
+// @Tags backups
+// @Produce json
+// @Param request body backups.Backup true "merge patch of the item"
+// @Success 200 {object} backups.Backup
+// @Router /backups/{key} [patch]
+func PatchBackupByServiceKey(ctx *gin.Context) {
+	core.PatchItemByParam[Backup](ctx, Cache, pkgName, Backup{})
+	return
+}
+
 // (PUT /backups/{service}/active)
 // @Summary Acitive/inactive backup toggle by its key
 // @Description active/inactive backup toggle by its key
@@ -172,10 +173,9 @@ func UpdateBackupStatusByServiceKey(ctx *gin.Context) {
 // @Success 200 {object} backups.Backup
 // @Router /backups/{key}/active [put]
 func ActiveToggleBackupByServiceKey(ctx *gin.Context) {
-	var service Backup
 	var name string = ctx.Param("key")
 
-	rawService, found := Cache.Get(name)
+	service, found := Cache.Get(name)
 	if !found {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
@@ -185,19 +185,10 @@ func ActiveToggleBackupByServiceKey(ctx *gin.Context) {
 		return
 	}
 
-	service, ok := rawService.(Backup)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"message": "cannot assert data type, database internal error",
-		})
-		return
-	}
-
 	// inverse the Active field value
 	service.Active = !service.Active
 
-	if saved := Cache.Set(name, service); !saved {
+	if saved := Cache.SetContext(ctx, name, service); !saved {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "backed up service couldn't be saved to database",
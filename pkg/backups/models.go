@@ -35,5 +35,5 @@ type Backup struct {
 	ProjectID string `json:"project_id"`
 
 	// Boolean indicating if the service is to be backuped.
-	Active bool `json:"active" default:false`
+	Active bool `json:"active" default:"false"`
 }
@@ -13,6 +13,8 @@ func Routes(g *gin.RouterGroup) {
 		GetBackedupStatusByServiceKey)
 	g.PUT("/:key",
 		UpdateBackupStatusByServiceKey)
+	g.PATCH("/:key",
+		PatchBackupByServiceKey)
 	g.DELETE("/:key",
 		DeleteBackupByServiceKey)
 	g.PUT("/:key/active",
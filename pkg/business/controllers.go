@@ -7,10 +7,13 @@ import (
 )
 
 var (
-	Cache *core.Cache
+	Cache = &core.Cache[Business]{}
 
-	caches = []**core.Cache{
-		&Cache,
+	caches = []core.CacheInterface{
+		Cache,
+	}
+	owners = map[core.CacheInterface]string{
+		Cache: "username",
 	}
 	pkgName string = "business"
 )
@@ -20,14 +23,14 @@ var Package *core.Package = &core.Package{
 	Cache:   caches,
 	Routes:  Routes,
 	Generic: true,
+	Owners:  owners,
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"Cache"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
 }
 
 // @Summary Get all business entities
@@ -76,6 +79,18 @@ func UpdateBusinessByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch business entity by its key
+// @Description patch business entity by its key (JSON merge patch)
+// @Tags business
+// @Produce json
+// @Param request body business.Business true "merge patch of the item"
+// @Success 200 {object} business.Business
+// @Router /business/{key} [patch]
+func PatchBusinessByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Business](ctx, Cache, pkgName, Business{})
+	return
+}
+
 // @Summary Delete business by its key
 // @Description delete business by its key
 // @Tags business
@@ -14,6 +14,8 @@ func Routes(g *gin.RouterGroup) {
 		GetBusinessByKey)
 	g.PUT("/:key",
 		UpdateBusinessByKey)
+	g.PATCH("/:key",
+		PatchBusinessByKey)
 	g.DELETE("/:key",
 		DeleteBusinessByKey)
 	g.POST("/restore",
@@ -0,0 +1,499 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the set secret values in the redacted view.
+const redacted = "********"
+
+// Config is the server's configuration. It is layered: the defaults, the file named by CONFIG_FILE (YAML, TOML or
+// JSON) and the environment variables (named by the env tags), the later layers override the earlier ones. The
+// settings tagged restart are applied on start only, see Applied.
+type Config struct {
+	App        AppConfig        `json:"app"`
+	Server     ServerConfig     `json:"server"`
+	Auth       AuthConfig       `json:"auth"`
+	JWT        JWTConfig        `json:"jwt"`
+	RateLimit  RateLimitConfig  `json:"rate_limit"`
+	CORS       CORSConfig       `json:"cors"`
+	Storage    StorageConfig    `json:"storage"`
+	Secrets    SecretsConfig    `json:"secrets"`
+	Mirror     MirrorConfig     `json:"mirror"`
+	Follower   FollowerConfig   `json:"follower"`
+	Feed       FeedConfig       `json:"feed"`
+	Webhooks   WebhooksConfig   `json:"webhooks"`
+	Cloudflare CloudflareConfig `json:"cloudflare"`
+
+	file     string
+	loadedAt time.Time
+}
+
+// AppConfig describes the running instance, it is set by the image build mostly.
+type AppConfig struct {
+	Environment   string `json:"environment" env:"APP_ENVIRONMENT"`
+	Instance      string `json:"instance" env:"HOSTNAME"`
+	Version       string `json:"version" env:"APP_VERSION"`
+	AlpineVersion string `json:"alpine_version" env:"ALPINE_VERSION"`
+	GolangVersion string `json:"golang_version" env:"GOLANG_VERSION"`
+}
+
+type ServerConfig struct {
+	Port int `json:"port" env:"SERVER_PORT" restart:"true" validate:"required,min=1,max=65535"`
+
+	// TrustedProxies are the addresses (or CIDR ranges) of the reverse proxies whose X-Forwarded-For is believed,
+	// the client address is the connection's remote address otherwise.
+	TrustedProxies []string `json:"trusted_proxies" env:"TRUSTED_PROXIES" restart:"true" validate:"dive,cidr|ip"`
+}
+
+type AuthConfig struct {
+	RootToken string `json:"root_token" env:"ROOT_TOKEN" secret:"true" validate:"required"`
+
+	// The clients sending LockoutAttempts invalid tokens in a row are locked out for the LockoutDuration.
+	LockoutAttempts int      `json:"lockout_attempts" env:"AUTH_LOCKOUT_ATTEMPTS" restart:"true" validate:"min=0"`
+	LockoutDuration Duration `json:"lockout_duration" env:"AUTH_LOCKOUT_DURATION" restart:"true" validate:"min=0"`
+}
+
+// JWTConfig enables the JWT bearer authentication if a key file is set.
+type JWTConfig struct {
+	JWKSFile      string `json:"jwks_file" env:"JWT_JWKS_FILE" restart:"true"`
+	PublicKeyFile string `json:"public_key_file" env:"JWT_PUBLIC_KEY_FILE" restart:"true"`
+	Issuer        string `json:"issuer" env:"JWT_ISSUER" restart:"true"`
+	Audience      string `json:"audience" env:"JWT_AUDIENCE" restart:"true"`
+	UserClaim     string `json:"user_claim" env:"JWT_USER_CLAIM" restart:"true" validate:"required"`
+	EmailClaim    string `json:"email_claim" env:"JWT_EMAIL_CLAIM" restart:"true" validate:"required"`
+	RolesClaim    string `json:"roles_claim" env:"JWT_ROLES_CLAIM" restart:"true" validate:"required"`
+}
+
+// RateLimitConfig sets the requests per minute a single client can make to a package, zero disables the limiting.
+type RateLimitConfig struct {
+	Default int `json:"default" env:"RATE_LIMIT" validate:"min=0"`
+
+	// Packages override the packages' own limits by their names, they are set by RATE_LIMIT_<PACKAGE> too.
+	Packages map[string]int `json:"packages" validate:"dive,min=0"`
+}
+
+type CORSConfig struct {
+	// Origins are allowed to make the cross-origin requests (comma-separated in the environment).
+	Origins []string `json:"origins" env:"CORS_ORIGINS" validate:"dive,url"`
+}
+
+type StorageConfig struct {
+	PersistenceDir string `json:"persistence_dir" env:"PERSISTENCE_DIR" restart:"true"`
+	WALDir         string `json:"wal_dir" env:"WAL_DIR" restart:"true"`
+	AuditDir       string `json:"audit_dir" env:"AUDIT_DIR" restart:"true"`
+
+	// WALRetention is how long the WAL segments covered by a later checkpoint are kept for the recovery.
+	WALRetention Duration `json:"wal_retention" env:"WAL_RETENTION" restart:"true" validate:"min=0"`
+
+	// AuditMaxRecords caps the audit records held in memory (0 keeps all), the file keeps all of them.
+	AuditMaxRecords int `json:"audit_max_records" env:"AUDIT_MAX_RECORDS" restart:"true" validate:"gte=0"`
+}
+
+type SecretsConfig struct {
+	Key string `json:"key" env:"SECRETS_KEY" secret:"true" restart:"true"`
+}
+
+type MirrorConfig struct {
+	Peers     []string `json:"peers" env:"MIRROR_PEERS" validate:"dive,url"`
+	Retries   int      `json:"retries" env:"MIRROR_RETRIES" validate:"min=0"`
+	QueueSize int      `json:"queue_size" env:"MIRROR_QUEUE_SIZE" validate:"min=1"`
+
+	// Token authenticates the replicated requests to the peers, the callers' credentials are never forwarded.
+	Token string `json:"token" env:"MIRROR_TOKEN" secret:"true" validate:"required_with=Peers"`
+
+	// Secret signs the replicated requests, it has to be shared by all the peers.
+	Secret string `json:"secret" env:"MIRROR_SECRET" secret:"true" validate:"required_with=Peers"`
+}
+
+type FollowerConfig struct {
+	Leader      string `json:"leader" env:"FOLLOW_LEADER" restart:"true" validate:"omitempty,url"`
+	LeaderToken string `json:"leader_token" env:"LEADER_TOKEN" secret:"true" restart:"true"`
+	ProxyWrites bool   `json:"proxy_writes" env:"FOLLOWER_PROXY_WRITES" restart:"true"`
+}
+
+type FeedConfig struct {
+	Size int `json:"size" env:"FEED_SIZE" restart:"true" validate:"min=1"`
+}
+
+type WebhooksConfig struct {
+	Retries   int `json:"retries" env:"WEBHOOK_RETRIES" restart:"true" validate:"min=0"`
+	QueueSize int `json:"queue_size" env:"WEBHOOK_QUEUE_SIZE" restart:"true" validate:"min=1"`
+
+	// AllowedNetworks are the CIDR ranges of the loopback, link-local and private addresses the webhooks may target
+	// (comma-separated in the environment), such targets are refused otherwise.
+	AllowedNetworks []string `json:"allowed_networks" env:"WEBHOOK_ALLOWED_NETWORKS" validate:"dive,cidr"`
+}
+
+type CloudflareConfig struct {
+	APIEmail string `json:"api_email" env:"CF_API_EMAIL"`
+	APIToken string `json:"api_token" env:"CF_API_TOKEN" secret:"true"`
+}
+
+// Duration is a time.Duration written as a string, e.g. 15m.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration has to be a string (e.g. 15m)")
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// defaults returns the configuration all the layers are applied to.
+func defaults() *Config {
+	return &Config{
+		App: AppConfig{
+			Instance: "swis-api",
+		},
+		Auth: AuthConfig{
+			LockoutAttempts: 10,
+			LockoutDuration: Duration(15 * time.Minute),
+		},
+		JWT: JWTConfig{
+			UserClaim:  "preferred_username",
+			EmailClaim: "email",
+			RolesClaim: "roles",
+		},
+		RateLimit: RateLimitConfig{
+			Default:  600,
+			Packages: map[string]int{},
+		},
+		Mirror: MirrorConfig{
+			Retries:   8,
+			QueueSize: 1000,
+		},
+		Storage: StorageConfig{
+			WALRetention:    Duration(7 * 24 * time.Hour),
+			AuditMaxRecords: 10000,
+		},
+		Feed: FeedConfig{
+			Size: 10000,
+		},
+		Webhooks: WebhooksConfig{
+			Retries:   8,
+			QueueSize: 1000,
+		},
+	}
+}
+
+// current is the configuration of the last successful Load, started the one of the first Load (on start).
+var current, started atomic.Pointer[Config]
+
+// Read reads the configuration layers without validating them, see Load.
+func Read() (*Config, error) {
+	cfg := defaults()
+	cfg.file = os.Getenv("CONFIG_FILE")
+	cfg.loadedAt = time.Now()
+
+	if cfg.file != "" {
+		if err := cfg.readFile(cfg.file); err != nil {
+			return nil, fmt.Errorf("cannot read CONFIG_FILE %s: %w", cfg.file, err)
+		}
+	}
+
+	if err := cfg.readEnv(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Load reads and validates the configuration, it becomes the current one if valid. It is called on start and on
+// SIGHUP, the invalid configuration leaves the current one in place.
+func Load() (*Config, error) {
+	cfg, err := Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	started.CompareAndSwap(nil, cfg)
+	current.Store(cfg)
+	return cfg, nil
+}
+
+// Current returns the configuration of the last successful Load. Before the first one (e.g. in tests) it returns
+// the configuration read anew, the invalid layers are skipped then.
+func Current() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+
+	cfg, err := Read()
+	if err != nil {
+		return defaults()
+	}
+
+	return cfg
+}
+
+// File returns the configuration file's path, blank if none was read.
+func (c *Config) File() string {
+	return c.file
+}
+
+// LoadedAt returns the time the configuration was read at.
+func (c *Config) LoadedAt() time.Time {
+	return c.loadedAt
+}
+
+// Applied returns a copy of the configuration with the settings applied on start only (tagged restart) as the server
+// has been started with, and the dotted names of such settings changed since then, pending the restart.
+func (c *Config) Applied() (*Config, []string) {
+	cfg := *c
+	pending := []string{}
+
+	if base := started.Load(); base != nil {
+		applyStarted(reflect.ValueOf(&cfg).Elem(), reflect.ValueOf(base).Elem(), "", &pending)
+	}
+
+	return &cfg, pending
+}
+
+// applyStarted sets the section's restart settings to the started ones, the changed ones are listed as pending.
+func applyStarted(section, base reflect.Value, prefix string, pending *[]string) {
+	typ := section.Type()
+
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeFor[Duration]() {
+			applyStarted(section.Field(idx), base.Field(idx), prefix+name+".", pending)
+			continue
+		}
+
+		if field.Tag.Get("restart") != "true" || reflect.DeepEqual(section.Field(idx).Interface(), base.Field(idx).Interface()) {
+			continue
+		}
+
+		*pending = append(*pending, prefix+name)
+		section.Field(idx).Set(base.Field(idx))
+	}
+}
+
+// readFile applies the file's settings, the format is given by the extension. The unknown settings are refused, so
+// that the typos do not pass unnoticed.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]any
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("unknown format '%s', use .yaml, .toml or .json", ext)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// The document is decoded by the JSON names, so that all the formats share them.
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(c)
+}
+
+// readEnv applies the environment variables named by the fields' env tags, the blank ones are skipped.
+func (c *Config) readEnv() error {
+	var errs []error
+
+	walkFields(reflect.ValueOf(c).Elem(), func(field reflect.StructField, val reflect.Value) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+
+		value := strings.TrimSpace(os.Getenv(name))
+		if value == "" {
+			return
+		}
+
+		if err := setField(val, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+
+	// RATE_LIMIT_<PACKAGE> sets the package's limit.
+	for _, pair := range os.Environ() {
+		name, value, _ := strings.Cut(pair, "=")
+
+		pkg, ok := strings.CutPrefix(name, "RATE_LIMIT_")
+		if !ok || pkg == "" || value == "" {
+			continue
+		}
+
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: has to be a number", name))
+			continue
+		}
+
+		if c.RateLimit.Packages == nil {
+			c.RateLimit.Packages = make(map[string]int)
+		}
+		c.RateLimit.Packages[strings.ToLower(pkg)] = limit
+	}
+
+	return errors.Join(errs...)
+}
+
+func setField(val reflect.Value, value string) error {
+	switch val.Interface().(type) {
+	case string:
+		val.SetString(value)
+
+	case int:
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("has to be a number")
+		}
+		val.SetInt(int64(num))
+
+	case bool:
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("has to be true or false")
+		}
+		val.SetBool(flag)
+
+	case Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("has to be a duration (e.g. 15m)")
+		}
+		val.SetInt(int64(d))
+
+	case []string:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		val.Set(reflect.ValueOf(list))
+
+	default:
+		return fmt.Errorf("unsupported type %s", val.Type())
+	}
+
+	return nil
+}
+
+// walkFields calls the fn for every exported field of the sections.
+func walkFields(section reflect.Value, fn func(field reflect.StructField, val reflect.Value)) {
+	typ := section.Type()
+
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeFor[Duration]() {
+			walkFields(section.Field(idx), fn)
+			continue
+		}
+
+		fn(field, section.Field(idx))
+	}
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	// The errors name the fields as the configuration file does.
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		return name
+	})
+
+	return v
+}
+
+// Validate checks the configuration, all the invalid settings are reported.
+func (c *Config) Validate() error {
+	err := validate.Struct(c)
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	messages := make([]string, 0, len(fieldErrs))
+	for _, fe := range fieldErrs {
+		_, path, _ := strings.Cut(fe.Namespace(), ".")
+
+		rule := fe.Tag()
+		if fe.Param() != "" {
+			rule += "=" + fe.Param()
+		}
+
+		messages = append(messages, fmt.Sprintf("%s: failed on %s", path, rule))
+	}
+
+	return fmt.Errorf("invalid configuration: %s", strings.Join(messages, ", "))
+}
+
+// Redacted returns a copy of the configuration with the secret values replaced, so that it can be served.
+func (c *Config) Redacted() *Config {
+	cfg := *c
+
+	walkFields(reflect.ValueOf(&cfg).Elem(), func(field reflect.StructField, val reflect.Value) {
+		if field.Tag.Get("secret") == "true" && val.String() != "" {
+			val.SetString(redacted)
+		}
+	})
+
+	return &cfg
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	t.Cleanup(func() { current.Store(nil) })
+
+	yamlFile := writeConfigFile(t, "swis.yaml", `
+server:
+  port: 8050
+auth:
+  root_token: file_token
+  lockout_duration: 5m
+rate_limit:
+  packages:
+    links: 10
+cors:
+  origins:
+    - https://swbro.vxn.dev
+`)
+
+	t.Setenv("CONFIG_FILE", yamlFile)
+	t.Setenv("SERVER_PORT", "9050")
+	t.Setenv("RATE_LIMIT", "100")
+	t.Setenv("RATE_LIMIT_DEPOTS", "5")
+	t.Setenv("CORS_ORIGINS", "")
+
+	// the environment overrides the file, the file overrides the defaults
+	cfg, err := Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 9050, cfg.Server.Port)
+	assert.Equal(t, "file_token", cfg.Auth.RootToken)
+	assert.Equal(t, Duration(5*time.Minute), cfg.Auth.LockoutDuration)
+	assert.Equal(t, 10, cfg.Auth.LockoutAttempts)
+	assert.Equal(t, 100, cfg.RateLimit.Default)
+	assert.Equal(t, map[string]int{"links": 10, "depots": 5}, cfg.RateLimit.Packages)
+	assert.Equal(t, []string{"https://swbro.vxn.dev"}, cfg.CORS.Origins)
+	assert.Equal(t, yamlFile, cfg.File())
+	assert.Equal(t, cfg, Current())
+
+	// the invalid configuration is refused, the current one is kept
+	t.Setenv("SERVER_PORT", "70000")
+
+	_, err = Load()
+	assert.ErrorContains(t, err, "server.port")
+	assert.Equal(t, cfg, Current())
+
+	// TOML is read the same way
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "swis.toml", `
+[auth]
+root_token = "toml_token"
+
+[mirror]
+peers = ["http://peer:8050"]
+`))
+	t.Setenv("SERVER_PORT", "")
+
+	cfg, err = Read()
+	assert.Nil(t, err)
+	assert.Equal(t, "toml_token", cfg.Auth.RootToken)
+	assert.Equal(t, []string{"http://peer:8050"}, cfg.Mirror.Peers)
+	assert.ErrorContains(t, cfg.Validate(), "server.port: failed on required")
+}
+
+func TestReadErrors(t *testing.T) {
+	// unknown settings are refused, so that the typos are noticed
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "swis.yaml", "server:\n  prot: 8050\n"))
+	_, err := Read()
+	assert.ErrorContains(t, err, "prot")
+
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "swis.ini", "port=8050"))
+	_, err = Read()
+	assert.ErrorContains(t, err, "unknown format")
+
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("AUTH_LOCKOUT_ATTEMPTS", "many")
+	_, err = Read()
+	assert.ErrorContains(t, err, "AUTH_LOCKOUT_ATTEMPTS")
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := defaults()
+	cfg.Auth.RootToken = "root_token"
+	cfg.Mirror.Token = "peer_token"
+
+	view := cfg.Redacted()
+	assert.Equal(t, redacted, view.Auth.RootToken)
+	assert.Equal(t, redacted, view.Mirror.Token)
+	assert.Equal(t, "", view.Secrets.Key)
+	assert.Equal(t, "root_token", cfg.Auth.RootToken)
+}
+
+func TestApplied(t *testing.T) {
+	defer func(base *Config) { started.Store(base) }(started.Load())
+
+	base := defaults()
+	base.Server.Port = 8050
+	base.Auth.RootToken = "root_token"
+	started.Store(base)
+
+	// the settings applied on start only are reported as started, the others as reloaded
+	cfg := defaults()
+	cfg.Server.Port = 8051
+	cfg.Auth.RootToken = "new_token"
+	cfg.Secrets.Key = "new_key"
+	cfg.Webhooks.AllowedNetworks = []string{"10.0.0.0/8"}
+
+	applied, pending := cfg.Applied()
+	assert.Equal(t, 8050, applied.Server.Port)
+	assert.Equal(t, "", applied.Secrets.Key)
+	assert.Equal(t, "new_token", applied.Auth.RootToken)
+	assert.Equal(t, []string{"10.0.0.0/8"}, applied.Webhooks.AllowedNetworks)
+	assert.ElementsMatch(t, []string{"server.port", "secrets.key"}, pending)
+
+	assert.Equal(t, 8051, cfg.Server.Port)
+}
@@ -2,25 +2,27 @@ package config
 
 import (
 	"net/http"
+	"slices"
 
 	gin "github.com/gin-gonic/gin"
 )
 
-// https://stackoverflow.com/a/71146788
-var origins map[string]bool = map[string]bool{
-	// examples
-	"http://swife-xp.vxn.su": true,
-	"https://swbro.vxn.dev":  true,
+// AllowedOrigin reports whether the origin is one of the cors.origins.
+func AllowedOrigin(origin string) bool {
+	return origin != "" && slices.Contains(Current().CORS.Origins, origin)
 }
 
+// CORSMiddleware allows the cross-origin requests of the cors.origins (CORS_ORIGINS), they are read per request, so
+// that they can be reloaded.
 // https://stackoverflow.com/a/29439630
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if origin := c.Request.Header.Get("Origin"); origins[origin] {
+		if origin := c.Request.Header.Get("Origin"); AllowedOrigin(origin) {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
 			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-			c.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, DELETE")
-			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Auth-Token")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Auth-Token, If-Match")
+			c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 			if c.Request.Method == "OPTIONS" {
 				c.AbortWithStatus(http.StatusNoContent)
@@ -2,72 +2,663 @@ package config
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	gin "github.com/gin-gonic/gin"
 )
 
+const (
+	// MirrorHeader marks the replicated requests by the origin instance's name, such requests are not replicated again.
+	MirrorHeader = "X-Mirror-Request"
+
+	// MirrorTimestampHeader and MirrorSignatureHeader authenticate the replicated requests by MIRROR_SECRET, see
+	// signMirrorRequest.
+	MirrorTimestampHeader = "X-Mirror-Timestamp"
+	MirrorSignatureHeader = "X-Mirror-Signature"
+
+	// ContextMirrored is the request context key holding the origin instance of a verified replicated request.
+	ContextMirrored = "mirroredFrom"
+
+	// contextMirrorAs is the request context key holding the request replicated in place of the handled one.
+	contextMirrorAs = "mirrorAs"
+)
+
+var (
+	// mirror is the replicator of the current configuration, see currentMirror.
+	mirror atomic.Pointer[mirrorState]
+
+	// mirrorMu serializes the replicator rebuilds.
+	mirrorMu sync.Mutex
+
+	// mirrorMaxSkew is the maximum age of a replicated request's signature (and the tolerated clock skew).
+	mirrorMaxSkew = 5 * time.Minute
+
+	// retryBackoff is the delay before the first retry of a failed delivery, it doubles with each retry.
+	retryBackoff = time.Second
+
+	// maxBackoff caps the delay between the retries.
+	maxBackoff = time.Minute
+)
+
+// mirrorSettings are the mirror section's settings the replicator is built by.
+type mirrorSettings struct {
+	instance string
+	token    string
+	secret   string
+
+	// peers are the base URLs of the peers, comma-separated.
+	peers string
+
+	retries   int
+	queueSize int
+}
+
+// mirrorState pairs the replicator (nil if the replication is disabled) with the settings it has been built by.
+type mirrorState struct {
+	settings   mirrorSettings
+	replicator *replicator
+}
+
+// replicator forwards the mutating requests to the peer instances.
+type replicator struct {
+	instance string
+	token    string
+	secret   string
+
+	// retries is the count of delivery attempts after the first one, queueSize the limit of pending requests
+	// per package and peer.
+	retries   int
+	queueSize int
+
+	client *http.Client
+	peers  []*peer
+}
+
+// mirrorRequest is a replicated request waiting for its delivery.
+type mirrorRequest struct {
+	method   string
+	uri      string
+	header   http.Header
+	body     []byte
+	queuedAt time.Time
+}
+
+// peer is a replication target, the requests are delivered in order per package (and thus per item), the packages
+// are delivered concurrently.
+type peer struct {
+	url string
+
+	mu     sync.Mutex
+	lanes  map[string]*lane
+	status PeerStatus
+
+	// stopped peers have been removed from the configuration, their lanes are closed.
+	stopped bool
+}
+
+type lane struct {
+	mu    sync.Mutex
+	queue []*mirrorRequest
+	wake  chan struct{}
+}
+
+// PeerStatus describes the replication to a single peer.
+type PeerStatus struct {
+	// URL is the base URL of the peer.
+	URL string `json:"url"`
+
+	// Queued is the count of requests waiting for their delivery.
+	Queued int `json:"queued"`
+
+	// Lag is the age of the oldest queued request in seconds.
+	Lag float64 `json:"lag_seconds"`
+
+	// Delivered, Retried and Failed count the requests delivered, the retried attempts and the requests given up.
+	Delivered uint64 `json:"delivered"`
+	Retried   uint64 `json:"retried"`
+	Failed    uint64 `json:"failed"`
+
+	LastDeliveredAt *time.Time `json:"last_delivered_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+}
+
+// readMirrorSettings reads the replication settings of such configuration.
+func readMirrorSettings(cfg *Config) mirrorSettings {
+	var urls []string
+	for _, url := range cfg.Mirror.Peers {
+		if url = strings.TrimSuffix(strings.TrimSpace(url), "/"); url != "" {
+			urls = append(urls, url)
+		}
+	}
+
+	settings := mirrorSettings{
+		instance:  cfg.App.Instance,
+		token:     cfg.Mirror.Token,
+		secret:    cfg.Mirror.Secret,
+		peers:     strings.Join(urls, ","),
+		retries:   cfg.Mirror.Retries,
+		queueSize: cfg.Mirror.QueueSize,
+	}
+
+	if settings.instance == "" {
+		settings.instance = "swis-api"
+	}
+
+	return settings
+}
+
+// currentMirror returns the replicator of the current configuration, it is rebuilt when the mirror settings change
+// (e.g. on SIGHUP). It returns nil when no peers are set.
+func currentMirror() *replicator {
+	settings := readMirrorSettings(Current())
+
+	if state := mirror.Load(); state != nil && state.settings == settings {
+		return state.replicator
+	}
+
+	mirrorMu.Lock()
+	defer mirrorMu.Unlock()
+
+	prev := mirror.Load()
+	if prev != nil && prev.settings == settings {
+		return prev.replicator
+	}
+
+	var prevReplicator *replicator
+	if prev != nil {
+		prevReplicator = prev.replicator
+	}
+
+	r := newReplicator(settings, prevReplicator)
+	mirror.Store(&mirrorState{settings: settings, replicator: r})
+
+	// The peers no longer configured (all of them, if the replication has been disabled) are delivered nothing more.
+	if prevReplicator != nil {
+		prevReplicator.stopRemoved(r)
+	}
+
+	return r
+}
+
+// stopRemoved stops the peers missing in the next replicator (nil when the replication is disabled).
+func (r *replicator) stopRemoved(next *replicator) {
+	kept := make(map[*peer]bool)
+	if next != nil {
+		for _, p := range next.peers {
+			kept[p] = true
+		}
+	}
+
+	for _, p := range r.peers {
+		if !kept[p] {
+			p.stop()
+		}
+	}
+}
+
+// activeMirror returns the replicator last built, without checking the configuration.
+func activeMirror() *replicator {
+	if state := mirror.Load(); state != nil {
+		return state.replicator
+	}
+
+	return nil
+}
+
+// newReplicator configures the replication by the mirror settings: the peers (base URLs), the secret signing the
+// requests, the token the requests are sent with, the retries and the queue size. The peers kept from the previous
+// replicator keep their queues and status. It returns nil when no peers (or no secret or token) are set.
+func newReplicator(settings mirrorSettings, prev *replicator) *replicator {
+	if settings.peers == "" {
+		return nil
+	}
+
+	if settings.secret == "" {
+		log.Print("mirror: MIRROR_SECRET not provided, the replication is disabled")
+		return nil
+	}
+
+	// The callers' credentials are not forwarded, they may be refused by the peers (e.g. the expired JWTs).
+	if settings.token == "" {
+		log.Print("mirror: MIRROR_TOKEN not provided, the replication is disabled")
+		return nil
+	}
+
+	r := &replicator{
+		instance:  settings.instance,
+		token:     settings.token,
+		secret:    settings.secret,
+		retries:   settings.retries,
+		queueSize: settings.queueSize,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+
+	kept := make(map[string]*peer)
+	if prev != nil {
+		for _, p := range prev.peers {
+			kept[p.url] = p
+		}
+	}
+
+	for _, url := range strings.Split(settings.peers, ",") {
+		if p, ok := kept[url]; ok {
+			r.peers = append(r.peers, p)
+			continue
+		}
+
+		r.peers = append(r.peers, &peer{url: url, lanes: make(map[string]*lane), status: PeerStatus{URL: url}})
+	}
+
+	return r
+}
+
+// MirrorMiddleware replicates the successful mutating requests to the peers set by MIRROR_PEERS. The requests are
+// queued and forwarded asynchronously. The replicated ones (marked by MirrorHeader) have to be signed by
+// MIRROR_SECRET, they are not forwarded again. The peers are read from the current configuration, so the reloaded
+// settings apply at once.
 func MirrorMiddleware() gin.HandlerFunc {
+	currentMirror()
+
 	return func(ctx *gin.Context) {
-		// do not replicate GET requests
-		if ctx.Request.Method == "GET" || ctx.Request.Method == "OPTIONS" {
+		r := currentMirror()
+		origin := ctx.Request.Header.Get(MirrorHeader)
+
+		if r == nil && origin == "" {
 			ctx.Next()
 			return
 		}
 
-		// do not replicate already replicated API call
-		if ctx.Request.Header.Get("X-Mirror-Request") != "" {
-			/*ctx.AbortWithStatusJSON(http.StatusNoContent, gin.H{
-				"code":    http.StatusNoContent,
-				"message": "dropping already replicated API call",
-			})*/
+		switch ctx.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
 			ctx.Next()
 			return
 		}
 
-		// we need to buffer the body if we want to read it here and send it
-		// in the request.
+		// The body is buffered to be verified or sent again.
 		body, err := io.ReadAll(ctx.Request.Body)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-				"code":    http.StatusInternalServerError,
-				"message": fmt.Sprintf("cannot replicate request body: %s", err.Error()),
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"code":    http.StatusBadRequest,
+				"message": fmt.Sprintf("cannot read request body: %s", err.Error()),
 			})
 			return
 		}
-
-		// you can reassign the body if you need to parse it as multipart
 		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
 
-		// create a new url from the raw RequestURI sent by the client
-		proxyScheme := "http"
-		proxyHost := "localhost:8052"
-		url := fmt.Sprintf("%s://%s%s", proxyScheme, proxyHost, ctx.Request.RequestURI)
+		if origin != "" {
+			if err := verifyMirrorRequest(ctx.Request, body, Current().Mirror.Secret); err != nil {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"code":    http.StatusForbidden,
+					"message": fmt.Sprintf("invalid replicated request: %s", err.Error()),
+				})
+				return
+			}
 
-		newReq, err := http.NewRequest(ctx.Request.Method, url, bytes.NewReader(body))
+			ctx.Set(ContextMirrored, origin)
+			ctx.Next()
+			return
+		}
 
-		// We may want to filter some headers, otherwise we could just use a shallow copy
-		newReq.Header = ctx.Request.Header
-		/*newReq.Header = make(http.Header)
-		for h, val := range ctx.Request.Header {
-			newReq.Header.Set(h, val)
-		}*/
-		newReq.Header.Set("X-Mirror-Request", os.Getenv("HOSTNAME"))
+		ctx.Next()
 
-		client := http.Client{}
-		resp, err := client.Do(newReq)
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
-				"code":    http.StatusBadGateway,
-				"message": fmt.Sprintf("cannot reach linked instance: %s", err.Error()),
-			})
+		// Failed requests changed nothing.
+		if status := ctx.Writer.Status(); status < 200 || status >= 300 {
 			return
 		}
-		defer resp.Body.Close()
 
-		ctx.Next()
+		mreq := &mirrorRequest{
+			method: ctx.Request.Method,
+			uri:    ctx.Request.URL.RequestURI(),
+			body:   body,
+		}
+
+		if value, ok := ctx.Get(contextMirrorAs); ok {
+			mreq = value.(*mirrorRequest)
+		}
+
+		r.enqueue(ctx.Request, mreq)
 	}
 }
+
+// MirrorAs replicates such JSON request in place of the handled one, e.g. to store the item the handler generated
+// (like a token) on the peers instead of having them generate their own.
+func MirrorAs(ctx *gin.Context, method, uri string, body []byte) {
+	ctx.Set(contextMirrorAs, &mirrorRequest{
+		method: method,
+		uri:    uri,
+		header: http.Header{"Content-Type": []string{"application/json"}},
+		body:   body,
+	})
+}
+
+// IsMirrored reports whether the request has been replicated by a peer (and verified).
+func IsMirrored(ctx *gin.Context) bool {
+	_, ok := ctx.Get(ContextMirrored)
+	return ok
+}
+
+// signMirrorRequest returns the hex-encoded HMAC-SHA256 of the replicated request by such secret: the origin
+// instance, the method, the URI, the timestamp (Unix seconds) and the body.
+func signMirrorRequest(secret, instance, method, uri, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n", instance, method, uri, timestamp)
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyMirrorRequest checks the replicated request's signature and its age.
+func verifyMirrorRequest(req *http.Request, body []byte, secret string) error {
+	if secret == "" {
+		return errors.New("MIRROR_SECRET not set, the replicated requests are not accepted")
+	}
+
+	timestamp := req.Header.Get(MirrorTimestampHeader)
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid timestamp")
+	}
+
+	if age := time.Since(time.Unix(unix, 0)); age > mirrorMaxSkew || age < -mirrorMaxSkew {
+		return errors.New("expired timestamp")
+	}
+
+	expected := signMirrorRequest(secret, req.Header.Get(MirrorHeader), req.Method, req.URL.RequestURI(), timestamp, body)
+
+	if !hmac.Equal([]byte(expected), []byte(req.Header.Get(MirrorSignatureHeader))) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+// enqueue queues the replicated request to all the peers, the request's content type (unless given) is taken from
+// the handled one. The requests are sent with MIRROR_TOKEN.
+func (r *replicator) enqueue(req *http.Request, mreq *mirrorRequest) {
+	header := make(http.Header)
+
+	// The revisions differ among the instances, so the conditional headers are not forwarded.
+	if value := req.Header.Get("Content-Type"); value != "" {
+		header.Set("Content-Type", value)
+	}
+
+	for name, values := range mreq.header {
+		header[name] = values
+	}
+
+	header.Set("X-Auth-Token", r.token)
+
+	header.Set(MirrorHeader, r.instance)
+
+	mreq = &mirrorRequest{
+		method:   mreq.method,
+		uri:      mreq.uri,
+		header:   header,
+		body:     mreq.body,
+		queuedAt: time.Now(),
+	}
+
+	path, _, _ := strings.Cut(mreq.uri, "?")
+	pkg := strings.Split(strings.TrimPrefix(path, "/"), "/")[0]
+
+	for _, p := range r.peers {
+		r.push(p, pkg, mreq)
+	}
+}
+
+// push queues the request to the package's lane of the peer, the lane's worker is started on the first use. The
+// peer's lock is held until the worker is woken, so that the lane is not closed meanwhile.
+func (r *replicator) push(p *peer, pkg string, req *mirrorRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		p.drop(req, errors.New("peer removed from the configuration"))
+		return
+	}
+
+	l, ok := p.lanes[pkg]
+	if !ok {
+		l = &lane{wake: make(chan struct{}, 1)}
+		p.lanes[pkg] = l
+		go work(p, l)
+	}
+
+	l.mu.Lock()
+	if len(l.queue) >= r.queueSize {
+		l.mu.Unlock()
+		p.drop(req, fmt.Errorf("queue of '%s' full", pkg))
+		return
+	}
+	l.queue = append(l.queue, req)
+	l.mu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// work delivers the lane's requests one by one, so that their order is kept. The requests are sent by the current
+// replicator, they are dropped if the replication has been disabled (or the peer removed) meanwhile. The worker
+// stops once the peer is stopped, the requests left are dropped.
+func work(p *peer, l *lane) {
+	for range l.wake {
+		for {
+			req := l.next()
+			if req == nil {
+				break
+			}
+
+			if r := activeMirror(); r != nil && !p.isStopped() {
+				r.deliver(p, req)
+			} else {
+				p.mu.Lock()
+				p.drop(req, errors.New("replication disabled or peer removed"))
+				p.mu.Unlock()
+			}
+
+			l.pop()
+		}
+	}
+
+	for req := l.next(); req != nil; req = l.next() {
+		p.mu.Lock()
+		p.drop(req, errors.New("peer removed from the configuration"))
+		p.mu.Unlock()
+
+		l.pop()
+	}
+}
+
+// next returns the lane's first request, nil if there is none.
+func (l *lane) next() *mirrorRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.queue) == 0 {
+		return nil
+	}
+
+	return l.queue[0]
+}
+
+// pop removes the lane's first request once it has been handled.
+func (l *lane) pop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.queue[0] = nil
+	l.queue = l.queue[1:]
+}
+
+// stop closes the peer's lanes, their workers drop the requests left.
+func (p *peer) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return
+	}
+
+	p.stopped = true
+	for _, l := range p.lanes {
+		close(l.wake)
+	}
+}
+
+func (p *peer) isStopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stopped
+}
+
+// deliver sends the request to the peer, the failures are retried with a backoff unless the peer refuses the request.
+func (r *replicator) deliver(p *peer, req *mirrorRequest) {
+	backoff := retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		retry, err := r.send(p, req)
+		if err == nil {
+			p.record(true, nil)
+			return
+		}
+
+		if !retry || attempt >= r.retries {
+			p.record(false, err)
+			log.Printf("mirror: giving up %s %s to %s: %s", req.method, req.uri, p.url, err.Error())
+			return
+		}
+
+		// The removed peers are not retried.
+		if p.isStopped() {
+			p.mu.Lock()
+			p.drop(req, err)
+			p.mu.Unlock()
+			return
+		}
+
+		p.mu.Lock()
+		p.status.Retried++
+		p.status.LastError = err.Error()
+		now := time.Now()
+		p.status.LastErrorAt = &now
+		p.mu.Unlock()
+
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// send makes a single delivery attempt, it reports whether a failure is worth a retry.
+func (r *replicator) send(p *peer, req *mirrorRequest) (bool, error) {
+	hreq, err := http.NewRequest(req.method, p.url+req.uri, bytes.NewReader(req.body))
+	if err != nil {
+		return false, err
+	}
+	hreq.Header = req.header.Clone()
+
+	// The request is signed on each attempt, so that the retried ones do not expire.
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	hreq.Header.Set(MirrorTimestampHeader, timestamp)
+	hreq.Header.Set(MirrorSignatureHeader, signMirrorRequest(r.secret, req.header.Get(MirrorHeader), req.method, req.uri, timestamp, req.body))
+
+	resp, err := r.client.Do(hreq)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("%s %s: %s", req.method, req.uri, resp.Status)
+	}
+
+	return false, fmt.Errorf("%s %s refused: %s", req.method, req.uri, resp.Status)
+}
+
+func (p *peer) record(delivered bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	if delivered {
+		p.status.Delivered++
+		p.status.LastDeliveredAt = &now
+		return
+	}
+
+	p.fail(err)
+}
+
+// drop gives up the undelivered request, the lock has to be held by the caller.
+func (p *peer) drop(req *mirrorRequest, err error) {
+	err = fmt.Errorf("dropping %s %s: %w", req.method, req.uri, err)
+	log.Printf("mirror: %s to %s", err.Error(), p.url)
+
+	p.fail(err)
+}
+
+// fail counts the failed request, the lock has to be held by the caller.
+func (p *peer) fail(err error) {
+	now := time.Now()
+
+	p.status.Failed++
+	p.status.LastError = err.Error()
+	p.status.LastErrorAt = &now
+}
+
+// ReplicationStatus returns the instance name and the status of all the peers, ok is false if the replication is
+// not configured.
+func ReplicationStatus() (instance string, peers []PeerStatus, ok bool) {
+	r := currentMirror()
+	if r == nil {
+		return "", nil, false
+	}
+
+	now := time.Now()
+	peers = make([]PeerStatus, 0, len(r.peers))
+
+	for _, p := range r.peers {
+		p.mu.Lock()
+		status := p.status
+		lanes := make([]*lane, 0, len(p.lanes))
+		for _, l := range p.lanes {
+			lanes = append(lanes, l)
+		}
+		p.mu.Unlock()
+
+		for _, l := range lanes {
+			l.mu.Lock()
+			status.Queued += len(l.queue)
+			if len(l.queue) > 0 {
+				status.Lag = max(status.Lag, now.Sub(l.queue[0].queuedAt).Seconds())
+			}
+			l.mu.Unlock()
+		}
+
+		peers = append(peers, status)
+	}
+
+	return r.instance, peers, true
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorMiddleware(t *testing.T) {
+	retryBackoff = time.Millisecond
+
+	var (
+		mu        sync.Mutex
+		received  []string
+		attempts  int
+		forwarded bool
+	)
+
+	// the peer fails twice first, and refuses the /refused path
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if attempts++; attempts <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.URL.Path == "/things/refused" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		// the peer verifies the signature
+		if err := verifyMirrorRequest(r, body, "mirror_secret"); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		received = append(received, r.Method+" "+r.URL.Path+" "+string(body)+" "+r.Header.Get(MirrorHeader)+" "+r.Header.Get("X-Auth-Token"))
+		forwarded = forwarded || r.Header.Get("Authorization") != ""
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer peer.Close()
+
+	t.Setenv("MIRROR_PEERS", peer.URL+"/, ")
+	t.Setenv("MIRROR_TOKEN", "peer_token")
+	t.Setenv("MIRROR_SECRET", "mirror_secret")
+	t.Setenv("HOSTNAME", "primary")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(MirrorMiddleware())
+
+	r.Any("/things/:key", func(ctx *gin.Context) {
+		body, _ := io.ReadAll(ctx.Request.Body)
+
+		switch ctx.Param("key") {
+		case "invalid":
+			ctx.String(http.StatusBadRequest, string(body))
+			return
+
+		case "generated":
+			// the generated item is replicated in place of the request
+			MirrorAs(ctx, http.MethodPut, "/things/generated", []byte("6"))
+		}
+
+		if ctx.Request.Header.Get(MirrorHeader) != "" && !IsMirrored(ctx) {
+			ctx.String(http.StatusInternalServerError, "not verified")
+			return
+		}
+
+		ctx.String(http.StatusOK, string(body))
+	})
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	expired := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	for _, tc := range []struct {
+		method, path, body string
+		mirrored           string
+		secret, timestamp  string
+		code               int
+	}{
+		{"POST", "/things/a", "1", "", "", "", http.StatusOK},
+		{"GET", "/things/a", "", "", "", "", http.StatusOK},
+		{"POST", "/things/invalid", "2", "", "", "", http.StatusBadRequest},
+		{"PUT", "/things/b", "3", "other", "mirror_secret", now, http.StatusOK},
+		{"PUT", "/things/c", "3", "other", "", "", http.StatusForbidden},
+		{"PUT", "/things/c", "3", "other", "wrong_secret", now, http.StatusForbidden},
+		{"PUT", "/things/c", "3", "other", "mirror_secret", expired, http.StatusForbidden},
+		{"PUT", "/things/a", "4", "", "", "", http.StatusOK},
+		{"POST", "/things/refused", "5", "", "", "", http.StatusOK},
+		{"DELETE", "/things/a", "", "", "", "", http.StatusOK},
+		{"POST", "/things/generated", "", "", "", "", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("X-Auth-Token", "user_token")
+		req.Header.Set("Authorization", "Bearer user_jwt")
+		if tc.mirrored != "" {
+			req.Header.Set(MirrorHeader, tc.mirrored)
+		}
+		if tc.secret != "" {
+			req.Header.Set(MirrorTimestampHeader, tc.timestamp)
+			req.Header.Set(MirrorSignatureHeader, signMirrorRequest(tc.secret, tc.mirrored, tc.method, tc.path, tc.timestamp, []byte(tc.body)))
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, tc.method+" "+tc.path)
+
+		// the handler still gets the body
+		if tc.code != http.StatusForbidden {
+			assert.Equal(t, tc.body, w.Body.String())
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		_, peers, _ := ReplicationStatus()
+		return peers[0].Queued == 0 && peers[0].Delivered == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, []string{
+		"POST /things/a 1 primary peer_token",
+		"PUT /things/a 4 primary peer_token",
+		"DELETE /things/a  primary peer_token",
+		"PUT /things/generated 6 primary peer_token",
+	}, received)
+
+	// the callers' credentials are not forwarded
+	assert.False(t, forwarded)
+	mu.Unlock()
+
+	instance, peers, ok := ReplicationStatus()
+	assert.True(t, ok)
+	assert.Equal(t, "primary", instance)
+
+	if assert.Len(t, peers, 1) {
+		assert.Equal(t, peer.URL, peers[0].URL)
+		assert.Equal(t, uint64(2), peers[0].Retried)
+		assert.Equal(t, uint64(1), peers[0].Failed)
+		assert.Contains(t, peers[0].LastError, "400 Bad Request")
+	}
+
+	// the reloaded peers apply at once, the kept ones keep their status
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer other.Close()
+
+	t.Setenv("MIRROR_PEERS", peer.URL+","+other.URL)
+
+	req, _ := http.NewRequest("PUT", "/things/d", strings.NewReader("7"))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Eventually(t, func() bool {
+		_, peers, _ := ReplicationStatus()
+		return len(peers) == 2 && peers[0].Delivered == 5 && peers[1].Delivered == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// no replication without the secret, nor without the token
+	t.Setenv("MIRROR_SECRET", "")
+
+	_, _, ok = ReplicationStatus()
+	assert.False(t, ok)
+
+	t.Setenv("MIRROR_SECRET", "mirror_secret")
+	t.Setenv("MIRROR_TOKEN", "")
+
+	_, _, ok = ReplicationStatus()
+	assert.False(t, ok)
+}
+
+func TestMirrorRemovedPeer(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	// the peer holds the first request until it is removed from the configuration
+	removed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.URL.Path)
+		first := len(received) == 1
+		mu.Unlock()
+
+		if first {
+			close(started)
+			<-release
+		}
+	}))
+	defer removed.Close()
+
+	t.Setenv("MIRROR_PEERS", removed.URL)
+	t.Setenv("MIRROR_TOKEN", "peer_token")
+	t.Setenv("MIRROR_SECRET", "mirror_secret")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(MirrorMiddleware())
+
+	r.PUT("/things/:key", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ok")
+	})
+
+	for _, path := range []string{"/things/a", "/things/b"} {
+		req, _ := http.NewRequest("PUT", path, strings.NewReader("1"))
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	<-started
+	p := activeMirror().peers[0]
+
+	// the queued requests are dropped and counted, they are not delivered to the removed peer
+	t.Setenv("MIRROR_PEERS", "http://localhost:9")
+	currentMirror()
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.status.Delivered == 1 && p.status.Failed == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, []string{"/things/a"}, received)
+	mu.Unlock()
+
+	p.mu.Lock()
+	assert.True(t, p.stopped)
+	assert.Contains(t, p.status.LastError, "dropping PUT /things/b")
+	p.mu.Unlock()
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveVersion is the format version of the full-instance export archive.
+const ArchiveVersion = 1
+
+// Archive is a full-instance export of all persistent caches.
+type Archive struct {
+	// Version of the archive format.
+	Version int `json:"version"`
+
+	// CreatedAt is the time of the export.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Caches holds the raw items of every exported cache by its full name (e.g. dish/sockets).
+	Caches map[string]map[string]json.RawMessage `json:"caches"`
+}
+
+// ImportReport describes the import result of a single package.
+type ImportReport struct {
+	// Count is the number of imported items per cache.
+	Count map[string]int `json:"count"`
+
+	// Failures is the list of items (or caches) that could not be imported.
+	Failures []string `json:"failures"`
+}
+
+// archivedCacheNames returns the sorted names of all registered caches to be archived.
+func archivedCacheNames() []string {
+	var names []string
+
+	for name, cache := range registry {
+		if !cache.Persistent() {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// WriteArchive streams the archive of all persistent caches to w, one cache at a time.
+func WriteArchive(w io.Writer) error {
+	header := fmt.Sprintf("{\n\"version\": %d,\n\"created_at\": \"%s\",\n\"caches\": {", ArchiveVersion, time.Now().Format(time.RFC3339Nano))
+
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	for idx, name := range archivedCacheNames() {
+		recs, err := registry[name].records()
+		if err != nil {
+			return fmt.Errorf("cannot encode '%s' cache: %w", name, err)
+		}
+
+		items := make(map[string]json.RawMessage, len(recs))
+		for _, rec := range recs {
+			items[rec.Key] = rec.Value
+		}
+
+		data, err := json.Marshal(items)
+		if err != nil {
+			return fmt.Errorf("cannot encode '%s' cache: %w", name, err)
+		}
+
+		sep := ","
+		if idx == 0 {
+			sep = ""
+		}
+
+		if _, err := fmt.Fprintf(w, "%s\n%q: %s", sep, name, data); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "\n}\n}\n")
+	return err
+}
+
+// ImportArchive replaces the contents of all caches present in the archive. All items are decoded and validated
+// first, nothing is changed if any of them (or any cache) fails. The caches are then replaced with all of them locked,
+// a failed write rolls back the caches replaced so far, so the import is all-or-nothing. The report is keyed by
+// package name.
+func ImportArchive(ctx context.Context, archive *Archive) (map[string]*ImportReport, bool) {
+	reports := make(map[string]*ImportReport)
+	failed := false
+
+	var loads []*stagedLoad
+
+	report := func(cacheName string) *ImportReport {
+		pkgName := strings.Split(cacheName, "/")[0]
+
+		if _, ok := reports[pkgName]; !ok {
+			reports[pkgName] = &ImportReport{Count: make(map[string]int), Failures: []string{}}
+		}
+		return reports[pkgName]
+	}
+
+	if archive.Version != ArchiveVersion {
+		reports["archive"] = &ImportReport{
+			Failures: []string{fmt.Sprintf("unsupported archive version %d (expected %d)", archive.Version, ArchiveVersion)},
+		}
+		return reports, false
+	}
+
+	for name, rawItems := range archive.Caches {
+		rep := report(name)
+
+		cache, ok := registry[name]
+		if !ok || !cache.Persistent() {
+			rep.Failures = append(rep.Failures, fmt.Sprintf("%s: unknown cache", name))
+			failed = true
+			continue
+		}
+
+		load, failures := cache.prepareLoad(ctx, rawItems, true, true)
+		if len(failures) > 0 {
+			rep.Failures = append(rep.Failures, failures...)
+			failed = true
+			continue
+		}
+
+		loads = append(loads, load)
+	}
+
+	if failed {
+		return reports, false
+	}
+
+	counts, err := storeAll(ctx, loads)
+
+	for idx, load := range loads {
+		report(load.cache).Count[load.cache] = counts[idx]
+	}
+
+	if err != nil {
+		reports["archive"] = &ImportReport{
+			Failures: []string{fmt.Sprintf("import rolled back: %s", err.Error())},
+		}
+		return reports, false
+	}
+
+	return reports, true
+}
@@ -1,58 +1,560 @@
 package core
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ContextUserName is the request context key holding the name of the authenticated user.
+	ContextUserName = "userName"
+
+	// ContextUserRoles is the request context key holding the authenticated user's role names.
+	ContextUserRoles = "userRoles"
+)
+
+var (
+	// ErrItemNotFound is returned by conditional cache operations when there is no item under such key.
+	ErrItemNotFound = errors.New("item not found")
+
+	// ErrRevisionMismatch is returned by conditional cache operations when the item has been changed meanwhile.
+	ErrRevisionMismatch = errors.New("item revision mismatch")
 )
 
+// CacheInterface is the type-agnostic view of a typed cache used by the package mounting, persistence and archives.
 type CacheInterface interface {
-	Get(string)
-	GetAll()
-	Set(string, interface{})
-	Delete(string)
+	// CacheName returns the full name of the cache (e.g. dish/sockets).
+	CacheName() string
+
+	// Persistent tells whether the cache is written to the WAL and the persistence log.
+	Persistent() bool
+
+	setup(name string) error
+	records() ([]storeRecord, error)
+	compactStore() error
+	apply(op, key string, raw json.RawMessage, rev uint64) error
+	applyChange(ctx context.Context, op, key string, raw json.RawMessage) error
+	prepareLoad(ctx context.Context, raw map[string]json.RawMessage, replace, validate bool) (*stagedLoad, []string)
+	indexFields(fields []string) error
+	ownerField(field string) error
+	secrets(key string) (map[string]string, error)
+	viewRaw(ctx *gin.Context, raw json.RawMessage) (json.RawMessage, bool)
+	viewAny(ctx *gin.Context, item any) any
+	owned(user string) map[string]any
+	disown(ctx context.Context, user, replacement string) (int, error)
+	modelType() reflect.Type
+}
+
+// Cache is a concurrent-safe map of items of a single type. The zero value is ready to use.
+type Cache[T any] struct {
+	// Name is the full name of the cache, it is set when the owning package is mounted.
+	Name string
+
+	// Volatile caches are neither logged to the WAL nor persisted (e.g. runtime stats).
+	Volatile bool
+
+	mu    sync.RWMutex
+	items map[string]entry[T]
+
+	// seq is the last revision issued, revisions are unique and increasing within the cache (also across restarts).
+	seq uint64
+
+	// store is the optional on-disk log the cache writes through to.
+	store *store
+
+	// indexes maps the indexed fields' JSON names to their indexes.
+	indexes map[string]*index
+
+	// owner is the reflect index of the field holding the item's owner name, see SetOwnerField.
+	owner []int
+
+	// ownerFunc derives the item's owners when there is no owner field, see SetOwnerFunc.
+	ownerFunc func(item T) []string
+
+	// view adapts the items served to a request, see SetView.
+	view func(ctx *gin.Context, item T) T
+
+	// guard checks the items the generic handlers are to save, see SetGuard.
+	guard func(ctx *gin.Context, item T) (T, error)
+}
+
+// entry is a cached item with its revision.
+type entry[T any] struct {
+	value    T
+	revision uint64
+}
+
+func (c *Cache[T]) CacheName() string {
+	return c.Name
+}
+
+func (c *Cache[T]) Persistent() bool {
+	return !c.Volatile
+}
+
+// modelType returns the type of the cached items.
+func (c *Cache[T]) modelType() reflect.Type {
+	return reflect.TypeFor[T]()
+}
+
+func (c *Cache[T]) Get(key string) (T, bool) {
+	item, _, ok := c.GetRevision(key)
+	return item, ok
+}
+
+// GetRevision returns the item together with its current revision.
+func (c *Cache[T]) GetRevision(key string) (T, uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.items[key]
+	return e.value, e.revision, ok
+}
+
+func (c *Cache[T]) GetAll() (map[string]T, int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var values = make(map[string]T, len(c.items))
+
+	for key, e := range c.items {
+		values[key] = e.value
+	}
+
+	return values, len(values)
+}
+
+func (c *Cache[T]) Set(key string, value T) bool {
+	return c.SetContext(context.Background(), key, value)
+}
+
+// SetContext stores the value, the user is taken from the (request) context for the write-ahead log.
+func (c *Cache[T]) SetContext(ctx context.Context, key string, value T) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.put(ctx, key, value)
+	return err == nil
+}
+
+func (c *Cache[T]) Delete(key string) bool {
+	return c.DeleteContext(context.Background(), key)
 }
 
-type Cache struct {
-	Name    string
-	syncMap sync.Map
+// DeleteContext removes the value, the user is taken from the (request) context for the write-ahead log.
+func (c *Cache[T]) DeleteContext(ctx context.Context, key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.drop(ctx, key) == nil
+}
+
+// LoadOrStore returns the existing value for the key (loaded is true), otherwise it stores and returns the given value.
+// The check and the store are atomic, so only one of concurrent callers can store a new key.
+func (c *Cache[T]) LoadOrStore(ctx context.Context, key string, value T) (actual T, loaded bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		return e.value, true, nil
+	}
+
+	if _, err := c.put(ctx, key, value); err != nil {
+		return value, false, err
+	}
+
+	return value, false, nil
+}
+
+// CompareAndSwap stores the new value only if the current one is deeply equal to old.
+func (c *Cache[T]) CompareAndSwap(ctx context.Context, key string, old, new T) (swapped bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok || !reflect.DeepEqual(e.value, old) {
+		return false, nil
+	}
+
+	if _, err := c.put(ctx, key, new); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetIfRevision stores the value only if the item exists in such revision. It returns the new revision.
+func (c *Cache[T]) SetIfRevision(ctx context.Context, key string, value T, rev uint64) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkRevision(key, rev); err != nil {
+		return 0, err
+	}
+
+	return c.put(ctx, key, value)
+}
+
+// DeleteIfRevision removes the item only if it exists in such revision.
+func (c *Cache[T]) DeleteIfRevision(ctx context.Context, key string, rev uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkRevision(key, rev); err != nil {
+		return err
+	}
+
+	return c.drop(ctx, key)
 }
 
-func (c *Cache) Get(key string) (interface{}, bool) {
-	rawVal, ok := c.syncMap.Load(key)
+// Update atomically applies fn to the existing item and stores the result. It returns the stored item and its new
+// revision. The fn is called with the cache locked, so it must not access the cache itself.
+func (c *Cache[T]) Update(ctx context.Context, key string, fn func(item T) T) (T, uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
 	if !ok {
-		return nil, false
+		return e.value, 0, ErrItemNotFound
+	}
+
+	item := fn(e.value)
+
+	rev, err := c.put(ctx, key, item)
+	return item, rev, err
+}
+
+// nextRevision returns a new revision based on the current time, so that revisions of deleted items are not reused
+// after a restart. The lock has to be held by the caller.
+func (c *Cache[T]) nextRevision() uint64 {
+	rev := uint64(time.Now().UnixNano())
+	if rev <= c.seq {
+		rev = c.seq + 1
 	}
 
-	return rawVal, true
+	return rev
 }
 
-func (c *Cache) GetAll() (map[string]interface{}, int) {
-	var values = make(map[string]interface{})
-	var counter int = 0
+// checkRevision compares the item's revision, the lock has to be held by the caller.
+func (c *Cache[T]) checkRevision(key string, rev uint64) error {
+	e, ok := c.items[key]
+	if !ok {
+		return ErrItemNotFound
+	}
 
-	c.syncMap.Range(func(rawKey, rawVal interface{}) bool {
-		k, ok := rawKey.(string)
-		//v, ok := rawVal.(T)
+	if e.revision != rev {
+		return ErrRevisionMismatch
+	}
 
-		if !ok {
-			return false
+	return nil
+}
+
+// put logs and saves the value under a new revision, the lock has to be held by the caller.
+func (c *Cache[T]) put(ctx context.Context, key string, value T) (uint64, error) {
+	rev := c.nextRevision()
+
+	if c.Persistent() && (c.store != nil || walLog != nil) {
+		data, err := json.Marshal(value)
+		if err != nil {
+			err = fmt.Errorf("cache %s: cannot encode item '%s': %w", c.Name, key, err)
+			log.Print(err)
+			return 0, err
 		}
 
-		values[k] = rawVal
-		counter++
-		return true
-	})
+		if err := c.log(ctx, opSet, key, data, rev); err != nil {
+			return 0, err
+		}
+	}
+
+	var before *T
+	if e, ok := c.items[key]; ok {
+		before = &e.value
+	}
+
+	c.seq = rev
+	c.setItem(key, entry[T]{value: value, revision: rev})
+	c.notifyChange(ctx, opSet, key, before, &value, rev)
+	return rev, nil
+}
+
+// drop logs and removes the item, the lock has to be held by the caller. The missing items are not logged.
+func (c *Cache[T]) drop(ctx context.Context, key string) error {
+	e, ok := c.items[key]
+	if !ok {
+		return ErrItemNotFound
+	}
+
+	if err := c.log(ctx, opDelete, key, nil, 0); err != nil {
+		return err
+	}
+
+	c.removeItem(key)
+	c.notifyChange(ctx, opDelete, key, &e.value, nil, 0)
+	return nil
+}
+
+// log writes the operation to the write-ahead log and to the cache's store, if enabled.
+func (c *Cache[T]) log(ctx context.Context, op, key string, data json.RawMessage, rev uint64) error {
+	if !c.Persistent() {
+		return nil
+	}
+
+	if walLog != nil {
+		user, _ := ctx.Value(ContextUserName).(string)
+
+		rec := WALRecord{
+			Timestamp: time.Now(),
+			User:      user,
+			Package:   strings.Split(c.Name, "/")[0],
+			Cache:     c.Name,
+			Op:        op,
+			Key:       key,
+			Revision:  rev,
+			Value:     data,
+		}
+
+		if err := walLog.append(rec); err != nil {
+			err = fmt.Errorf("cache %s: cannot write '%s' of '%s' to WAL: %w", c.Name, op, key, err)
+			log.Print(err)
+			return err
+		}
+	}
+
+	if c.store != nil {
+		if err := c.store.append(storeRecord{Op: op, Key: key, Revision: rev, Value: data}); err != nil {
+			err = fmt.Errorf("cache %s: cannot persist '%s' of '%s': %w", c.Name, op, key, err)
+			log.Print(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setup names the cache and loads its persisted items, if the persistence is enabled.
+func (c *Cache[T]) setup(name string) error {
+	c.Name = name
+
+	if !c.Persistent() || persistenceDir == "" {
+		return nil
+	}
+
+	return c.attachStore(persistenceDir)
+}
+
+// records returns all items JSON-encoded as set records.
+func (c *Cache[T]) records() ([]storeRecord, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.collectRecords()
+}
+
+// collectRecords returns the set records of all the items, the lock has to be held by the caller.
+func (c *Cache[T]) collectRecords() ([]storeRecord, error) {
+	recs := make([]storeRecord, 0, len(c.items))
+
+	for key, e := range c.items {
+		data, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode item '%s': %w", key, err)
+		}
+		recs = append(recs, storeRecord{Op: opSet, Key: key, Revision: e.revision, Value: data})
+	}
+
+	return recs, nil
+}
+
+// apply changes the cache contents without logging the operation (used by the WAL replay). Records written before
+// the revisions were introduced get a new one.
+func (c *Cache[T]) apply(op, key string, raw json.RawMessage, rev uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch op {
+	case opSet:
+		var item T
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+
+		if rev == 0 {
+			rev = c.nextRevision()
+		}
+
+		if rev > c.seq {
+			c.seq = rev
+		}
+
+		c.setItem(key, entry[T]{value: item, revision: rev})
+
+	case opDelete:
+		c.removeItem(key)
+	}
+
+	return nil
+}
+
+// stagedLoad holds the decoded items of a cache to be stored, see prepareLoad and storeAll.
+type stagedLoad struct {
+	cache string
+
+	lock, unlock func()
 
-	return values, counter
+	// store saves the items, restore brings back the items held before. The lock has to be held for both.
+	store   func(ctx context.Context) (int, error)
+	restore func(ctx context.Context) error
 }
 
-func (c *Cache) Set(key string, value interface{}) bool {
-	c.syncMap.Store(key, value)
+// prepareLoad decodes all the raw items first, when validate is set they are checked as the new items are (see
+// DecodeItem, the request's guard applies as well). If all of them are valid, the returned load stores them (and
+// drops all other items when replace is set), otherwise the failures are listed. Items with blank keys are skipped.
+func (c *Cache[T]) prepareLoad(ctx context.Context, raw map[string]json.RawMessage, replace, validate bool) (*stagedLoad, []string) {
+	var failures []string
 
-	return true
+	items := make(map[string]T, len(raw))
+
+	for key, data := range raw {
+		if key == "" {
+			continue
+		}
+
+		var item T
+		var err error
+
+		if validate {
+			item, err = DecodeItem[T](data, nil)
+			if gctx, ok := ctx.(*gin.Context); ok && err == nil {
+				item, err = c.Guard(gctx, item)
+			}
+		} else {
+			err = json.Unmarshal(data, &item)
+		}
+
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s/%s: %s", c.Name, key, err.Error()))
+			continue
+		}
+
+		items[key] = item
+	}
+
+	if len(failures) > 0 {
+		return nil, failures
+	}
+
+	var before map[string]entry[T]
+
+	return &stagedLoad{
+		cache:  c.Name,
+		lock:   c.mu.Lock,
+		unlock: c.mu.Unlock,
+		store: func(ctx context.Context) (int, error) {
+			before = maps.Clone(c.items)
+			return c.load(ctx, items, replace)
+		},
+		restore: func(ctx context.Context) error {
+			return c.restore(ctx, before)
+		},
+	}, nil
+}
+
+// restore brings back the entries held before a load, the items left unchanged are not stored again. The lock has
+// to be held by the caller.
+func (c *Cache[T]) restore(ctx context.Context, before map[string]entry[T]) error {
+	for key := range c.items {
+		if _, ok := before[key]; ok {
+			continue
+		}
+
+		if err := c.drop(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	for key, e := range before {
+		if current, ok := c.items[key]; ok && current.revision == e.revision {
+			continue
+		}
+
+		if _, err := c.put(ctx, key, e.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (c *Cache) Delete(key string) bool {
-	c.syncMap.Delete(key)
+// load stores given items, optionally dropping all the others. It returns the number of stored items, the lock has
+// to be held by the caller.
+func (c *Cache[T]) load(ctx context.Context, items map[string]T, replace bool) (int, error) {
+	for key := range c.items {
+		if _, ok := items[key]; ok || !replace {
+			continue
+		}
+
+		if err := c.drop(ctx, key); err != nil {
+			return 0, err
+		}
+	}
+
+	var count int
+
+	for key, item := range items {
+		if _, err := c.put(ctx, key, item); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// storeAll stores the staged loads with all their caches locked, so that no change interleaves. If any of them
+// fails, the caches stored so far are restored to their former items (the failed one included), and the error is
+// returned. The counts of the stored items are returned in the order of the loads.
+func storeAll(ctx context.Context, loads []*stagedLoad) ([]int, error) {
+	// The caches are locked in the order of their names, so that the concurrent imports cannot deadlock.
+	locked := slices.Clone(loads)
+	slices.SortFunc(locked, func(a, b *stagedLoad) int {
+		return strings.Compare(a.cache, b.cache)
+	})
+
+	for _, load := range locked {
+		load.lock()
+		defer load.unlock()
+	}
+
+	counts := make([]int, len(loads))
+
+	for idx, load := range loads {
+		count, err := load.store(ctx)
+		if err == nil {
+			counts[idx] = count
+			continue
+		}
+		err = fmt.Errorf("%s: %w", load.cache, err)
+
+		for ; idx >= 0; idx-- {
+			if rerr := loads[idx].restore(ctx); rerr != nil {
+				err = fmt.Errorf("%w (cannot roll back '%s' cache: %s)", err, loads[idx].cache, rerr.Error())
+			}
+			counts[idx] = 0
+		}
+
+		return counts, err
+	}
 
-	return true
+	return counts, nil
 }
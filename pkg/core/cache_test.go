@@ -0,0 +1,214 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testItem struct {
+	Name  string   `json:"name"`
+	Owner string   `json:"owner"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+// mountTestCache registers a fresh cache under such name, it loads the persisted items (if any).
+func mountTestCache(name string) *Cache[testItem] {
+	cache := &Cache[testItem]{}
+	SetupTestEnv(&Package{Name: name, Cache: []CacheInterface{cache}})
+
+	return cache
+}
+
+// readStoreRecords reads all the records of the cache's log.
+func readStoreRecords(t *testing.T, path string) []storeRecord {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var recs []storeRecord
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec storeRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		recs = append(recs, rec)
+	}
+
+	return recs
+}
+
+func TestCacheOperations(t *testing.T) {
+	cache := mountTestCache("cachetest")
+	ctx := context.Background()
+
+	cache.Set("a", testItem{Name: "a", Count: 1})
+	_, rev, _ := cache.GetRevision("a")
+
+	for _, tc := range []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"update of a missing item", func() error {
+			_, _, err := cache.Update(ctx, "missing", func(item testItem) testItem { return item })
+			return err
+		}, ErrItemNotFound},
+		{"set of a missing item by revision", func() error {
+			_, err := cache.SetIfRevision(ctx, "missing", testItem{}, rev)
+			return err
+		}, ErrItemNotFound},
+		{"set of a changed item by revision", func() error {
+			_, err := cache.SetIfRevision(ctx, "a", testItem{}, rev+1)
+			return err
+		}, ErrRevisionMismatch},
+		{"drop of a missing item by revision", func() error {
+			return cache.DeleteIfRevision(ctx, "missing", rev)
+		}, ErrItemNotFound},
+		{"drop of a missing item", func() error {
+			cache.mu.Lock()
+			defer cache.mu.Unlock()
+
+			return cache.drop(ctx, "missing")
+		}, ErrItemNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorIs(t, tc.op(), tc.want)
+		})
+	}
+
+	actual, loaded, err := cache.LoadOrStore(ctx, "a", testItem{Name: "other"})
+	assert.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, "a", actual.Name)
+
+	swapped, err := cache.CompareAndSwap(ctx, "a", testItem{Name: "other"}, testItem{Name: "b"})
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	swapped, err = cache.CompareAndSwap(ctx, "a", testItem{Name: "a", Count: 1}, testItem{Name: "a", Count: 2})
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	item, newRev, ok := cache.GetRevision("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, item.Count)
+	assert.Greater(t, newRev, rev)
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, SetPersistenceDir(dir))
+	defer SetPersistenceDir("")
+
+	cache := mountTestCache("storetest")
+	path := storePath(dir, "storetest")
+
+	cache.Set("a", testItem{Name: "a", Count: 1})
+	cache.Set("a", testItem{Name: "a", Count: 2})
+	cache.Set("b", testItem{Name: "b"})
+	assert.True(t, cache.Delete("b"))
+
+	// the missing items are not logged
+	assert.False(t, cache.Delete("missing"))
+
+	recs := readStoreRecords(t, path)
+	assert.Len(t, recs, 4)
+
+	for idx, tc := range []struct {
+		op  string
+		key string
+	}{
+		{opSet, "a"},
+		{opSet, "a"},
+		{opSet, "b"},
+		{opDelete, "b"},
+	} {
+		if idx < len(recs) {
+			assert.Equal(t, tc.op, recs[idx].Op)
+			assert.Equal(t, tc.key, recs[idx].Key)
+		}
+	}
+
+	_, rev, _ := cache.GetRevision("a")
+
+	// the compaction keeps the current items only
+	assert.NoError(t, CompactStores())
+
+	recs = readStoreRecords(t, path)
+	if assert.Len(t, recs, 1) {
+		assert.Equal(t, "a", recs[0].Key)
+		assert.Equal(t, rev, recs[0].Revision)
+		assert.JSONEq(t, `{"name": "a", "owner": "", "count": 2, "tags": null}`, string(recs[0].Value))
+	}
+
+	// the log is written to after the compaction
+	cache.Set("c", testItem{Name: "c"})
+	assert.Len(t, readStoreRecords(t, path), 2)
+
+	// a torn write at the end of the log is skipped on load
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o640)
+	assert.NoError(t, err)
+	file.WriteString(`{"op": "set", "key": "d", "val`)
+	file.Close()
+
+	loaded := mountTestCache("storetest")
+
+	items, count := loaded.GetAll()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, testItem{Name: "a", Count: 2}, items["a"])
+
+	_, loadedRev, _ := loaded.GetRevision("a")
+	assert.Equal(t, rev, loadedRev)
+
+	// the load compacts the log
+	assert.Len(t, readStoreRecords(t, path), 2)
+
+	// the new revisions follow the loaded ones
+	loaded.Set("a", testItem{Name: "a", Count: 3})
+	_, newRev, _ := loaded.GetRevision("a")
+	assert.Greater(t, newRev, rev)
+}
+
+func TestStoreCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, SetPersistenceDir(dir))
+	defer SetPersistenceDir("")
+
+	path := storePath(dir, "corrupttest")
+
+	// a corrupt record followed by others fails the mount, the log is kept as it is
+	content := `{"op": "set", "key": "a", "rev": 1, "value": {"name": "a"}}
+{"op": "set", "key": "b", "val
+{"op": "set", "key": "c", "rev": 3, "value": {"name": "c"}}
+`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o640))
+
+	cache := &Cache[testItem]{}
+	err := initCaches(&Package{Name: "corrupttest", Cache: []CacheInterface{cache}})
+	assert.ErrorContains(t, err, "line 2")
+
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, content, string(data))
+
+	// a corrupt last line is a torn write, the records before it are loaded
+	content = `{"op": "set", "key": "a", "rev": 1, "value": {"name": "a"}}
+{"op": "set", "key": "c", "rev": 3, "value": {"name": "c"}}
+{"op": "set", "key": "b", "val
+`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o640))
+
+	cache = &Cache[testItem]{}
+	assert.NoError(t, initCaches(&Package{Name: "corrupttest", Cache: []CacheInterface{cache}}))
+
+	_, count := cache.GetAll()
+	assert.Equal(t, 2, count)
+	assert.Len(t, readStoreRecords(t, path), 2)
+}
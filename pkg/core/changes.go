@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Change describes a single change of a persistent cache's item.
+type Change struct {
+	Timestamp time.Time
+
+	// User is the name of the user making the change, taken from the (request) context.
+	User string
+
+	Package string
+	Cache   string
+	Key     string
+
+	// Op is the operation: set or delete.
+	Op string
+
+	Revision uint64
+
+	// Before and After hold the item before and after the change, they are nil when the item did not exist.
+	Before any
+	After  any
+}
+
+// ChangeHook is called on every change of the items, see OnChange.
+type ChangeHook func(ctx context.Context, change Change)
+
+var (
+	changeHooks   []ChangeHook
+	changeHooksMu sync.RWMutex
+)
+
+// OnChange registers the hook to be called on every change of the persistent caches' items. The hooks are called
+// synchronously with the cache locked, so they have to be quick and must not access the cache.
+func OnChange(hook ChangeHook) {
+	changeHooksMu.Lock()
+	defer changeHooksMu.Unlock()
+
+	changeHooks = append(changeHooks, hook)
+}
+
+// notifyChange passes the change to the hooks, the lock of the changed cache has to be held by the caller.
+func (c *Cache[T]) notifyChange(ctx context.Context, op, key string, before, after *T, rev uint64) {
+	if !c.Persistent() {
+		return
+	}
+
+	changeHooksMu.RLock()
+	hooks := changeHooks
+	changeHooksMu.RUnlock()
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	user, _ := ctx.Value(ContextUserName).(string)
+
+	change := Change{
+		Timestamp: time.Now(),
+		User:      user,
+		Package:   strings.Split(c.Name, "/")[0],
+		Cache:     c.Name,
+		Key:       key,
+		Op:        op,
+		Revision:  rev,
+	}
+
+	if before != nil {
+		change.Before = *before
+	}
+
+	if after != nil {
+		change.After = *after
+	}
+
+	for _, hook := range hooks {
+		hook(ctx, change)
+	}
+}
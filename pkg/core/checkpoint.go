@@ -0,0 +1,274 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// walCheckpoint heads a checkpoint file: the snapshot of all the persistent caches taken once its segment has been
+// opened. The replay loads the snapshot and continues with the records of the segment (and the following ones).
+type walCheckpoint struct {
+	// Timestamp is the time the snapshot was taken at, it holds the changes made until then.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Segment is the name of the segment the replay continues with.
+	Segment string `json:"segment"`
+}
+
+// walCheckpointRecord is a single item of the checkpoint's snapshot.
+type walCheckpointRecord struct {
+	Cache string `json:"cache"`
+
+	storeRecord
+}
+
+// checkpointName returns the checkpoint file name of such segment (e.g. 0001.wal -> 0001.checkpoint).
+func checkpointName(segment string) string {
+	return strings.TrimSuffix(segment, ".wal") + ".checkpoint"
+}
+
+// SetWALRetention sets how long the WAL segments (and checkpoints) covered by a later checkpoint are kept, so that
+// the caches can be recovered to such moments. Zero prunes them as soon as the checkpoint is written.
+func SetWALRetention(retention time.Duration) {
+	if walLog == nil {
+		return
+	}
+
+	walLog.checkpointMu.Lock()
+	walLog.retention = retention
+	walLog.checkpointMu.Unlock()
+}
+
+// WALRetention returns how long the WAL segments (and checkpoints) covered by a later checkpoint are kept, if the
+// write-ahead log is enabled at all.
+func WALRetention() (time.Duration, bool) {
+	if walLog == nil {
+		return 0, false
+	}
+
+	walLog.checkpointMu.Lock()
+	defer walLog.checkpointMu.Unlock()
+
+	return walLog.retention, true
+}
+
+// CheckpointWAL writes the checkpoint of the current WAL segment, e.g. once the persisted data are loaded. The
+// checkpoints are written on the segments' rotation too.
+func CheckpointWAL() error {
+	if walLog == nil {
+		return nil
+	}
+
+	walLog.mu.Lock()
+	segment := walLog.segment
+	walLog.mu.Unlock()
+
+	return walLog.checkpoint(segment)
+}
+
+// checkpoint writes the snapshot of all the persistent caches as the checkpoint of such segment, then it prunes the
+// segments the checkpoints cover.
+func (w *wal) checkpoint(segment string) error {
+	w.checkpointMu.Lock()
+	defer w.checkpointMu.Unlock()
+
+	var recs []walCheckpointRecord
+
+	for name, cache := range registry {
+		if !cache.Persistent() {
+			continue
+		}
+
+		cacheRecs, err := cache.records()
+		if err != nil {
+			return fmt.Errorf("cache %s: %w", name, err)
+		}
+
+		for _, rec := range cacheRecs {
+			recs = append(recs, walCheckpointRecord{Cache: name, storeRecord: rec})
+		}
+	}
+
+	// The snapshot holds the changes made until now.
+	header := walCheckpoint{Timestamp: time.Now(), Segment: segment}
+
+	path := filepath.Join(w.dir, checkpointName(segment))
+	tmp := path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	lines := []any{header}
+	for _, rec := range recs {
+		lines = append(lines, rec)
+	}
+
+	for _, line := range lines {
+		data, err := json.Marshal(line)
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		writer.Write(append(data, '\n'))
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	return w.prune(time.Now())
+}
+
+// prune removes the segments and the checkpoints preceding the latest checkpoint taken before the retention period,
+// the lock has to be held by the caller.
+func (w *wal) prune(now time.Time) error {
+	checkpoints, err := readCheckpoints(w.dir)
+	if err != nil {
+		return err
+	}
+
+	var base *walCheckpoint
+	for idx := range checkpoints {
+		if !checkpoints[idx].Timestamp.After(now.Add(-w.retention)) {
+			base = &checkpoints[idx]
+		}
+	}
+
+	if base == nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		covered := (strings.HasSuffix(name, ".wal") && name < base.Segment) ||
+			(strings.HasSuffix(name, ".checkpoint") && name < checkpointName(base.Segment))
+
+		if !entry.IsDir() && covered {
+			if err := os.Remove(filepath.Join(w.dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readCheckpoints returns the headers of the checkpoints in such directory, the oldest first.
+func readCheckpoints(dir string) ([]walCheckpoint, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".checkpoint") {
+			names = append(names, entry.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	checkpoints := make([]walCheckpoint, 0, len(names))
+
+	for _, name := range names {
+		var header walCheckpoint
+
+		err := readCheckpoint(filepath.Join(dir, name), &header, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		checkpoints = append(checkpoints, header)
+	}
+
+	return checkpoints, nil
+}
+
+// readCheckpoint decodes the checkpoint's header, then it calls fn for every record (if fn is set).
+func readCheckpoint(path string, header *walCheckpoint, fn func(rec walCheckpointRecord) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("missing checkpoint header")
+	}
+
+	if err := json.Unmarshal(scanner.Bytes(), header); err != nil {
+		return err
+	}
+
+	if fn == nil {
+		return nil
+	}
+
+	for scanner.Scan() {
+		var rec walCheckpointRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return err
+		}
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// loadCheckpoint sets the items of the checkpoint's snapshot to the registered caches.
+func loadCheckpoint(dir string, checkpoint walCheckpoint) error {
+	var header walCheckpoint
+
+	return readCheckpoint(filepath.Join(dir, checkpointName(checkpoint.Segment)), &header, func(rec walCheckpointRecord) error {
+		cache, ok := registry[rec.Cache]
+		if !ok || !cache.Persistent() {
+			log.Printf("wal replay: skipping a checkpoint record of unknown cache '%s'", rec.Cache)
+			return nil
+		}
+
+		if err := cache.apply(opSet, rec.Key, rec.Value, rec.Revision); err != nil {
+			return fmt.Errorf("%s: cannot decode '%s' item of '%s': %w", checkpointName(checkpoint.Segment), rec.Key, rec.Cache, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag returns the strong entity tag of such item revision.
+func ETag(rev uint64) string {
+	return strconv.Quote(strconv.FormatUint(rev, 10))
+}
+
+// IfMatch reports whether the request's If-Match header matches the item revision. A missing header matches any.
+func IfMatch(ctx *gin.Context, rev uint64) bool {
+	header := ctx.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+
+	etag := ETag(rev)
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		// Weak tags never match as If-Match uses the strong comparison.
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PrintRevisionConflict responds to a write which lost the race with another one: 412 for conditional requests
+// (If-Match sent), 409 otherwise.
+func PrintRevisionConflict(ctx *gin.Context, pkgName, key string) {
+	code := http.StatusConflict
+	if ctx.GetHeader("If-Match") != "" {
+		code = http.StatusPreconditionFailed
+	}
+
+	ctx.IndentedJSON(code, gin.H{
+		"code":    code,
+		"key":     key,
+		"message": "item has been changed meanwhile, fetch it again",
+		"package": pkgName,
+	})
+	return
+}
@@ -0,0 +1,249 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFeedGone is returned when the changes following the offset are no longer held by the feed (or were made before
+// the instance started), the reader has to start over from a snapshot.
+var ErrFeedGone = errors.New("offset no longer in the change feed")
+
+// FeedEvent is a single change of a persistent cache's item in the change feed.
+type FeedEvent struct {
+	// Offset identifies the event, the offsets are increasing (also across restarts).
+	Offset uint64 `json:"offset"`
+
+	Timestamp time.Time `json:"timestamp"`
+	Package   string    `json:"package"`
+	Cache     string    `json:"cache"`
+	Key       string    `json:"key"`
+
+	// Subpackage is the cache's name within the package (e.g. sockets of dish/sockets), blank for the main cache.
+	Subpackage string `json:"subpackage,omitempty"`
+
+	// Op is the operation: set or delete.
+	Op string `json:"op"`
+
+	Revision uint64 `json:"revision,omitempty"`
+
+	// Value is the new item, blank for deletes.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// changeFeed holds the latest changes in a ring.
+type changeFeed struct {
+	mu sync.Mutex
+
+	events []FeedEvent
+	head   int
+	count  int
+
+	// start is the offset all the held events follow: the instance start, or the last dropped event.
+	start uint64
+	last  uint64
+
+	// notify is closed (and replaced) on every new event.
+	notify chan struct{}
+}
+
+var feed = newChangeFeed(10000)
+
+func init() {
+	OnChange(feed.record)
+}
+
+func newChangeFeed(size int) *changeFeed {
+	now := uint64(time.Now().UnixNano())
+
+	return &changeFeed{
+		events: make([]FeedEvent, size),
+		start:  now,
+		last:   now,
+		notify: make(chan struct{}),
+	}
+}
+
+// SetFeedSize sets the count of the latest changes held by the feed, the changes held so far are dropped.
+func SetFeedSize(size int) {
+	if size <= 0 {
+		return
+	}
+
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	feed.events = make([]FeedEvent, size)
+	feed.head, feed.count = 0, 0
+	feed.start = feed.last
+}
+
+func (f *changeFeed) record(ctx context.Context, change Change) {
+	var value json.RawMessage
+
+	if change.After != nil {
+		data, err := json.Marshal(change.After)
+		if err != nil {
+			return
+		}
+		value = data
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The offsets are time-based like the revisions, so that they are not reused after a restart.
+	offset := uint64(change.Timestamp.UnixNano())
+	if offset <= f.last {
+		offset = f.last + 1
+	}
+	f.last = offset
+
+	size := len(f.events)
+	idx := (f.head + f.count) % size
+
+	if f.count == size {
+		f.start = f.events[f.head].Offset
+		f.head = (f.head + 1) % size
+	} else {
+		f.count++
+	}
+
+	_, subpackage, _ := strings.Cut(change.Cache, "/")
+
+	f.events[idx] = FeedEvent{
+		Offset:     offset,
+		Timestamp:  change.Timestamp,
+		Package:    change.Package,
+		Cache:      change.Cache,
+		Subpackage: subpackage,
+		Key:        change.Key,
+		Op:         change.Op,
+		Revision:   change.Revision,
+		Value:      value,
+	}
+
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// CompactFeed replaces the earlier events of every item held by the feed with its latest event, so that the former
+// values of the changed and deleted items are not served anymore (e.g. after the personal data are erased). The
+// offsets are kept, the readers following the feed end up with the same items.
+func CompactFeed() {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	latest := make(map[string]FeedEvent)
+
+	for idx := feed.count - 1; idx >= 0; idx-- {
+		pos := (feed.head + idx) % len(feed.events)
+		ev := feed.events[pos]
+		id := ev.Cache + "/" + ev.Key
+
+		last, ok := latest[id]
+		if !ok {
+			latest[id] = ev
+			continue
+		}
+
+		last.Offset, last.Timestamp = ev.Offset, ev.Timestamp
+		feed.events[pos] = last
+	}
+}
+
+// FeedOffset returns the offset of the latest change, the reader of a snapshot taken afterwards can follow the feed
+// from it.
+func FeedOffset() uint64 {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	return feed.last
+}
+
+// FeedSince returns up to limit changes following the offset, oldest first.
+func FeedSince(after uint64, limit int) ([]FeedEvent, error) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	if after < feed.start {
+		return nil, ErrFeedGone
+	}
+
+	events := []FeedEvent{}
+
+	for idx := 0; idx < feed.count && len(events) < limit; idx++ {
+		ev := feed.events[(feed.head+idx)%len(feed.events)]
+		if ev.Offset > after {
+			events = append(events, ev)
+		}
+	}
+
+	return events, nil
+}
+
+// WaitFeed waits until there is a change following the offset, or until the context is done.
+func WaitFeed(ctx context.Context, after uint64) bool {
+	for {
+		feed.mu.Lock()
+		last, notify := feed.last, feed.notify
+		feed.mu.Unlock()
+
+		if last > after {
+			return true
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// ApplyFeedEvent applies the change of another instance's feed to the local cache, it is logged and persisted as any
+// other change.
+func ApplyFeedEvent(ctx context.Context, ev FeedEvent) error {
+	cache, ok := registry[ev.Cache]
+	if !ok || !cache.Persistent() {
+		return fmt.Errorf("%w: %s", ErrCacheNotFound, ev.Cache)
+	}
+
+	if err := cache.applyChange(ctx, ev.Op, ev.Key, ev.Value); err != nil {
+		return fmt.Errorf("cache %s: cannot apply '%s' of '%s': %w", ev.Cache, ev.Op, ev.Key, err)
+	}
+
+	return nil
+}
+
+func (c *Cache[T]) applyChange(ctx context.Context, op, key string, raw json.RawMessage) error {
+	switch op {
+	case opSet:
+		var item T
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		_, err := c.put(ctx, key, item)
+		return err
+
+	case opDelete:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if _, ok := c.items[key]; !ok {
+			return nil
+		}
+		return c.drop(ctx, key)
+	}
+
+	return fmt.Errorf("unknown operation '%s'", op)
+}
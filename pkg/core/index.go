@@ -0,0 +1,234 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// index is a secondary index of the cache, it maps the values of an item field to the keys of items holding them.
+type index struct {
+	// path is the reflect index of the indexed struct field.
+	path []int
+
+	keys map[string]map[string]struct{}
+}
+
+// IndexKeyer is implemented by the string field types indexed by a key derived from their value (e.g. a lookup prefix
+// of a salted hash) instead of the value itself.
+type IndexKeyer interface {
+	IndexKey() string
+}
+
+// AddIndex indexes the items by the field of such JSON name, so that Lookup does not have to scan the cache. String,
+// boolean and integer fields are supported, as well as string slices (an item is indexed by each of the elements).
+// The fields implementing IndexKeyer are indexed by their keys. Adding an existing index is a no-op.
+func (c *Cache[T]) AddIndex(field string) error {
+	path, err := indexPath[T](field)
+	if err != nil {
+		return fmt.Errorf("cache %s: %w", c.Name, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.indexes[field]; ok {
+		return nil
+	}
+
+	if c.indexes == nil {
+		c.indexes = make(map[string]*index)
+	}
+
+	idx := &index{path: path, keys: make(map[string]map[string]struct{})}
+	for key, e := range c.items {
+		idx.add(key, e.value)
+	}
+
+	c.indexes[field] = idx
+	return nil
+}
+
+// Lookup returns the items whose field (referenced by its JSON name) holds the value. Fields without an index are
+// scanned. Blank values are never matched.
+func (c *Cache[T]) Lookup(field, value string) map[string]T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	items := make(map[string]T)
+
+	if value == "" {
+		return items
+	}
+
+	if idx, ok := c.indexes[field]; ok {
+		for key := range idx.keys[value] {
+			items[key] = c.items[key].value
+		}
+		return items
+	}
+
+	path, err := indexPath[T](field)
+	if err != nil {
+		return items
+	}
+
+	for key, e := range c.items {
+		for _, v := range fieldValues(e.value, path) {
+			if v == value {
+				items[key] = e.value
+				break
+			}
+		}
+	}
+
+	return items
+}
+
+// setItem stores the entry and updates the indexes, the lock has to be held by the caller.
+func (c *Cache[T]) setItem(key string, e entry[T]) {
+	if c.items == nil {
+		c.items = make(map[string]entry[T])
+	}
+
+	if old, ok := c.items[key]; ok {
+		for _, idx := range c.indexes {
+			idx.remove(key, old.value)
+		}
+	}
+
+	c.items[key] = e
+
+	for _, idx := range c.indexes {
+		idx.add(key, e.value)
+	}
+}
+
+// removeItem drops the entry and updates the indexes, the lock has to be held by the caller.
+func (c *Cache[T]) removeItem(key string) {
+	old, ok := c.items[key]
+	if !ok {
+		return
+	}
+
+	for _, idx := range c.indexes {
+		idx.remove(key, old.value)
+	}
+
+	delete(c.items, key)
+}
+
+// reindex rebuilds all the indexes from scratch, the lock has to be held by the caller.
+func (c *Cache[T]) reindex() {
+	for _, idx := range c.indexes {
+		idx.keys = make(map[string]map[string]struct{})
+
+		for key, e := range c.items {
+			idx.add(key, e.value)
+		}
+	}
+}
+
+// indexFields adds the indexes declared by the package.
+func (c *Cache[T]) indexFields(fields []string) error {
+	for _, field := range fields {
+		if err := c.AddIndex(field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (idx *index) add(key string, item any) {
+	for _, value := range fieldValues(item, idx.path) {
+		if idx.keys[value] == nil {
+			idx.keys[value] = make(map[string]struct{})
+		}
+		idx.keys[value][key] = struct{}{}
+	}
+}
+
+func (idx *index) remove(key string, item any) {
+	for _, value := range fieldValues(item, idx.path) {
+		delete(idx.keys[value], key)
+
+		if len(idx.keys[value]) == 0 {
+			delete(idx.keys, value)
+		}
+	}
+}
+
+// indexPath finds the struct field of such JSON name in the model and checks it can be indexed.
+func indexPath[T any](field string) ([]int, error) {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot index field '%s' of non-struct type %s", field, typ)
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != field || !sf.IsExported() {
+			continue
+		}
+
+		kind := sf.Type.Kind()
+		if kind == reflect.Slice {
+			kind = sf.Type.Elem().Kind()
+			if kind != reflect.String {
+				return nil, fmt.Errorf("cannot index field '%s' of type %s", field, sf.Type)
+			}
+		}
+
+		switch kind {
+		case reflect.String, reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return sf.Index, nil
+		}
+
+		return nil, fmt.Errorf("cannot index field '%s' of type %s", field, sf.Type)
+	}
+
+	return nil, fmt.Errorf("no field '%s' in type %s", field, typ)
+}
+
+// fieldValues returns the non-blank values of the field as index keys.
+func fieldValues(item any, path []int) []string {
+	value := reflect.ValueOf(item).FieldByIndex(path)
+
+	var values []string
+
+	appendValue := func(v reflect.Value) {
+		var str string
+
+		switch v.Kind() {
+		case reflect.String:
+			str = v.String()
+			if keyer, ok := v.Interface().(IndexKeyer); ok {
+				str = keyer.IndexKey()
+			}
+		case reflect.Bool:
+			str = strconv.FormatBool(v.Bool())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			str = strconv.FormatInt(v.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			str = strconv.FormatUint(v.Uint(), 10)
+		}
+
+		if str != "" {
+			values = append(values, str)
+		}
+	}
+
+	if value.Kind() == reflect.Slice {
+		for i := 0; i < value.Len(); i++ {
+			appendValue(value.Index(i))
+		}
+		return values
+	}
+
+	appendValue(value)
+	return values
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexes(t *testing.T) {
+	cache := mountTestCache("indextest")
+
+	cache.Set("a", testItem{Name: "a", Owner: "alice", Count: 1, Tags: []string{"x"}})
+	cache.Set("b", testItem{Name: "b", Owner: "bob", Count: 2, Tags: []string{"x", "y"}})
+
+	// the items stored before the index are indexed too
+	for _, field := range []string{"owner", "tags", "count"} {
+		assert.NoError(t, cache.AddIndex(field))
+	}
+	assert.NoError(t, cache.AddIndex("owner"))
+	assert.Error(t, cache.AddIndex("color"))
+
+	cache.Set("c", testItem{Name: "c", Owner: "alice", Count: 2})
+	cache.Set("a", testItem{Name: "a", Owner: "carol", Count: 1, Tags: []string{"y"}})
+	cache.Delete("b")
+
+	_, _, err := cache.Update(context.Background(), "c", func(item testItem) testItem {
+		item.Tags = []string{"z"}
+		return item
+	})
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		field string
+		value string
+		keys  []string
+	}{
+		{"owner", "alice", []string{"c"}},
+		{"owner", "carol", []string{"a"}},
+		{"owner", "bob", nil},
+		{"owner", "", nil},
+		{"tags", "x", nil},
+		{"tags", "y", []string{"a"}},
+		{"tags", "z", []string{"c"}},
+		{"count", "2", []string{"c"}},
+		// the fields without an index are scanned
+		{"name", "a", []string{"a"}},
+		{"color", "red", nil},
+	} {
+		t.Run(tc.field+"="+tc.value, func(t *testing.T) {
+			var keys []string
+			for key := range cache.Lookup(tc.field, tc.value) {
+				keys = append(keys, key)
+			}
+
+			assert.ElementsMatch(t, tc.keys, keys)
+		})
+	}
+
+	// the replayed changes update the indexes as well
+	assert.NoError(t, cache.apply(opSet, "d", []byte(`{"name": "d", "owner": "alice"}`), 0))
+	assert.NoError(t, cache.apply(opDelete, "c", nil, 0))
+
+	assert.Len(t, cache.Lookup("owner", "alice"), 1)
+	assert.Contains(t, cache.Lookup("owner", "alice"), "d")
+}
@@ -9,11 +9,26 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func MountMany(parentRouter *gin.Engine, systemCache **Cache, pkgs ...*Package) {
+// registry holds all mounted caches by their full names.
+var registry = make(map[string]CacheInterface)
+
+// rateLimits holds the mounted packages' own rate limits.
+var rateLimits = make(map[string]int)
+
+// PackageRateLimit returns the rate limit declared by such mounted package, zero if none.
+func PackageRateLimit(name string) int {
+	return rateLimits[name]
+}
+
+// MountMany mounts the packages and lists them in the system cache. A package failing to mount (e.g. its persisted
+// data cannot be loaded) fails the whole mount, so that the server never starts with its routes missing.
+func MountMany(parentRouter *gin.Engine, systemCache *Cache[[]string], pkgs ...*Package) error {
 	if parentRouter == nil {
-		return
+		return errors.New("nil router pointer")
 	}
 
+	mountedRouter = parentRouter
+
 	var mountedPkgs []string
 	var genericPkgs []string
 
@@ -22,69 +37,104 @@ func MountMany(parentRouter *gin.Engine, systemCache **Cache, pkgs ...*Package)
 			continue
 		}
 
-		if mounted := MountPackage(parentRouter, pkg); mounted {
-			mountedPkgs = append(mountedPkgs, pkg.Name)
+		if err := MountPackage(parentRouter, pkg); err != nil {
+			return err
+		}
 
-			if pkg.Generic {
-				genericPkgs = append(genericPkgs, pkg.Name)
-			}
+		mountedPkgs = append(mountedPkgs, pkg.Name)
 
-			if len(pkg.Subpackages) > 0 {
-				for _, sub := range pkg.Subpackages {
-					genericPkgs = append(genericPkgs, fmt.Sprintf("%s/%s", pkg.Name, sub))
-				}
+		if pkg.Generic {
+			genericPkgs = append(genericPkgs, pkg.Name)
+		}
+
+		if len(pkg.Subpackages) > 0 {
+			for _, sub := range pkg.Subpackages {
+				genericPkgs = append(genericPkgs, fmt.Sprintf("%s/%s", pkg.Name, sub))
 			}
 		}
 	}
 
 	if systemCache != nil {
-		(*systemCache).Set("mounted", mountedPkgs)
-		(*systemCache).Set("generic", genericPkgs)
+		systemCache.Set("mounted", mountedPkgs)
+		systemCache.Set("generic", genericPkgs)
 	}
+
+	return nil
 }
 
-func MountPackage(router *gin.Engine, pkg *Package) bool {
+func MountPackage(router *gin.Engine, pkg *Package) error {
 	if pkg == nil {
-		fmt.Errorf("failed to mount a package: Package input cannot be nil")
-		return false
+		return errors.New("failed to mount a package: Package input cannot be nil")
 	}
 
-	if pkg.Name == "" || &pkg.Name == nil {
-		fmt.Errorf("failed to mount a package: Name cannot be blank")
-		return false
+	if pkg.Name == "" {
+		return errors.New("failed to mount a package: Name cannot be blank")
 	}
 
-	if err := initCaches(pkg.Cache, pkg.CacheNames); err != nil {
-		fmt.Errorf("failed to mount '%s' package: %s", pkg.Name, err.Error())
-		return false
+	if err := initCaches(pkg); err != nil {
+		return fmt.Errorf("failed to mount '%s' package: %w", pkg.Name, err)
 	}
 
 	if err := mountRouterGroup(router, pkg.Name, pkg.Routes); err != nil {
-		fmt.Errorf("failed to mount '%s' package: %s", pkg.Name, err.Error())
-		return false
+		return fmt.Errorf("failed to mount '%s' package: %w", pkg.Name, err)
+	}
+
+	if pkg.RateLimit > 0 {
+		rateLimits[pkg.Name] = pkg.RateLimit
 	}
 
-	return true
+	return nil
 }
 
-func initCaches(caches []**Cache, names []string) error {
+func initCaches(pkg *Package) error {
+	caches := pkg.Cache
+	names := pkg.CacheNames
+
 	if len(names) != len(caches) {
 		names = make([]string, len(caches))
 	}
 
 	for idx, name := range names {
 		cache := caches[idx]
+		if cache == nil {
+			continue
+		}
+
+		// Name the cache after its package, e.g. 'users' or 'dish/sockets'.
+		fullName := pkg.Name
+		if name != "" {
+			fullName = fmt.Sprintf("%s/%s", pkg.Name, name)
+		}
+
+		registry[fullName] = cache
 
+		if err := cache.setup(fullName); err != nil {
+			return fmt.Errorf("cannot load persisted '%s' cache: %w", fullName, err)
+		}
+	}
+
+	return initIndexes(pkg)
+}
+
+func initIndexes(pkg *Package) error {
+	for cache, fields := range pkg.Indexes {
 		if cache == nil {
-			c := &Cache{Name: name}
-			cache = &c
+			continue
+		}
+
+		if err := cache.indexFields(fields); err != nil {
+			return err
 		}
+	}
 
-		if *cache == nil {
-			*cache = &Cache{Name: name}
+	for cache, field := range pkg.Owners {
+		if cache == nil {
+			continue
 		}
 
-		caches[idx] = cache
+		if err := cache.ownerField(field); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,360 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.vxn.dev/swis/v5/pkg/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification the generated document conforms to.
+const OpenAPIVersion = "3.1.0"
+
+// publicPaths are the routes served without the token authentication.
+var publicPaths = map[string]bool{
+	"/ping": true,
+}
+
+// mountedRouter is the router the packages are mounted to, its routes are described by the OpenAPI document.
+var mountedRouter *gin.Engine
+
+// OpenAPI returns the OpenAPI 3 document of all the routes of the server. The models of the mounted packages' caches
+// describe the request and response bodies of the generic item routes (e.g. /dish/sockets/{key}).
+func OpenAPI() map[string]any {
+	b := newSchemaBuilder("#/components/schemas/")
+
+	b.defs["Error"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"code":    map[string]any{"type": "integer"},
+			"error":   map[string]any{"type": "string"},
+			"key":     map[string]any{"type": "string"},
+			"message": map[string]any{"type": "string"},
+			"package": map[string]any{"type": "string"},
+			"fields": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"field":   map[string]any{"type": "string"},
+						"message": map[string]any{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+
+	version := config.Current().App.Version
+	if version == "" {
+		version = "5"
+	}
+
+	doc := map[string]any{
+		"openapi":           OpenAPIVersion,
+		"jsonSchemaDialect": JSONSchemaDialect,
+		"info": map[string]any{
+			"title":       "swis-api (swapi) v5",
+			"description": "sakalWeb Information System v5 RESTful API",
+			"version":     version,
+		},
+		"security": []any{map[string]any{"token": []any{}}, map[string]any{"bearer": []any{}}},
+	}
+
+	paths := make(map[string]any)
+	operationIDs := make(map[string]int)
+
+	var routes gin.RoutesInfo
+	if mountedRouter != nil {
+		routes = mountedRouter.Routes()
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	for _, route := range routes {
+		// Static files are not the part of the API.
+		if strings.Contains(route.Handler, "createStaticHandler") || strings.Contains(route.Handler, "StaticFile") {
+			continue
+		}
+
+		path, params := openAPIPath(route.Path)
+
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			item = make(map[string]any)
+			paths[path] = item
+		}
+
+		op := b.operation(route, params)
+
+		// Operation IDs have to be unique, the handlers can be shared by more routes.
+		id := op["operationId"].(string)
+		if operationIDs[id]++; operationIDs[id] > 1 {
+			op["operationId"] = fmt.Sprintf("%s%d", id, operationIDs[id])
+		}
+
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	doc["paths"] = paths
+	doc["components"] = map[string]any{
+		"schemas": b.defs,
+		"securitySchemes": map[string]any{
+			"token": map[string]any{
+				"type": "apiKey",
+				"in":   "header",
+				"name": "X-Auth-Token",
+			},
+			"bearer": map[string]any{
+				"type":         "http",
+				"scheme":       "bearer",
+				"bearerFormat": "JWT",
+			},
+		},
+	}
+
+	return doc
+}
+
+// openAPIPath converts the gin route path (/dish/sockets/:key) to the OpenAPI one (/dish/sockets/{key}).
+func openAPIPath(path string) (string, []string) {
+	var params []string
+
+	segments := strings.Split(path, "/")
+	for idx, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+			segments[idx] = "{" + segment[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// routeCache finds the mounted cache serving the route by the longest cache name prefixing the path. It returns the
+// rest of the path too.
+func routeCache(path string) (CacheInterface, string) {
+	var found CacheInterface
+	var rest string
+	var longest int
+
+	for name, cache := range registry {
+		prefix := "/" + name
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+
+		if len(name) > longest {
+			found, rest, longest = cache, strings.TrimPrefix(path, prefix), len(name)
+		}
+	}
+
+	return found, rest
+}
+
+// operation describes the route, the generic item routes get their request and response bodies by the cache model.
+func (b *schemaBuilder) operation(route gin.RouteInfo, params []string) map[string]any {
+	handler := route.Handler
+	if idx := strings.LastIndex(handler, "/"); idx >= 0 {
+		handler = handler[idx+1:]
+	}
+
+	id := handler
+	if strings.Contains(handler, ".func") {
+		// Anonymous handlers are named after the route.
+		id = strings.ToLower(route.Method)
+		for _, word := range strings.FieldsFunc(route.Path, func(r rune) bool { return strings.ContainsRune("/:*_-", r) }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+
+		if route.Path == "/" {
+			id += "Root"
+		}
+	}
+
+	tag := strings.SplitN(strings.TrimPrefix(route.Path, "/"), "/", 2)[0]
+	if tag == "" {
+		tag = "root"
+	}
+
+	op := map[string]any{
+		"operationId": id,
+		"summary":     handler,
+		"tags":        []any{tag},
+	}
+
+	if publicPaths[route.Path] {
+		op["security"] = []any{}
+	}
+
+	var parameters []any
+	for _, param := range params {
+		parameters = append(parameters, map[string]any{
+			"name":     param,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+
+	errorResponse := map[string]any{
+		"description": "error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": map[string]any{"$ref": b.refPrefix + "Error"}},
+		},
+	}
+
+	responses := map[string]any{
+		"default": errorResponse,
+	}
+	op["responses"] = responses
+
+	cache, rest := routeCache(route.Path)
+
+	var model map[string]any
+	if cache != nil {
+		model = b.schema(cache.modelType())
+	}
+
+	envelope := func(description string, fields map[string]any) map[string]any {
+		properties := map[string]any{
+			"code":    map[string]any{"type": "integer"},
+			"message": map[string]any{"type": "string"},
+			"package": map[string]any{"type": "string"},
+		}
+		for name, value := range fields {
+			properties[name] = value
+		}
+
+		return map[string]any{
+			"description": description,
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{"type": "object", "properties": properties},
+				},
+			},
+		}
+	}
+
+	body := func(content map[string]any) map[string]any {
+		return map[string]any{"required": true, "content": content}
+	}
+
+	jsonPatch := map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type":     "object",
+			"required": []any{"op", "path"},
+			"properties": map[string]any{
+				"op":    map[string]any{"enum": []any{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  map[string]any{"type": "string"},
+				"from":  map[string]any{"type": "string"},
+				"value": map[string]any{},
+			},
+		},
+	}
+
+	etag := map[string]any{
+		"ETag": map[string]any{
+			"description": "item revision",
+			"schema":      map[string]any{"type": "string"},
+		},
+	}
+
+	ifMatch := map[string]any{
+		"name":        "If-Match",
+		"in":          "header",
+		"description": "item revision (ETag) the change is conditional on",
+		"schema":      map[string]any{"type": "string"},
+	}
+
+	// The generic item routes: the collection (/pkg) and the item (/pkg/{key}).
+	isItem := len(params) == 1 && rest == "/:"+params[0]
+
+	switch {
+	case model != nil && rest == "" && route.Method == http.MethodGet:
+		for _, name := range []string{QuerySort, QueryLimit, QueryCursor, QueryFields} {
+			parameters = append(parameters, map[string]any{
+				"name":   name,
+				"in":     "query",
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+
+		responses["200"] = envelope("items of the package", map[string]any{
+			"count":       map[string]any{"type": "integer"},
+			"items":       map[string]any{"type": "object", "additionalProperties": model},
+			"keys":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"next_cursor": map[string]any{"type": "string"},
+			"total":       map[string]any{"type": "integer"},
+		})
+
+	case model != nil && rest == "" && route.Method == http.MethodPost:
+		op["requestBody"] = body(map[string]any{"application/json": map[string]any{"schema": model}})
+		responses["201"] = envelope("item created", map[string]any{
+			"item": model,
+			"key":  map[string]any{"type": "string"},
+		})
+
+	case model != nil && isItem && route.Method == http.MethodGet:
+		response := envelope("item", map[string]any{
+			"item": model,
+			"key":  map[string]any{"type": "string"},
+		})
+		response["headers"] = etag
+		responses["200"] = response
+
+	case model != nil && isItem && (route.Method == http.MethodPut || route.Method == http.MethodPatch):
+		parameters = append(parameters, ifMatch)
+
+		if route.Method == http.MethodPut {
+			op["requestBody"] = body(map[string]any{"application/json": map[string]any{"schema": model}})
+		} else {
+			op["requestBody"] = body(map[string]any{
+				MergePatchType: map[string]any{"schema": model},
+				JSONPatchType:  map[string]any{"schema": jsonPatch},
+			})
+		}
+
+		response := envelope("item updated", map[string]any{
+			"item": model,
+			"key":  map[string]any{"type": "string"},
+		})
+		response["headers"] = etag
+		responses["200"] = response
+
+	case model != nil && isItem && route.Method == http.MethodDelete:
+		parameters = append(parameters, ifMatch)
+		responses["200"] = envelope("item deleted", map[string]any{
+			"key": map[string]any{"type": "string"},
+		})
+
+	default:
+		responses["200"] = map[string]any{"description": "ok"}
+	}
+
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+
+	return op
+}
+
+// JSONSchemas returns the JSON schemas of all the mounted caches' models by the cache names.
+func JSONSchemas() map[string]any {
+	schemas := make(map[string]any, len(registry))
+
+	for name, cache := range registry {
+		schemas[name] = jsonSchemaOf(cache.modelType())
+	}
+
+	return schemas
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextOwnerScope is the request context key holding the name of the user the request is limited to. Such
+// requests are served only the items the user owns, see Cache.SetOwnerField.
+const ContextOwnerScope = "ownerScope"
+
+// SetOwnerField marks the field (by its JSON name) holding the name of the item's owner, the field is indexed too.
+// The items of caches without an owner field (or function, see SetOwnerFunc) are never served to the requests limited
+// to their owner's items.
+func (c *Cache[T]) SetOwnerField(field string) error {
+	if err := c.AddIndex(field); err != nil {
+		return err
+	}
+
+	path, _ := indexPath[T](field)
+
+	c.mu.Lock()
+	c.owner = path
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *Cache[T]) ownerField(field string) error {
+	return c.SetOwnerField(field)
+}
+
+// SetOwnerFunc derives the owners of the items without an owner field, e.g. from their parent items in another
+// cache. The derived owners follow the parent items, so they are not replaced by DisownItems.
+func (c *Cache[T]) SetOwnerFunc(owners func(item T) []string) {
+	c.mu.Lock()
+	c.ownerFunc = owners
+	c.mu.Unlock()
+}
+
+// Owns reports whether the item is owned by such user.
+func (c *Cache[T]) Owns(item T, user string) bool {
+	c.mu.RLock()
+	path, owners := c.owner, c.ownerFunc
+	c.mu.RUnlock()
+
+	if user == "" {
+		return false
+	}
+
+	return slices.Contains(itemOwners(item, path, owners), user)
+}
+
+// itemOwners returns the owners of the item by the owner field or the owner function, if any of them is set.
+func itemOwners[T any](item T, path []int, owners func(item T) []string) []string {
+	switch {
+	case path != nil:
+		return fieldValues(item, path)
+	case owners != nil:
+		return owners(item)
+	}
+
+	return nil
+}
+
+// OwnerScope returns the name of the user the request is limited to, if it is limited at all.
+func OwnerScope(ctx *gin.Context) (string, bool) {
+	user, ok := ctx.Value(ContextOwnerScope).(string)
+	return user, ok
+}
+
+// CanAccess reports whether the request may access the item, the requests limited to their user's items may access
+// only those.
+func CanAccess[T any](ctx *gin.Context, cache *Cache[T], item T) bool {
+	user, scoped := OwnerScope(ctx)
+	return !scoped || cache.Owns(item, user)
+}
+
+// AccessibleItems filters the items to those the request may access.
+func AccessibleItems[T any](ctx *gin.Context, cache *Cache[T], items map[string]T) map[string]T {
+	user, scoped := OwnerScope(ctx)
+	if !scoped {
+		return items
+	}
+
+	owned := make(map[string]T)
+	for key, item := range items {
+		if cache.Owns(item, user) {
+			owned[key] = item
+		}
+	}
+
+	return owned
+}
+
+// PrintOwnerScopeError responds to the requests that would touch items of other owners.
+func PrintOwnerScopeError(ctx *gin.Context, pkgName, key string) {
+	ctx.IndentedJSON(http.StatusForbidden, gin.H{
+		"code":    http.StatusForbidden,
+		"key":     key,
+		"message": "access limited to own items",
+		"package": pkgName,
+	})
+}
+
+// OwnedItems lists the items owned by such user in all the caches with an owner field (or function), by the cache
+// names.
+func OwnedItems(user string) map[string]map[string]any {
+	found := make(map[string]map[string]any)
+
+	for name, cache := range registry {
+		if items := cache.owned(user); len(items) > 0 {
+			found[name] = items
+		}
+	}
+
+	return found
+}
+
+// DisownItems replaces such user with the replacement in the owner fields of all the caches. It returns the counts
+// of the changed items by the cache names.
+func DisownItems(ctx context.Context, user, replacement string) (map[string]int, error) {
+	counts := make(map[string]int)
+
+	for name, cache := range registry {
+		count, err := cache.disown(ctx, user, replacement)
+		if count > 0 {
+			counts[name] = count
+		}
+
+		if err != nil {
+			return counts, fmt.Errorf("cache %s: %w", name, err)
+		}
+	}
+
+	return counts, nil
+}
+
+func (c *Cache[T]) owned(user string) map[string]any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	items := make(map[string]any)
+	if (c.owner == nil && c.ownerFunc == nil) || user == "" {
+		return items
+	}
+
+	for key, e := range c.items {
+		if slices.Contains(itemOwners(e.value, c.owner, c.ownerFunc), user) {
+			items[key] = e.value
+		}
+	}
+
+	return items
+}
+
+func (c *Cache[T]) disown(ctx context.Context, user, replacement string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.owner == nil || user == "" {
+		return 0, nil
+	}
+
+	var count int
+
+	for key, e := range c.items {
+		if !slices.Contains(fieldValues(e.value, c.owner), user) {
+			continue
+		}
+
+		item := e.value
+		field := reflect.ValueOf(&item).Elem().FieldByIndex(c.owner)
+
+		// The owner field is a string or a list of them, see indexPath. The list is copied, as it is shared with
+		// the stored item.
+		if field.Kind() == reflect.Slice {
+			field.Set(reflect.AppendSlice(reflect.MakeSlice(field.Type(), 0, field.Len()), field))
+
+			for idx := 0; idx < field.Len(); idx++ {
+				if field.Index(idx).String() == user {
+					field.Index(idx).SetString(replacement)
+				}
+			}
+		} else {
+			field.SetString(replacement)
+		}
+
+		if _, err := c.put(ctx, key, item); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -1,8 +1,8 @@
 package core
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -16,8 +16,8 @@ type Package struct {
 	// Name hold the name of a package.
 	Name string
 
-	// Cache is an array of pointers to caches to be initialized.
-	Cache []**Cache
+	// Cache is an array of caches to be initialized.
+	Cache []CacheInterface
 
 	// CacheName is an array of names for such caches being initialized.
 	CacheNames []string
@@ -33,22 +33,29 @@ type Package struct {
 
 	// SubpackageModels is a map to match the root model for such subpackage.
 	SubpackageModels map[string]any
+
+	// Indexes lists the fields (by their JSON names) to index in such caches, see Cache.AddIndex.
+	Indexes map[CacheInterface][]string
+
+	// Owners names the field (by its JSON name) holding the owner of such caches' items, see Cache.SetOwnerField.
+	Owners map[CacheInterface]string
+
+	// RateLimit is the count of requests per minute a single client can make to the package, zero means the server's
+	// default (see PackageRateLimit).
+	RateLimit int
 }
 
 type RestorePackage struct {
 	Name string
 
-	// Cache is an array of pointers to caches to be initialized.
-	Cache []**Cache
+	// Cache is an array of caches to be restored, their order matches the Subpackages.
+	Cache []CacheInterface
 
 	// CacheName is an array of names for such caches being initialized.
 	CacheNames []string
 
 	// Subpackages is an array of subpackage names to register as generic ones.
 	Subpackages []string
-
-	// SubpackageModels is a map to match the root model for such subpackage.
-	SubpackageModels map[string]any
 }
 
 // FieldDetail is a struct to describe any loaded model's field for the type enum export.
@@ -61,26 +68,77 @@ type FieldDetail struct {
 
 	// ReadOnly indicates whether is the field readonly (write-locked) or not.
 	Readonly bool `json:"readonly"`
+
+	// Default holds the value a missing field gets on create, it is not applied on update.
+	Default string `json:"default,omitempty"`
 }
 
-func PrintAllRootItems(ctx *gin.Context, cache *Cache, pkgName string) {
+// PrintAllRootItems lists the cache's items. The listing can be narrowed by the query parameters (see ParseQuery):
+// field filters (?owner=...), sort keys (?sort=-date,name), a page (?limit=20&cursor=...) and the fields
+// to return (?fields=name,owner).
+func PrintAllRootItems[T any](ctx *gin.Context, cache *Cache[T], pkgName string) {
+	var model T
+
+	query, err := ParseQuery(ctx.Request.URL.Query(), model)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   err.Error(),
+			"message": "invalid query",
+			"package": pkgName,
+		})
+		return
+	}
+
 	items, count := cache.GetAll()
 
+	if _, scoped := OwnerScope(ctx); scoped {
+		items = AccessibleItems(ctx, cache, items)
+		count = len(items)
+	}
+
+	items = cache.viewItems(ctx, items)
+
+	if query.Empty() {
+		ctx.IndentedJSON(http.StatusOK, gin.H{
+			"code":    http.StatusOK,
+			"count":   count,
+			"items":   items,
+			"message": fmt.Sprintf("ok, listing all items of '%s' package", pkgName),
+			"package": pkgName,
+		})
+		return
+	}
+
+	result, err := RunQuery(items, query)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   err.Error(),
+			"message": "invalid query",
+			"package": pkgName,
+		})
+		return
+	}
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
-		"code":    http.StatusOK,
-		"count":   count,
-		"items":   items,
-		"message": fmt.Sprintf("ok, listing all items of '%s' package", pkgName),
-		"package": pkgName,
+		"code":        http.StatusOK,
+		"count":       len(result.Keys),
+		"items":       result.Items,
+		"keys":        result.Keys,
+		"message":     fmt.Sprintf("ok, listing items of '%s' package", pkgName),
+		"next_cursor": result.NextCursor,
+		"package":     pkgName,
+		"total":       result.Total,
 	})
 	return
 }
 
-func PrintItemByParam[T any](ctx *gin.Context, cache *Cache, pkgName string, model T) {
+func PrintItemByParam[T any](ctx *gin.Context, cache *Cache[T], pkgName string, model T) {
 	key := ctx.Param("key")
 
-	rawItem, ok := cache.Get(key)
-	if !ok {
+	item, rev, ok := cache.GetRevision(key)
+	if !ok || !CanAccess(ctx, cache, item) {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
 			"key":     key,
@@ -90,20 +148,11 @@ func PrintItemByParam[T any](ctx *gin.Context, cache *Cache, pkgName string, mod
 		return
 	}
 
-	/*item, ok := rawItem.(T)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"key":     key,
-			"message": fmt.Sprintf("cannot assert data type, database internal error (type: %s)", reflect.TypeOf(rawItem)),
-			"package": pkgName,
-		})
-		return
-	}*/
+	ctx.Header("ETag", ETag(rev))
 
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
-		"item":    rawItem,
+		"item":    cache.View(ctx, item),
 		"key":     key,
 		"message": "ok, dumping item's contents",
 		"package": pkgName,
@@ -111,7 +160,7 @@ func PrintItemByParam[T any](ctx *gin.Context, cache *Cache, pkgName string, mod
 	return
 }
 
-func AddNewItem[T any](ctx *gin.Context, cache *Cache, pkgName string, model T) {
+func AddNewItem[T any](ctx *gin.Context, cache *Cache[T], pkgName string, model T) {
 	// Read the body
 	bodyBytes, err := ioutil.ReadAll(ctx.Request.Body)
 	if err != nil {
@@ -142,32 +191,23 @@ func AddNewItem[T any](ctx *gin.Context, cache *Cache, pkgName string, model T)
 
 	key := meta.ID
 
-	// Reset the body so it can be read again
-	ctx.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	model, err = DecodeItem[T](bodyBytes, nil)
+	if err != nil {
+		PrintDecodeError(ctx, http.StatusBadRequest, err, pkgName, key)
+		return
+	}
 
-	if err := ctx.BindJSON(&model); err != nil {
-		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-			"code":    http.StatusBadRequest,
-			"error":   err.Error(),
-			"key":     key,
-			"message": "cannot bind input JSON stream",
-			"package": pkgName,
-		})
+	if model, err = cache.Guard(ctx, model); err != nil {
+		PrintGuardError(ctx, err, pkgName, key)
 		return
 	}
 
-	// TODO: implement LoadOrStore() method
-	if _, found := cache.Get(key); found {
-		ctx.IndentedJSON(http.StatusConflict, gin.H{
-			"code":    http.StatusConflict,
-			"key":     key,
-			"message": "item already exists",
-			"package": pkgName,
-		})
+	if !CanAccess(ctx, cache, model) {
+		PrintOwnerScopeError(ctx, pkgName, key)
 		return
 	}
 
-	if saved := cache.Set(key, model); !saved {
+	if _, loaded, err := cache.LoadOrStore(ctx, key, model); err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"key":     key,
@@ -175,11 +215,19 @@ func AddNewItem[T any](ctx *gin.Context, cache *Cache, pkgName string, model T)
 			"package": pkgName,
 		})
 		return
+	} else if loaded {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{
+			"code":    http.StatusConflict,
+			"key":     key,
+			"message": "item already exists",
+			"package": pkgName,
+		})
+		return
 	}
 
 	ctx.IndentedJSON(http.StatusCreated, gin.H{
 		"code":    http.StatusCreated,
-		"item":    model,
+		"item":    cache.View(ctx, model),
 		"key":     key,
 		"message": "new item added",
 		"package": pkgName,
@@ -187,10 +235,11 @@ func AddNewItem[T any](ctx *gin.Context, cache *Cache, pkgName string, model T)
 	return
 }
 
-func UpdateItemByParam[T any](ctx *gin.Context, cache *Cache, pkgName string, model T) {
+func UpdateItemByParam[T any](ctx *gin.Context, cache *Cache[T], pkgName string, model T) {
 	key := ctx.Param("key")
 
-	if _, found := cache.Get(key); !found {
+	current, rev, found := cache.GetRevision(key)
+	if !found || !CanAccess(ctx, cache, current) {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
 			"key":     key,
@@ -200,18 +249,47 @@ func UpdateItemByParam[T any](ctx *gin.Context, cache *Cache, pkgName string, mo
 		return
 	}
 
-	if err := ctx.BindJSON(&model); err != nil {
+	if !IfMatch(ctx, rev) {
+		PrintRevisionConflict(ctx, pkgName, key)
+		return
+	}
+
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
 			"code":    http.StatusBadRequest,
 			"error":   err.Error(),
 			"key":     key,
-			"message": "cannot bind input JSON stream",
+			"message": "failed to read request body",
 			"package": pkgName,
 		})
 		return
 	}
 
-	if saved := cache.Set(key, model); !saved {
+	// The current item guards its read-only fields.
+	model, err = DecodeItem(body, &current)
+	if err != nil {
+		PrintDecodeError(ctx, http.StatusBadRequest, err, pkgName, key)
+		return
+	}
+
+	if model, err = cache.Guard(ctx, model); err != nil {
+		PrintGuardError(ctx, err, pkgName, key)
+		return
+	}
+
+	// The item cannot be handed over to another owner.
+	if !CanAccess(ctx, cache, model) {
+		PrintOwnerScopeError(ctx, pkgName, key)
+		return
+	}
+
+	// Do not overwrite (or resurrect) the item if it has been changed in the meantime.
+	newRev, err := cache.SetIfRevision(ctx, key, model, rev)
+	if errors.Is(err, ErrRevisionMismatch) || errors.Is(err, ErrItemNotFound) {
+		PrintRevisionConflict(ctx, pkgName, key)
+		return
+	} else if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"key":     key,
@@ -221,9 +299,11 @@ func UpdateItemByParam[T any](ctx *gin.Context, cache *Cache, pkgName string, mo
 		return
 	}
 
+	ctx.Header("ETag", ETag(newRev))
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
-		"item":    model,
+		"item":    cache.View(ctx, model),
 		"key":     key,
 		"message": "item updated",
 		"packege": pkgName,
@@ -231,10 +311,11 @@ func UpdateItemByParam[T any](ctx *gin.Context, cache *Cache, pkgName string, mo
 	return
 }
 
-func DeleteItemByParam(ctx *gin.Context, cache *Cache, pkgName string) {
+func DeleteItemByParam[T any](ctx *gin.Context, cache *Cache[T], pkgName string) {
 	key := ctx.Param("key")
 
-	if _, found := cache.Get(key); !found {
+	item, rev, found := cache.GetRevision(key)
+	if !found || !CanAccess(ctx, cache, item) {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
 			"key":     key,
@@ -244,7 +325,16 @@ func DeleteItemByParam(ctx *gin.Context, cache *Cache, pkgName string) {
 		return
 	}
 
-	if deleted := cache.Delete(key); !deleted {
+	if !IfMatch(ctx, rev) {
+		PrintRevisionConflict(ctx, pkgName, key)
+		return
+	}
+
+	err := cache.DeleteIfRevision(ctx, key, rev)
+	if errors.Is(err, ErrRevisionMismatch) || errors.Is(err, ErrItemNotFound) {
+		PrintRevisionConflict(ctx, pkgName, key)
+		return
+	} else if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"key":     key,
@@ -266,9 +356,25 @@ func DeleteItemByParam(ctx *gin.Context, cache *Cache, pkgName string) {
 func BatchRestoreItems[T any](ctx *gin.Context, pkg *RestorePackage) {
 	var counter []int
 
+	// Restoring replaces the items of all the owners.
+	if _, scoped := OwnerScope(ctx); scoped {
+		PrintOwnerScopeError(ctx, pkg.Name, "")
+		return
+	}
+
 	if len(pkg.Subpackages) == 0 {
 		counter = make([]int, 1)
 
+		cache, ok := pkg.Cache[0].(*Cache[T])
+		if !ok {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"code":    http.StatusInternalServerError,
+				"message": "cannot restore data: wrong package configuration",
+				"package": pkg.Name,
+			})
+			return
+		}
+
 		items := struct {
 			Items map[string]T `json:"items"`
 		}{}
@@ -283,13 +389,21 @@ func BatchRestoreItems[T any](ctx *gin.Context, pkg *RestorePackage) {
 			return
 		}
 
-		cache := *pkg.Cache[0]
-
 		for key, item := range items.Items {
 			if key == "" {
 				continue
 			}
-			cache.Set(key, item)
+
+			if !cache.SetContext(ctx, key, item) {
+				ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+					"code":    http.StatusInternalServerError,
+					"count":   counter,
+					"key":     key,
+					"message": "cannot save the restored items",
+					"package": pkg.Name,
+				})
+				return
+			}
 			counter[0]++
 		}
 
@@ -306,9 +420,9 @@ func BatchRestoreItems[T any](ctx *gin.Context, pkg *RestorePackage) {
 	//  restore subpackages' data
 	//
 
-	if len(pkg.Subpackages) != len(pkg.SubpackageModels) {
-		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-			"code":    http.StatusBadRequest,
+	if len(pkg.Subpackages) > len(pkg.Cache) {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
 			"message": "cannot restore data: wrong package configuration",
 			"package": pkg.Name,
 		})
@@ -317,9 +431,9 @@ func BatchRestoreItems[T any](ctx *gin.Context, pkg *RestorePackage) {
 
 	counter = make([]int, len(pkg.Subpackages))
 
-	var items map[string]interface{}
+	var items map[string]map[string]json.RawMessage
 
-	// Bind the raw data.
+	// Bind the raw data, each subpackage's cache decodes its own items.
 	if err := ctx.BindJSON(&items); err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
 			"code":    http.StatusBadRequest,
@@ -330,48 +444,35 @@ func BatchRestoreItems[T any](ctx *gin.Context, pkg *RestorePackage) {
 		return
 	}
 
-	for idx, subpkg := range pkg.Subpackages {
-		// Otherwise, we have to extract each subpackage's data manually.
+	loads := make([]*stagedLoad, len(pkg.Subpackages))
 
-		// Fetch a map of subpackage's data with the correct type of map's values.
-		subData, ok := assertSubpackageType(items[subpkg], pkg.SubpackageModels[subpkg])
-		if !ok {
+	// Decode all subpackages first, so that nothing is restored on invalid input.
+	for idx, subpkg := range pkg.Subpackages {
+		load, failures := pkg.Cache[idx].prepareLoad(ctx, items[subpkg], false, false)
+		if len(failures) > 0 {
 			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-				"code":    http.StatusInternalServerError,
-				"message": "cannot assert subpackage's root type to the subpackage's raw data",
-				"package": pkg.Name,
+				"code":     http.StatusBadRequest,
+				"failures": failures,
+				"message":  fmt.Sprintf("cannot decode '%s' subpackage's data", subpkg),
+				"package":  pkg.Name,
 			})
 			return
 		}
 
-		cache := *pkg.Cache[idx]
-
-		/*if reflect.TypeOf(subData).String() != fmt.Sprintf("map[string]%s", reflect.TypeOf(pkg.SubpackageModels[subpkg])) {
-			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-				"code":    http.StatusInternalServerError,
-				"message": fmt.Sprintf("invalid subpackage's data assertion: %s not %s", reflect.TypeOf(subData).String(), fmt.Sprintf("map[string]%s", reflect.TypeOf(pkg.SubpackageModels[subpkg]))),
-				"package": pkg.Name,
-			})
-			return
-		}*/
-
-		// Load subpackage's data in memory.
-		for key, item := range subData {
-			if key == "" {
-				continue
-			}
+		loads[idx] = load
+	}
 
-			ok = cache.Set(key, item)
-			if !ok {
-				ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": fmt.Sprintf("cannot save the item: %s", reflect.TypeOf(item)),
-					"package": pkg.Name,
-				})
-				return
-			}
-			counter[idx]++
-		}
+	// A failed write rolls back all the subpackages.
+	counter, err := storeAll(ctx, loads)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"count":   counter,
+			"error":   err.Error(),
+			"message": "cannot save the restored items",
+			"package": pkg.Name,
+		})
+		return
 	}
 
 	ctx.IndentedJSON(http.StatusCreated, gin.H{
@@ -383,34 +484,6 @@ func BatchRestoreItems[T any](ctx *gin.Context, pkg *RestorePackage) {
 	return
 }
 
-func assertSubpackageType[T any](input interface{}, model T) (map[string]T, bool) {
-	data, ok := input.(map[string]interface{})
-	if !ok {
-		fmt.Printf("cannot assert map[string]interface{}\n")
-		return nil, false
-	}
-
-	//fmt.Printf("%s\n", reflect.TypeOf(model))
-
-	output := make(map[string]T)
-
-	for k, v := range data {
-		value, ok := v.(T)
-		if !ok {
-			fmt.Printf("wrong type assertion: %s\n", reflect.TypeOf(value))
-			return nil, false
-		}
-
-		fmt.Printf("%s\n", reflect.TypeOf(value))
-
-		output[k] = value
-	}
-
-	//fmt.Printf("%s\n", reflect.TypeOf(output))
-
-	return output, true
-}
-
 func ParsePackageTypes(ctx *gin.Context, pkgName string, models ...interface{}) {
 	var types = make(map[string]map[string]FieldDetail)
 
@@ -465,6 +538,7 @@ func listFieldTypes(str interface{}) map[string]FieldDetail {
 		jsonTag := field.Tag.Get("json")
 		requiredTag := field.Tag.Get("required")
 		roTag := field.Tag.Get("readonly")
+		defaultTag := field.Tag.Get("default")
 
 		if fieldType.Kind() == reflect.Array || fieldType.Kind() == reflect.Slice {
 			elemType := fieldType.Elem()
@@ -491,6 +565,7 @@ func listFieldTypes(str interface{}) map[string]FieldDetail {
 			Type:     fmt.Sprintf("%s", fieldType),
 			Required: requiredTag == "true",
 			Readonly: roTag == "true",
+			Default:  defaultTag,
 		}
 	}
 
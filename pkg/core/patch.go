@@ -0,0 +1,454 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// MergePatchType is the media type of RFC 7396 JSON Merge Patch documents, the default for PATCH requests.
+	MergePatchType = "application/merge-patch+json"
+
+	// JSONPatchType is the media type of RFC 6902 JSON Patch documents.
+	JSONPatchType = "application/json-patch+json"
+)
+
+// PatchItemByParam applies the request's patch to the stored item. RFC 6902 JSON Patch is used when sent with
+// its media type, RFC 7396 JSON Merge Patch otherwise. The result has to be a valid model, fields omitted
+// in the patch are kept.
+func PatchItemByParam[T any](ctx *gin.Context, cache *Cache[T], pkgName string, model T) {
+	key := ctx.Param("key")
+
+	item, rev, found := cache.GetRevision(key)
+	if !found || !CanAccess(ctx, cache, item) {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"key":     key,
+			"message": "item not found",
+			"package": pkgName,
+		})
+		return
+	}
+
+	if !IfMatch(ctx, rev) {
+		PrintRevisionConflict(ctx, pkgName, key)
+		return
+	}
+
+	patch, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   err.Error(),
+			"key":     key,
+			"message": "failed to read request body",
+			"package": pkgName,
+		})
+		return
+	}
+
+	patched, err := applyPatch(item, patch, ctx.ContentType())
+	if err != nil {
+		ctx.IndentedJSON(http.StatusUnprocessableEntity, gin.H{
+			"code":    http.StatusUnprocessableEntity,
+			"error":   err.Error(),
+			"key":     key,
+			"message": "cannot apply the patch",
+			"package": pkgName,
+		})
+		return
+	}
+
+	// Decode into a fresh model, so that fields removed by the patch are zeroed.
+	newItem, err := DecodeItem(patched, &item)
+	if err != nil {
+		PrintDecodeError(ctx, http.StatusUnprocessableEntity, err, pkgName, key)
+		return
+	}
+
+	if newItem, err = cache.Guard(ctx, newItem); err != nil {
+		PrintGuardError(ctx, err, pkgName, key)
+		return
+	}
+
+	if !CanAccess(ctx, cache, newItem) {
+		PrintOwnerScopeError(ctx, pkgName, key)
+		return
+	}
+
+	newRev, err := cache.SetIfRevision(ctx, key, newItem, rev)
+	if errors.Is(err, ErrRevisionMismatch) || errors.Is(err, ErrItemNotFound) {
+		PrintRevisionConflict(ctx, pkgName, key)
+		return
+	} else if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"key":     key,
+			"message": "item couldn't be saved to database",
+			"package": pkgName,
+		})
+		return
+	}
+
+	ctx.Header("ETag", ETag(newRev))
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"item":    cache.View(ctx, newItem),
+		"key":     key,
+		"message": "item patched",
+		"package": pkgName,
+	})
+	return
+}
+
+// applyPatch applies the JSON-encoded patch of given media type to the item, it returns the patched JSON document.
+func applyPatch(item any, patch []byte, contentType string) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	doc, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	var target any
+	if err := decodeJSON(doc, &target); err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case JSONPatchType:
+		var ops []patchOperation
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return nil, fmt.Errorf("invalid JSON patch: %w", err)
+		}
+
+		if target, err = jsonPatch(target, ops); err != nil {
+			return nil, err
+		}
+
+	default:
+		var mergePatch any
+		if err := decodeJSON(patch, &mergePatch); err != nil {
+			return nil, fmt.Errorf("invalid merge patch: %w", err)
+		}
+
+		target = jsonMergePatch(target, mergePatch)
+	}
+
+	return json.Marshal(target)
+}
+
+// jsonMergePatch implements the RFC 7396 algorithm: objects are merged recursively, null removes the member,
+// any other value replaces the target.
+func jsonMergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any)
+	}
+
+	for name, value := range patchObj {
+		if value == nil {
+			delete(targetObj, name)
+			continue
+		}
+
+		targetObj[name] = jsonMergePatch(targetObj[name], value)
+	}
+
+	return targetObj
+}
+
+// patchOperation is a single RFC 6902 JSON Patch operation.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// jsonPatch applies all the operations in order, the whole patch fails if any of them does.
+func jsonPatch(doc any, ops []patchOperation) (any, error) {
+	var err error
+
+	for idx, op := range ops {
+		var value any
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d (%s): missing value", idx, op.Op)
+			}
+
+			if err := decodeJSON(op.Value, &value); err != nil {
+				return nil, fmt.Errorf("operation %d (%s): %w", idx, op.Op, err)
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			doc, err = pointerAdd(doc, op.Path, value)
+
+		case "remove":
+			doc, _, err = pointerRemove(doc, op.Path)
+
+		case "replace":
+			if doc, _, err = pointerRemove(doc, op.Path); err == nil {
+				doc, err = pointerAdd(doc, op.Path, value)
+			}
+
+		case "move":
+			var moved any
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				err = errors.New("cannot move a value into its own child")
+			} else if doc, moved, err = pointerRemove(doc, op.From); err == nil {
+				doc, err = pointerAdd(doc, op.Path, moved)
+			}
+
+		case "copy":
+			var copied any
+			if copied, err = pointerGet(doc, op.From); err == nil {
+				doc, err = pointerAdd(doc, op.Path, deepCopy(copied))
+			}
+
+		case "test":
+			var current any
+			if current, err = pointerGet(doc, op.Path); err == nil && !jsonEqual(current, value) {
+				err = errors.New("test failed")
+			}
+
+		default:
+			err = errors.New("unknown operation")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", idx, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// pointerTokens splits the RFC 6901 JSON pointer into unescaped reference tokens.
+func pointerTokens(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer '%s'", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for idx, token := range tokens {
+		tokens[idx] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex parses the array index token, '-' (past the end) is allowed when adding only.
+func arrayIndex(token string, length int, adding bool) (int, error) {
+	if adding && token == "-" {
+		return length, nil
+	}
+
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+
+	if idx > length || (!adding && idx == length) {
+		return 0, fmt.Errorf("array index %d out of bounds", idx)
+	}
+
+	return idx, nil
+}
+
+func pointerGet(doc any, pointer string) (any, error) {
+	tokens, err := pointerTokens(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member '%s' not found", token)
+			}
+			doc = value
+
+		case []any:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[idx]
+
+		default:
+			return nil, fmt.Errorf("cannot reference '%s' in a scalar value", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// pointerAdd adds (or sets an object member to) the value at such location, the parent has to exist.
+func pointerAdd(doc any, pointer string, value any) (any, error) {
+	tokens, err := pointerTokens(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return updateParent(doc, tokens, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+
+		case []any:
+			idx, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = value
+			return node, nil
+		}
+
+		return nil, fmt.Errorf("cannot add '%s' to a scalar value", token)
+	})
+}
+
+// pointerRemove removes the value at such location, it returns the removed value too.
+func pointerRemove(doc any, pointer string) (any, any, error) {
+	tokens, err := pointerTokens(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed any
+
+	doc, err = updateParent(doc, tokens, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member '%s' not found", token)
+			}
+
+			removed = value
+			delete(node, token)
+			return node, nil
+
+		case []any:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+
+			removed = node[idx]
+			return append(node[:idx], node[idx+1:]...), nil
+		}
+
+		return nil, fmt.Errorf("cannot remove '%s' from a scalar value", token)
+	})
+
+	return doc, removed, err
+}
+
+// updateParent walks to the parent of the pointed location and replaces it by the result of fn (arrays may be
+// reallocated on change).
+func updateParent(doc any, tokens []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	token := tokens[0]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("member '%s' not found", token)
+		}
+
+		child, err := updateParent(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+
+		node[token] = child
+		return node, nil
+
+	case []any:
+		idx, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := updateParent(node[idx], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+
+		node[idx] = child
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("cannot reference '%s' in a scalar value", token)
+}
+
+// deepCopy copies the decoded JSON value, so that copied members do not share maps and slices.
+func deepCopy(value any) any {
+	switch node := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(node))
+		for name, child := range node {
+			out[name] = deepCopy(child)
+		}
+		return out
+
+	case []any:
+		out := make([]any, len(node))
+		for idx, child := range node {
+			out[idx] = deepCopy(child)
+		}
+		return out
+	}
+
+	return value
+}
+
+// jsonEqual compares two decoded JSON values.
+func jsonEqual(a, b any) bool {
+	left, errA := json.Marshal(a)
+	right, errB := json.Marshal(b)
+
+	return errA == nil && errB == nil && string(left) == string(right)
+}
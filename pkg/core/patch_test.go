@@ -0,0 +1,102 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	// RFC 7396, appendix A
+	for _, tc := range []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{"replace a member", `{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{"add a member", `{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{"remove a member", `{"a": "b"}`, `{"a": null}`, `{}`},
+		{"remove one of members", `{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{"replace an array", `{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{"replace with an array", `{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{"merge nested objects", `{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{"arrays are not merged", `{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{"empty patch", `{"a": "b"}`, `{}`, `{"a": "b"}`},
+		{"null members of new objects are dropped", `{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+		{"replace a scalar with an object", `{"a": "foo"}`, `{"a": {"b": "c"}}`, `{"a": {"b": "c"}}`},
+		{"big numbers are kept", `{"a": 9007199254740993}`, `{"b": 1}`, `{"a": 9007199254740993, "b": 1}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var target map[string]any
+			assert.NoError(t, decodeJSON([]byte(tc.target), &target))
+
+			patched, err := applyPatch(target, []byte(tc.patch), MergePatchType)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.want, string(patched))
+		})
+	}
+
+	_, err := applyPatch(map[string]any{}, []byte(`{"a": `), MergePatchType)
+	assert.Error(t, err)
+}
+
+func TestJSONPatch(t *testing.T) {
+	const target = `{"name": "a", "tags": ["x", "y"], "vm": {"os": "linux"}, "a/b": 1, "m~n": 2}`
+
+	for _, tc := range []struct {
+		name  string
+		patch string
+		want  string
+		err   bool
+	}{
+		{"add a member", `[{"op": "add", "path": "/count", "value": 1}]`,
+			`{"name": "a", "tags": ["x", "y"], "vm": {"os": "linux"}, "a/b": 1, "m~n": 2, "count": 1}`, false},
+		{"add replaces an existing member", `[{"op": "add", "path": "/name", "value": "b"}]`,
+			`{"name": "b", "tags": ["x", "y"], "vm": {"os": "linux"}, "a/b": 1, "m~n": 2}`, false},
+		{"insert into an array", `[{"op": "add", "path": "/tags/1", "value": "z"}]`,
+			`{"name": "a", "tags": ["x", "z", "y"], "vm": {"os": "linux"}, "a/b": 1, "m~n": 2}`, false},
+		{"append to an array", `[{"op": "add", "path": "/tags/-", "value": "z"}]`,
+			`{"name": "a", "tags": ["x", "y", "z"], "vm": {"os": "linux"}, "a/b": 1, "m~n": 2}`, false},
+		{"add past the array end", `[{"op": "add", "path": "/tags/3", "value": "z"}]`, "", true},
+		{"add with a leading zero index", `[{"op": "add", "path": "/tags/01", "value": "z"}]`, "", true},
+		{"add to a missing parent", `[{"op": "add", "path": "/missing/os", "value": "z"}]`, "", true},
+		{"add without a value", `[{"op": "add", "path": "/count"}]`, "", true},
+		{"add a null value", `[{"op": "add", "path": "/vm/os", "value": null}]`,
+			`{"name": "a", "tags": ["x", "y"], "vm": {"os": null}, "a/b": 1, "m~n": 2}`, false},
+		{"remove a member", `[{"op": "remove", "path": "/vm/os"}]`,
+			`{"name": "a", "tags": ["x", "y"], "vm": {}, "a/b": 1, "m~n": 2}`, false},
+		{"remove an array element", `[{"op": "remove", "path": "/tags/0"}]`,
+			`{"name": "a", "tags": ["y"], "vm": {"os": "linux"}, "a/b": 1, "m~n": 2}`, false},
+		{"remove a missing member", `[{"op": "remove", "path": "/missing"}]`, "", true},
+		{"remove past the array end", `[{"op": "remove", "path": "/tags/-"}]`, "", true},
+		{"escaped tokens", `[{"op": "remove", "path": "/a~1b"}, {"op": "replace", "path": "/m~0n", "value": 3}]`,
+			`{"name": "a", "tags": ["x", "y"], "vm": {"os": "linux"}, "m~n": 3}`, false},
+		{"replace a missing member", `[{"op": "replace", "path": "/missing", "value": 1}]`, "", true},
+		{"move a member", `[{"op": "move", "from": "/vm/os", "path": "/os"}]`,
+			`{"name": "a", "tags": ["x", "y"], "vm": {}, "os": "linux", "a/b": 1, "m~n": 2}`, false},
+		{"move into its own child", `[{"op": "move", "from": "/vm", "path": "/vm/inner"}]`, "", true},
+		{"copy a member", `[{"op": "copy", "from": "/tags", "path": "/labels"}, {"op": "add", "path": "/labels/-", "value": "z"}]`,
+			`{"name": "a", "tags": ["x", "y"], "labels": ["x", "y", "z"], "vm": {"os": "linux"}, "a/b": 1, "m~n": 2}`, false},
+		{"passed test", `[{"op": "test", "path": "/tags", "value": ["x", "y"]}]`, target, false},
+		{"failed test", `[{"op": "test", "path": "/name", "value": "b"}]`, "", true},
+		{"failed test drops the earlier operations", `[{"op": "add", "path": "/count", "value": 1}, {"op": "test", "path": "/count", "value": 2}]`, "", true},
+		{"unknown operation", `[{"op": "merge", "path": "/name", "value": "b"}]`, "", true},
+		{"invalid pointer", `[{"op": "remove", "path": "name"}]`, "", true},
+		{"not an array of operations", `{"op": "remove", "path": "/name"}`, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc map[string]any
+			assert.NoError(t, decodeJSON([]byte(target), &doc))
+
+			patched, err := applyPatch(doc, []byte(tc.patch), JSONPatchType)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.want, string(patched))
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package core
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Reserved query parameters of list endpoints, any other parameter is a field filter.
+const (
+	QuerySort   = "sort"
+	QueryLimit  = "limit"
+	QueryCursor = "cursor"
+	QueryFields = "fields"
+)
+
+// QueryKeyField is the pseudo-field referencing the item's key in filters and sort keys.
+const QueryKeyField = "key"
+
+// Query describes the subset of items listed: field filters, sort keys, a page and the projected fields. Fields
+// are referenced by their JSON names, nested ones by a dotted path (e.g. vm_info.os).
+type Query struct {
+	// Filters maps the field to its accepted values, an item has to match every field (any of its values).
+	Filters map[string][]string
+
+	// Sort lists the sort keys in order, the item key always breaks the ties.
+	Sort []SortKey
+
+	// Limit is the page size, zero means no limit.
+	Limit int
+
+	// Cursor continues the listing after the last item of the previous page.
+	Cursor string
+
+	// Fields lists the fields to keep in the items, all fields are kept when empty.
+	Fields []string
+}
+
+// SortKey is a single field to sort by.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// QueryResult is a single page of the queried items.
+type QueryResult struct {
+	// Items holds the page's items, projected ones are decoded JSON objects.
+	Items map[string]any
+
+	// Keys lists the page's item keys in order.
+	Keys []string
+
+	// Total is the count of all matching items.
+	Total int
+
+	// NextCursor continues the listing on the next page, empty on the last one.
+	NextCursor string
+}
+
+// Empty reports whether the query changes nothing about the plain listing of all items.
+func (q *Query) Empty() bool {
+	return len(q.Filters) == 0 && len(q.Sort) == 0 && q.Limit == 0 && q.Cursor == "" && len(q.Fields) == 0
+}
+
+// ParseQuery reads the query from URL parameters, referenced fields have to exist in the model.
+func ParseQuery(values url.Values, model any) (*Query, error) {
+	fields := modelFields(model)
+
+	checkField := func(field string) error {
+		root, _, _ := strings.Cut(field, ".")
+		if field == QueryKeyField || fields[root] {
+			return nil
+		}
+
+		return fmt.Errorf("unknown field '%s'", field)
+	}
+
+	query := &Query{Filters: make(map[string][]string)}
+
+	for param, vals := range values {
+		switch param {
+		case QuerySort:
+			for _, field := range splitList(vals) {
+				key := SortKey{Field: field}
+				if strings.HasPrefix(field, "-") {
+					key = SortKey{Field: field[1:], Desc: true}
+				}
+
+				if err := checkField(key.Field); err != nil {
+					return nil, err
+				}
+
+				query.Sort = append(query.Sort, key)
+			}
+
+		case QueryLimit:
+			limit, err := strconv.Atoi(vals[len(vals)-1])
+			if err != nil || limit < 0 {
+				return nil, fmt.Errorf("invalid limit '%s'", vals[len(vals)-1])
+			}
+
+			query.Limit = limit
+
+		case QueryCursor:
+			query.Cursor = vals[len(vals)-1]
+
+		case QueryFields:
+			for _, field := range splitList(vals) {
+				if err := checkField(field); err != nil {
+					return nil, err
+				}
+
+				query.Fields = append(query.Fields, field)
+			}
+
+		default:
+			if err := checkField(param); err != nil {
+				return nil, err
+			}
+
+			query.Filters[param] = vals
+		}
+	}
+
+	return query, nil
+}
+
+// RunQuery filters, sorts and pages the items.
+func RunQuery[T any](items map[string]T, query *Query) (*QueryResult, error) {
+	type row struct {
+		key  string
+		item T
+		doc  map[string]any
+	}
+
+	rows := make([]row, 0, len(items))
+
+	for key, item := range items {
+		doc, err := toDocument(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if !matchFilters(key, doc, query.Filters) {
+			continue
+		}
+
+		rows = append(rows, row{key: key, item: item, doc: doc})
+	}
+
+	sortValues := func(r row) []any {
+		values := make([]any, len(query.Sort)+1)
+		for idx, key := range query.Sort {
+			values[idx] = lookupField(r.key, r.doc, key.Field)
+		}
+		values[len(query.Sort)] = r.key
+		return values
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return compareSortValues(sortValues(rows[i]), sortValues(rows[j]), query.Sort) < 0
+	})
+
+	result := &QueryResult{
+		Items: make(map[string]any),
+		Keys:  []string{},
+		Total: len(rows),
+	}
+
+	// Skip the rows up to the cursor, which holds the sort values of the previous page's last item.
+	if query.Cursor != "" {
+		after, err := decodeCursor(query.Cursor, len(query.Sort)+1)
+		if err != nil {
+			return nil, err
+		}
+
+		rows = rows[sort.Search(len(rows), func(i int) bool {
+			return compareSortValues(sortValues(rows[i]), after, query.Sort) > 0
+		}):]
+	}
+
+	if query.Limit > 0 && len(rows) > query.Limit {
+		rows = rows[:query.Limit]
+		result.NextCursor = encodeCursor(sortValues(rows[len(rows)-1]))
+	}
+
+	for _, r := range rows {
+		result.Keys = append(result.Keys, r.key)
+
+		if len(query.Fields) == 0 {
+			result.Items[r.key] = r.item
+			continue
+		}
+
+		projected := make(map[string]any)
+		for _, field := range query.Fields {
+			if value := lookupField(r.key, r.doc, field); value != nil {
+				setField(projected, field, value)
+			}
+		}
+		result.Items[r.key] = projected
+	}
+
+	return result, nil
+}
+
+// modelFields returns the top-level JSON field names of the model.
+func modelFields(model any) map[string]bool {
+	fields := make(map[string]bool)
+
+	typ := reflect.TypeOf(model)
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+
+		fields[name] = true
+	}
+
+	return fields
+}
+
+// splitList flattens the comma-separated list parameters.
+func splitList(vals []string) []string {
+	var list []string
+
+	for _, val := range vals {
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
+
+// toDocument decodes the item's JSON encoding into a generic object.
+func toDocument(item any) (map[string]any, error) {
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+	if err := decodeJSON(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// decodeJSON decodes the data keeping the numbers as json.Number, so that large integers (e.g. UNIX nano
+// timestamps) do not lose precision as float64.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	if dec.More() {
+		return errors.New("invalid character after top-level value")
+	}
+
+	return nil
+}
+
+// lookupField returns the value at the dotted path, nil when missing.
+func lookupField(key string, doc map[string]any, field string) any {
+	if field == QueryKeyField {
+		return key
+	}
+
+	var value any = doc
+	for _, name := range strings.Split(field, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = obj[name]
+	}
+
+	return value
+}
+
+// setField sets the value at the dotted path, creating the intermediate objects.
+func setField(doc map[string]any, field string, value any) {
+	names := strings.Split(field, ".")
+
+	for _, name := range names[:len(names)-1] {
+		child, ok := doc[name].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			doc[name] = child
+		}
+		doc = child
+	}
+
+	doc[names[len(names)-1]] = value
+}
+
+func matchFilters(key string, doc map[string]any, filters map[string][]string) bool {
+	for field, accepted := range filters {
+		if !matchValue(lookupField(key, doc, field), accepted) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchValue reports whether the value equals any of the accepted ones, arrays match by any of their elements.
+func matchValue(value any, accepted []string) bool {
+	if list, ok := value.([]any); ok {
+		for _, elem := range list {
+			if matchValue(elem, accepted) {
+				return true
+			}
+		}
+		return false
+	}
+
+	str := formatValue(value)
+	for _, want := range accepted {
+		if str == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+// formatValue renders the decoded JSON scalar the way it is written in the URL query.
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	}
+
+	raw, _ := json.Marshal(value)
+	return string(raw)
+}
+
+// compareSortValues compares the sort values of two items, the last value (item key) is always ascending.
+func compareSortValues(a, b []any, keys []SortKey) int {
+	for idx := range a {
+		cmp := compareValues(a[idx], b[idx])
+		if idx < len(keys) && keys[idx].Desc {
+			cmp = -cmp
+		}
+
+		if cmp != 0 {
+			return cmp
+		}
+	}
+
+	return 0
+}
+
+// compareValues orders the decoded JSON values: missing ones first, then booleans, numbers, strings and the rest.
+func compareValues(a, b any) int {
+	rank := func(value any) int {
+		switch value.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case json.Number:
+			return 2
+		case string:
+			return 3
+		}
+		return 4
+	}
+
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch va := a.(type) {
+	case nil:
+		return 0
+	case bool:
+		vb := b.(bool)
+		if va == vb {
+			return 0
+		} else if !va {
+			return -1
+		}
+		return 1
+	case json.Number:
+		return compareNumbers(va, b.(json.Number))
+	case string:
+		return strings.Compare(va, b.(string))
+	}
+
+	return strings.Compare(formatValue(a), formatValue(b))
+}
+
+// compareNumbers compares the numbers as integers if both are, as floats otherwise.
+func compareNumbers(a, b json.Number) int {
+	if ia, err := a.Int64(); err == nil {
+		if ib, err := b.Int64(); err == nil {
+			return cmp.Compare(ia, ib)
+		}
+	}
+
+	fa, _ := a.Float64()
+	fb, _ := b.Float64()
+	return cmp.Compare(fa, fb)
+}
+
+func encodeCursor(values []any) string {
+	raw, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string, length int) ([]any, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var values []any
+	if err := decodeJSON(raw, &values); err != nil || len(values) != length {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return values, nil
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		query string
+		want  *Query
+		err   bool
+	}{
+		{"empty", "", &Query{Filters: map[string][]string{}}, false},
+		{"filters", "owner=alice&owner=bob&name=a", &Query{Filters: map[string][]string{"owner": {"alice", "bob"}, "name": {"a"}}}, false},
+		{"sort keys", "sort=-count,key", &Query{Filters: map[string][]string{}, Sort: []SortKey{{Field: "count", Desc: true}, {Field: "key"}}}, false},
+		{"page", "limit=2&cursor=abc", &Query{Filters: map[string][]string{}, Limit: 2, Cursor: "abc"}, false},
+		{"fields", "fields=name&fields=count", &Query{Filters: map[string][]string{}, Fields: []string{"name", "count"}}, false},
+		{"unknown filter", "color=red", nil, true},
+		{"unknown sort key", "sort=-color", nil, true},
+		{"unknown field", "fields=name,color", nil, true},
+		{"negative limit", "limit=-1", nil, true},
+		{"invalid limit", "limit=ten", nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tc.query)
+			assert.NoError(t, err)
+
+			query, err := ParseQuery(values, testItem{})
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, query)
+		})
+	}
+}
+
+func TestRunQueryPaging(t *testing.T) {
+	items := map[string]testItem{
+		"a": {Name: "a", Owner: "alice", Count: 3, Tags: []string{"x"}},
+		"b": {Name: "b", Owner: "bob", Count: 1},
+		"c": {Name: "c", Owner: "alice", Count: 2, Tags: []string{"x", "y"}},
+		"d": {Name: "d", Owner: "alice", Count: 2},
+		"e": {Name: "e", Owner: "carol", Count: 5, Tags: []string{"y"}},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query Query
+		pages [][]string
+		total int
+	}{
+		{"by key", Query{Limit: 2}, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, 5},
+		{"by count, ties broken by key", Query{Sort: []SortKey{{Field: "count"}}, Limit: 2}, [][]string{{"b", "c"}, {"d", "a"}, {"e"}}, 5},
+		{"descending", Query{Sort: []SortKey{{Field: "count", Desc: true}}, Limit: 3}, [][]string{{"e", "a", "c"}, {"d", "b"}}, 5},
+		{"filtered", Query{Filters: map[string][]string{"owner": {"alice"}}, Limit: 2}, [][]string{{"a", "c"}, {"d"}}, 3},
+		{"filtered by an array", Query{Filters: map[string][]string{"tags": {"y"}}, Limit: 1}, [][]string{{"c"}, {"e"}}, 2},
+		{"single page", Query{Limit: 5}, [][]string{{"a", "b", "c", "d", "e"}}, 5},
+		{"no limit", Query{}, [][]string{{"a", "b", "c", "d", "e"}}, 5},
+		{"no match", Query{Filters: map[string][]string{"owner": {"dave"}}, Limit: 2}, [][]string{{}}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			query := tc.query
+
+			for idx, page := range tc.pages {
+				result, err := RunQuery(items, &query)
+				assert.NoError(t, err)
+				assert.Equal(t, page, result.Keys)
+				assert.Equal(t, tc.total, result.Total)
+
+				if idx == len(tc.pages)-1 {
+					assert.Empty(t, result.NextCursor)
+					break
+				}
+
+				assert.NotEmpty(t, result.NextCursor)
+				query.Cursor = result.NextCursor
+			}
+		})
+	}
+
+	// the cursor continues after the last item listed even if it has been removed meanwhile
+	query := Query{Sort: []SortKey{{Field: "count"}}, Limit: 2}
+
+	result, err := RunQuery(items, &query)
+	assert.NoError(t, err)
+
+	changed := map[string]testItem{}
+	for key, item := range items {
+		changed[key] = item
+	}
+	delete(changed, "c")
+	changed["f"] = testItem{Name: "f", Count: 0}
+
+	query.Cursor = result.NextCursor
+	result, err = RunQuery(changed, &query)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "a"}, result.Keys)
+
+	for _, cursor := range []string{"not base64!", encodeCursor([]any{1})} {
+		_, err := RunQuery(items, &Query{Sort: []SortKey{{Field: "count"}}, Cursor: cursor})
+		assert.Error(t, err, cursor)
+	}
+
+	// the projection keeps the listed fields only
+	result, err = RunQuery(items, &Query{Filters: map[string][]string{"name": {"e"}}, Fields: []string{"name", "count"}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"e": {"name": "e", "count": 5}}`, encodeTestJSON(t, result.Items))
+}
+
+// encodeTestJSON returns the JSON encoding of the value.
+func encodeTestJSON(t *testing.T, value any) string {
+	data, err := json.Marshal(value)
+	assert.NoError(t, err)
+
+	return string(data)
+}
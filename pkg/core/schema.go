@@ -0,0 +1,193 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JSONSchemaDialect is the JSON Schema version of the generated schemas, it matches the one of OpenAPI 3.1.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaBuilder converts the models to JSON schemas, named struct types are collected as definitions and referenced.
+type schemaBuilder struct {
+	// refPrefix is prepended to the definition names in references (e.g. #/$defs/).
+	refPrefix string
+
+	defs map[string]any
+}
+
+func newSchemaBuilder(refPrefix string) *schemaBuilder {
+	return &schemaBuilder{refPrefix: refPrefix, defs: make(map[string]any)}
+}
+
+// JSONSchema returns the standalone JSON schema of the model, nested named types are listed in $defs.
+func JSONSchema(model any) map[string]any {
+	return jsonSchemaOf(reflect.TypeOf(model))
+}
+
+func jsonSchemaOf(typ reflect.Type) map[string]any {
+	b := newSchemaBuilder("#/$defs/")
+
+	schema := map[string]any{"$schema": JSONSchemaDialect}
+
+	// Inline the root type, only the nested types are referenced.
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() == reflect.Struct && typ != reflect.TypeFor[time.Time]() {
+		for name, value := range b.structSchema(typ) {
+			schema[name] = value
+		}
+		schema["title"] = schemaName(typ)
+	} else {
+		for name, value := range b.schema(typ) {
+			schema[name] = value
+		}
+	}
+
+	if len(b.defs) > 0 {
+		schema["$defs"] = b.defs
+	}
+
+	return schema
+}
+
+// schemaName names the type after its package, e.g. dish.Socket.
+func schemaName(typ reflect.Type) string {
+	pkg := typ.PkgPath()
+	if idx := strings.LastIndex(pkg, "/"); idx >= 0 {
+		pkg = pkg[idx+1:]
+	}
+
+	if pkg == "" {
+		return typ.Name()
+	}
+
+	return pkg + "." + typ.Name()
+}
+
+// ref returns the reference to the named struct type, its definition is built on the first use.
+func (b *schemaBuilder) ref(typ reflect.Type) map[string]any {
+	name := schemaName(typ)
+
+	if _, ok := b.defs[name]; !ok {
+		// Reserve the name first, so that recursive types terminate.
+		b.defs[name] = nil
+		b.defs[name] = b.structSchema(typ)
+	}
+
+	return map[string]any{"$ref": b.refPrefix + name}
+}
+
+func (b *schemaBuilder) schema(typ reflect.Type) map[string]any {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch typ {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+
+	case reflect.TypeFor[json.RawMessage]():
+		return map[string]any{}
+
+	case reflect.TypeFor[Secret]():
+		return map[string]any{"type": "string", "format": "password"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer"}
+
+	case reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+
+	case reflect.String:
+		return map[string]any{"type": "string"}
+
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(typ.Elem())}
+
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(typ.Elem())}
+
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return b.structSchema(typ)
+		}
+		return b.ref(typ)
+	}
+
+	// Interfaces (any) accept any value.
+	return map[string]any{}
+}
+
+// structSchema describes the struct's JSON fields, the required, readonly and default tags are reflected as well.
+func (b *schemaBuilder) structSchema(typ reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+
+		prop := b.schema(field.Type)
+
+		// Annotations cannot be siblings of a reference in older tools, wrap it.
+		if _, ok := prop["$ref"]; ok {
+			prop = map[string]any{"allOf": []any{prop}}
+		}
+
+		if field.Tag.Get("readonly") == "true" {
+			prop["readOnly"] = true
+		}
+
+		if def, ok := field.Tag.Lookup("default"); ok {
+			if value, err := parseDefault(field.Type, def); err == nil {
+				prop["default"] = value
+			}
+		}
+
+		if field.Tag.Get("required") == "true" || strings.Contains(field.Tag.Get("binding"), "required") {
+			required = append(required, name)
+		}
+
+		properties[name] = prop
+	}
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
@@ -0,0 +1,561 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// sealedPrefix marks the encrypted form of a secret: enc:v1:<base64 of the nonce and the AES-GCM ciphertext>.
+	sealedPrefix = "enc:v1:"
+
+	// RedactedSecret replaces the secrets in the served items.
+	RedactedSecret = "********"
+)
+
+var (
+	// ErrSecretKey is returned when a sealed secret cannot be opened, as the key is missing or another one.
+	ErrSecretKey = errors.New("cannot decrypt the secret, check SECRETS_KEY")
+
+	// ErrCacheNotFound is returned when there is no mounted cache of such name.
+	ErrCacheNotFound = errors.New("cache not found")
+
+	// ErrRedactedSecret is returned when a redacted secret is submitted with no current value to keep.
+	ErrRedactedSecret = errors.New("cannot store the redacted secret, submit the clear value")
+)
+
+// secretAEAD seals the secrets, nil means no key is set and the secrets are kept in clear text.
+var secretAEAD cipher.AEAD
+
+// SetSecretKey sets the master key the secrets are encrypted with, it has to be set before the caches are loaded.
+// The AES-256 key is derived from the string, so use a long random one. Blank key disables the encryption.
+func SetSecretKey(key string) error {
+	if key == "" {
+		secretAEAD = nil
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	secretAEAD = aead
+	return nil
+}
+
+// Secret is a string field encrypted at rest. It is held in clear text in memory only: the JSON form (stored,
+// logged and dumped) is the sealed one, the served items carry the RedactedSecret marker (see Cache.View). The clear
+// value is accepted on input. Use RevealSecrets to read it over the API.
+type Secret struct {
+	value    string
+	sealed   string
+	redacted bool
+}
+
+// NewSecret seals the value with the current key.
+func NewSecret(value string) (Secret, error) {
+	s := Secret{value: value}
+	if value == "" || secretAEAD == nil {
+		return s, nil
+	}
+
+	nonce := make([]byte, secretAEAD.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return Secret{}, err
+	}
+
+	s.sealed = sealedPrefix + base64.RawStdEncoding.EncodeToString(secretAEAD.Seal(nonce, nonce, []byte(value), nil))
+	return s, nil
+}
+
+// Reveal returns the clear value.
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+// String redacts the value, so that it does not leak to the logs.
+func (s Secret) String() string {
+	if s.value == "" && !s.redacted {
+		return ""
+	}
+	return RedactedSecret
+}
+
+// MarshalJSON returns the sealed value, or the RedactedSecret marker of a served item. The clear value is stored
+// only when no key is set at all (the encryption is disabled then).
+func (s Secret) MarshalJSON() ([]byte, error) {
+	switch {
+	case s.redacted:
+		return json.Marshal(RedactedSecret)
+
+	case s.sealed != "" || s.value == "":
+		return json.Marshal(s.sealed)
+
+	case secretAEAD != nil:
+		// The value was set before the key, it is sealed now.
+		sealed, err := NewSecret(s.value)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(sealed.sealed)
+	}
+
+	return json.Marshal(s.value)
+}
+
+// UnmarshalJSON opens the sealed value, a clear value is sealed. The RedactedSecret marker is refused, DecodeItem
+// replaces it with the current value beforehand.
+func (s *Secret) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if raw == RedactedSecret {
+		return ErrRedactedSecret
+	}
+
+	sealed, ok := strings.CutPrefix(raw, sealedPrefix)
+	if !ok {
+		secret, err := NewSecret(raw)
+		if err != nil {
+			return err
+		}
+
+		*s = secret
+		return nil
+	}
+
+	if secretAEAD == nil {
+		return ErrSecretKey
+	}
+
+	box, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(box) < secretAEAD.NonceSize() {
+		return ErrSecretKey
+	}
+
+	size := secretAEAD.NonceSize()
+
+	value, err := secretAEAD.Open(nil, box[:size], box[size:], nil)
+	if err != nil {
+		return ErrSecretKey
+	}
+
+	*s = Secret{value: string(value), sealed: raw}
+	return nil
+}
+
+// RevealSecrets returns the clear values of the item's secret fields by their dotted JSON paths (e.g.
+// wireguard_profiles.laptop.private_key).
+func RevealSecrets(cacheName, key string) (map[string]string, error) {
+	cache, ok := registry[cacheName]
+	if !ok {
+		return nil, ErrCacheNotFound
+	}
+
+	return cache.secrets(key)
+}
+
+func (c *Cache[T]) secrets(key string) (map[string]string, error) {
+	item, ok := c.Get(key)
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+
+	found := make(map[string]string)
+	collectSecrets(reflect.ValueOf(item), "", found)
+
+	return found, nil
+}
+
+// secretTypes caches whether the types hold a Secret, see hasSecrets.
+var secretTypes sync.Map
+
+// hasSecrets reports whether the values of such type can hold a Secret.
+func hasSecrets(typ reflect.Type) bool {
+	if found, ok := secretTypes.Load(typ); ok {
+		return found.(bool)
+	}
+
+	found := typeHasSecrets(typ, map[reflect.Type]bool{})
+	secretTypes.Store(typ, found)
+
+	return found
+}
+
+func typeHasSecrets(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	if typ == reflect.TypeFor[Secret]() {
+		return true
+	}
+	if seen[typ] {
+		return false
+	}
+	seen[typ] = true
+
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return typeHasSecrets(typ.Elem(), seen)
+
+	case reflect.Map:
+		return typeHasSecrets(typ.Key(), seen) || typeHasSecrets(typ.Elem(), seen)
+
+	case reflect.Struct:
+		for idx := 0; idx < typ.NumField(); idx++ {
+			if field := typ.Field(idx); field.IsExported() && typeHasSecrets(field.Type, seen) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// redactSecrets returns a copy of the item with its secrets replaced by the RedactedSecret marker, the item itself
+// (its maps and slices included) is left as is.
+func redactSecrets[T any](item T) T {
+	if !hasSecrets(reflect.TypeFor[T]()) {
+		return item
+	}
+
+	return redactValue(reflect.ValueOf(&item).Elem()).Interface().(T)
+}
+
+func redactValue(val reflect.Value) reflect.Value {
+	typ := val.Type()
+
+	if secret, ok := val.Interface().(Secret); ok {
+		return reflect.ValueOf(Secret{redacted: secret.value != "" || secret.sealed != ""})
+	}
+
+	if !hasSecrets(typ) {
+		return val
+	}
+
+	switch typ.Kind() {
+	case reflect.Pointer:
+		if val.IsNil() {
+			return val
+		}
+
+		copied := reflect.New(typ.Elem())
+		copied.Elem().Set(redactValue(val.Elem()))
+		return copied
+
+	case reflect.Struct:
+		copied := reflect.New(typ).Elem()
+		copied.Set(val)
+
+		for idx := 0; idx < typ.NumField(); idx++ {
+			if typ.Field(idx).IsExported() {
+				copied.Field(idx).Set(redactValue(val.Field(idx)))
+			}
+		}
+		return copied
+
+	case reflect.Slice:
+		if val.IsNil() {
+			return val
+		}
+
+		copied := reflect.MakeSlice(typ, val.Len(), val.Len())
+		for idx := 0; idx < val.Len(); idx++ {
+			copied.Index(idx).Set(redactValue(val.Index(idx)))
+		}
+		return copied
+
+	case reflect.Array:
+		copied := reflect.New(typ).Elem()
+		for idx := 0; idx < val.Len(); idx++ {
+			copied.Index(idx).Set(redactValue(val.Index(idx)))
+		}
+		return copied
+
+	case reflect.Map:
+		if val.IsNil() {
+			return val
+		}
+
+		copied := reflect.MakeMapWithSize(typ, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), redactValue(iter.Value()))
+		}
+		return copied
+	}
+
+	return val
+}
+
+// keepRedactedSecrets replaces the RedactedSecret markers at the secret fields of the submitted JSON document (of
+// such type) with the current item's values, so that a served item can be sent back as it is. The list elements are
+// matched to the current ones by their `key` tagged field, or else by all their other fields being unchanged. The
+// markers with no current value are left as they are, to be refused.
+func keepRedactedSecrets(typ reflect.Type, doc, current any) any {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ == reflect.TypeFor[Secret]() {
+		if doc == RedactedSecret && current != nil {
+			return current
+		}
+		return doc
+	}
+
+	if !hasSecrets(typ) {
+		return doc
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return doc
+		}
+		currentObj, _ := current.(map[string]any)
+
+		for idx := 0; idx < typ.NumField(); idx++ {
+			field := typ.Field(idx)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			switch name {
+			case "-":
+				continue
+			case "":
+				name = field.Name
+			}
+
+			if value, ok := obj[name]; ok {
+				obj[name] = keepRedactedSecrets(field.Type, value, currentObj[name])
+			}
+		}
+
+	case reflect.Map:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return doc
+		}
+		currentObj, _ := current.(map[string]any)
+
+		for key, value := range obj {
+			obj[key] = keepRedactedSecrets(typ.Elem(), value, currentObj[key])
+		}
+
+	case reflect.Slice, reflect.Array:
+		arr, ok := doc.([]any)
+		if !ok {
+			return doc
+		}
+		currentArr, _ := current.([]any)
+
+		for idx, value := range arr {
+			arr[idx] = keepRedactedSecrets(typ.Elem(), value, matchElement(typ.Elem(), value, currentArr))
+		}
+	}
+
+	return doc
+}
+
+// matchElement returns the current list element the submitted one stands for: the one of the same `key` tagged
+// field, or else the only one whose fields other than the secrets are all unchanged. Nil is returned when there is
+// no such element.
+func matchElement(typ reflect.Type, value any, current []any) any {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	obj, ok := value.(map[string]any)
+	if !ok || typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	keyName := ""
+	for idx := 0; idx < typ.NumField(); idx++ {
+		if field := typ.Field(idx); field.Tag.Get("key") == "true" {
+			keyName, _, _ = strings.Cut(field.Tag.Get("json"), ",")
+			if keyName == "" {
+				keyName = field.Name
+			}
+			break
+		}
+	}
+
+	if keyName != "" && obj[keyName] == nil {
+		return nil
+	}
+
+	var match any
+	found := 0
+
+	for _, elem := range current {
+		currentObj, ok := elem.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if keyName != "" && !jsonEqual(obj[keyName], currentObj[keyName]) {
+			continue
+		}
+		if keyName == "" && !jsonEqual(withoutSecrets(typ, obj), withoutSecrets(typ, currentObj)) {
+			continue
+		}
+
+		match = elem
+		found++
+	}
+
+	if found != 1 {
+		return nil
+	}
+	return match
+}
+
+// withoutSecrets returns a copy of the JSON document (of such type) with its secret fields left out.
+func withoutSecrets(typ reflect.Type, doc any) any {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if !hasSecrets(typ) {
+		return doc
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return doc
+		}
+
+		copied := make(map[string]any, len(obj))
+		for key, value := range obj {
+			copied[key] = value
+		}
+
+		for idx := 0; idx < typ.NumField(); idx++ {
+			field := typ.Field(idx)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			switch name {
+			case "-":
+				continue
+			case "":
+				name = field.Name
+			}
+
+			if field.Type == reflect.TypeFor[Secret]() {
+				delete(copied, name)
+			} else if value, ok := copied[name]; ok {
+				copied[name] = withoutSecrets(field.Type, value)
+			}
+		}
+		return copied
+
+	case reflect.Map:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return doc
+		}
+
+		copied := make(map[string]any, len(obj))
+		for key, value := range obj {
+			copied[key] = withoutSecrets(typ.Elem(), value)
+		}
+		return copied
+
+	case reflect.Slice, reflect.Array:
+		arr, ok := doc.([]any)
+		if !ok {
+			return doc
+		}
+
+		copied := make([]any, len(arr))
+		for idx, value := range arr {
+			copied[idx] = withoutSecrets(typ.Elem(), value)
+		}
+		return copied
+	}
+
+	return doc
+}
+
+func collectSecrets(val reflect.Value, path string, found map[string]string) {
+	for val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return
+		}
+		val = val.Elem()
+	}
+
+	if secret, ok := val.Interface().(Secret); ok {
+		if secret.value != "" {
+			found[path] = secret.value
+		}
+		return
+	}
+
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+
+	switch val.Kind() {
+	case reflect.Struct:
+		typ := val.Type()
+
+		for idx := 0; idx < typ.NumField(); idx++ {
+			field := typ.Field(idx)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			collectSecrets(val.Field(idx), join(name), found)
+		}
+
+	case reflect.Slice, reflect.Array:
+		for idx := 0; idx < val.Len(); idx++ {
+			collectSecrets(val.Index(idx), join(strconv.Itoa(idx)), found)
+		}
+
+	case reflect.Map:
+		iter := val.MapRange()
+		for iter.Next() {
+			collectSecrets(iter.Value(), join(fmt.Sprint(iter.Key().Interface())), found)
+		}
+	}
+}
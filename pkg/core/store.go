@@ -0,0 +1,309 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// persistenceDir is the directory holding the on-disk logs of all persisted caches. Blank value disables the persistence.
+var persistenceDir string
+
+// SetPersistenceDir enables the write-through persistence for all caches mounted afterwards. Blank dir disables it.
+func SetPersistenceDir(dir string) error {
+	if dir == "" {
+		persistenceDir = ""
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	persistenceDir = dir
+	return nil
+}
+
+const (
+	opSet    = "set"
+	opDelete = "delete"
+)
+
+// storeRecord is a single line of the append-only cache log.
+type storeRecord struct {
+	// Op is the operation done on the cache (set, delete).
+	Op string `json:"op"`
+
+	// Key is the item's key in the cache.
+	Key string `json:"key"`
+
+	// Revision is the item's revision after the set operation.
+	Revision uint64 `json:"rev,omitempty"`
+
+	// Value holds the JSON-encoded item for the set operation.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// store is an append-only log of cache operations backed by a local file.
+type store struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// storePath returns the log file path for such cache name (e.g. dish/sockets -> dish.sockets.log).
+func storePath(dir, name string) string {
+	return filepath.Join(dir, strings.ReplaceAll(name, "/", ".")+".log")
+}
+
+func openStore(path string) (*store, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store{path: path, file: file}, nil
+}
+
+// append writes the record to the log and flushes it to the disk.
+func (s *store) append(rec storeRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+// loadStore replays the log into a map of items decoded into the cache's type.
+func loadStore[T any](s *store) (map[string]entry[T], error) {
+	items := make(map[string]entry[T])
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	var torn error
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		// Only the last line may be torn, the corrupt records anywhere else would lose the later ones.
+		if torn != nil {
+			return nil, fmt.Errorf("line %d: corrupt record: %w", line-1, torn)
+		}
+
+		var rec storeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			torn = err
+			continue
+		}
+
+		switch rec.Op {
+		case opSet:
+			var item T
+			if err := json.Unmarshal(rec.Value, &item); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			items[rec.Key] = entry[T]{value: item, revision: rec.Revision}
+
+		case opDelete:
+			delete(items, rec.Key)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// A torn write at the very end of the log is expected after a crash, it is dropped by the compaction.
+	if torn != nil {
+		log.Printf("store %s: skipping the torn last line %d: %s", s.path, line, torn.Error())
+	}
+
+	return items, nil
+}
+
+// compact rewrites the log to contain given set records only.
+func (s *store) compact(recs []storeRecord) error {
+	tmp := s.path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, rec := range recs {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		writer.Write(append(data, '\n'))
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	// Reopen the log as the old descriptor points to the replaced file.
+	s.file.Close()
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o640)
+	return err
+}
+
+// attachStore loads the cache's persisted items and makes the cache write-through to its log.
+func (c *Cache[T]) attachStore(dir string) error {
+	if c.store != nil {
+		return nil
+	}
+
+	s, err := openStore(storePath(dir, c.Name))
+	if err != nil {
+		return err
+	}
+
+	items, err := loadStore[T](s)
+	if err != nil {
+		s.file.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	c.items = items
+
+	for _, e := range c.items {
+		if e.revision > c.seq {
+			c.seq = e.revision
+		}
+	}
+
+	// Logs written before the revisions were introduced hold none, number such items anew.
+	for key, e := range c.items {
+		if e.revision == 0 {
+			e.revision = c.nextRevision()
+			c.seq = e.revision
+			c.items[key] = e
+		}
+	}
+
+	c.reindex()
+	c.mu.Unlock()
+
+	recs, err := c.records()
+	if err != nil {
+		s.file.Close()
+		return err
+	}
+
+	// Drop the replayed history so the log does not grow across restarts.
+	if err := s.compact(recs); err != nil {
+		s.file.Close()
+		return err
+	}
+
+	c.store = s
+	return nil
+}
+
+// CompactStores rewrites the persisted logs of all the caches with their current contents, so that the former values
+// of the changed and deleted items are not kept on the disk (e.g. after the personal data are erased). The WAL
+// segments are not rewritten.
+func CompactStores() error {
+	for name, cache := range registry {
+		if err := cache.compactStore(); err != nil {
+			return fmt.Errorf("cannot compact '%s' store: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// compactStore rewrites the cache's log, the changes wait for it to be done.
+func (c *Cache[T]) compactStore() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.store == nil {
+		return nil
+	}
+
+	recs, err := c.collectRecords()
+	if err != nil {
+		return err
+	}
+
+	return c.store.compact(recs)
+}
+
+// WriteSnapshots rewrites the persisted logs of all registered persistent caches with their current contents.
+// Previous logs are kept aside with the given suffix.
+func WriteSnapshots(dir, backupSuffix string) error {
+	for name, cache := range registry {
+		if !cache.Persistent() {
+			continue
+		}
+
+		path := storePath(dir, name)
+
+		if _, err := os.Stat(path); err == nil {
+			if err := os.Rename(path, path+backupSuffix); err != nil {
+				return err
+			}
+		}
+
+		s, err := openStore(path)
+		if err != nil {
+			return err
+		}
+
+		recs, err := cache.records()
+		if err != nil {
+			s.file.Close()
+			return fmt.Errorf("cannot write '%s' snapshot: %w", name, err)
+		}
+
+		err = s.compact(recs)
+		s.file.Close()
+		if err != nil {
+			return fmt.Errorf("cannot write '%s' snapshot: %w", name, err)
+		}
+	}
+
+	return nil
+}
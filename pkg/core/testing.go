@@ -1,6 +1,8 @@
 package core
 
 import (
+	"log"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -9,9 +11,9 @@ func SetupTestEnv(pkg *Package) *gin.Engine {
 		return nil
 	}
 
-	// initialize pkg's cache
-	for _, cache := range pkg.Cache {
-		setupTestCache(cache)
+	if err := initCaches(pkg); err != nil {
+		log.Printf("failed to set up '%s' package: %s", pkg.Name, err.Error())
+		return nil
 	}
 
 	// register pkg's routes
@@ -41,18 +43,3 @@ func setupTestRouter(group string, subRoutes func(pkgRouter *gin.RouterGroup)) *
 
 	return router
 }
-
-func setupTestCache(cache **Cache) {
-	if cache == nil {
-		c := &Cache{}
-		cache = &c
-
-		return
-	}
-
-	if *cache == nil {
-		*cache = &Cache{}
-	}
-
-	return
-}
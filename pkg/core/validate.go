@@ -0,0 +1,297 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report the binding errors by the JSON names of the fields.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// FieldError describes a single invalid field of the submitted item.
+type FieldError struct {
+	// Field is the JSON name of the field, nested fields are dotted (e.g. configuration.loki_port).
+	Field string `json:"field"`
+
+	Message string `json:"message"`
+}
+
+// ValidationError lists all the invalid fields of the submitted item.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for idx, field := range e.Fields {
+		msgs[idx] = fmt.Sprintf("%s: %s", field.Field, field.Message)
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// DecodeItem decodes the submitted JSON item into the model and enforces the model's field tags:
+//   - fields missing in the new item get the value of their `default` tag (the updates keep the fields cleared),
+//   - `required` fields have to be present and not blank,
+//   - `readonly` fields cannot be changed once the item exists, the current item is given on updates
+//     (missing fields keep their current value),
+//   - the redacted secrets (as served) keep their current value on updates, the list elements are matched by their
+//     `key` tagged field (or by their other fields being unchanged).
+//
+// The binding rules are checked as well. All failed fields are reported as a *ValidationError.
+func DecodeItem[T any](data []byte, current *T) (T, error) {
+	var item T
+
+	var doc any
+	if err := decodeJSON(data, &doc); err != nil {
+		return item, err
+	}
+
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return item, errors.New("item has to be a JSON object")
+	}
+
+	var currentObj map[string]any
+	if current != nil {
+		var err error
+		if currentObj, err = toDocument(current); err != nil {
+			return item, err
+		}
+
+		if typ := reflect.TypeFor[T](); hasSecrets(typ) {
+			keepRedactedSecrets(typ, obj, currentObj)
+		}
+	}
+
+	var fieldErrs []FieldError
+
+	if typ := reflect.TypeFor[T](); typ.Kind() == reflect.Struct {
+		enforceTags(typ, obj, currentObj, current == nil, current != nil, "", &fieldErrs)
+	}
+
+	if len(fieldErrs) > 0 {
+		return item, &ValidationError{Fields: fieldErrs}
+	}
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return item, err
+	}
+
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return item, err
+	}
+
+	if err := binding.Validator.ValidateStruct(&item); err != nil {
+		var bindErrs validator.ValidationErrors
+		if !errors.As(err, &bindErrs) {
+			return item, err
+		}
+
+		for _, bindErr := range bindErrs {
+			// Drop the model's type name from the namespace.
+			_, field, _ := strings.Cut(bindErr.Namespace(), ".")
+
+			fieldErrs = append(fieldErrs, FieldError{
+				Field:   field,
+				Message: fmt.Sprintf("failed on the '%s' rule", bindErr.Tag()),
+			})
+		}
+
+		return item, &ValidationError{Fields: fieldErrs}
+	}
+
+	return item, nil
+}
+
+// enforceTags applies the defaults to (when creating) and checks the required and readonly fields of the decoded
+// object, nested objects (in the lists and the maps as well) are walked too.
+func enforceTags(typ reflect.Type, obj, current map[string]any, creating, updating bool, prefix string, fieldErrs *[]FieldError) {
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+
+		path := prefix + name
+
+		value, present := obj[name]
+		present = present && value != nil
+
+		if field.Tag.Get("readonly") == "true" && updating {
+			currentValue, ok := current[name]
+
+			if !present && ok {
+				obj[name], value, present = currentValue, currentValue, currentValue != nil
+			} else if present && !jsonEqual(value, currentValue) {
+				*fieldErrs = append(*fieldErrs, FieldError{Field: path, Message: "read-only field cannot be changed"})
+				continue
+			}
+		}
+
+		if def, ok := field.Tag.Lookup("default"); ok && creating && !present {
+			defValue, err := parseDefault(field.Type, def)
+			if err != nil {
+				log.Printf("field %s.%s: invalid default value: %s", typ.Name(), field.Name, err.Error())
+			} else {
+				obj[name], value, present = defValue, defValue, true
+			}
+		}
+
+		if field.Tag.Get("required") == "true" {
+			if !present {
+				*fieldErrs = append(*fieldErrs, FieldError{Field: path, Message: "required field is missing"})
+				continue
+			} else if isBlank(value) {
+				*fieldErrs = append(*fieldErrs, FieldError{Field: path, Message: "required field is blank"})
+				continue
+			}
+		}
+
+		enforceNested(field.Type, value, current[name], creating, updating, path, fieldErrs)
+	}
+}
+
+// enforceNested walks the nested objects, the elements of the lists (matched to the current ones as the redacted
+// secrets are, see matchElement) and of the maps of objects, their fields are reported as path[0].name and
+// path.key.name.
+func enforceNested(typ reflect.Type, value, current any, creating, updating bool, path string, fieldErrs *[]FieldError) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		nested, ok := value.(map[string]any)
+		if !ok || typ == reflect.TypeFor[time.Time]() {
+			return
+		}
+
+		currentNested, _ := current.(map[string]any)
+		enforceTags(typ, nested, currentNested, creating, updating && currentNested != nil, path+".", fieldErrs)
+
+	case reflect.Slice, reflect.Array:
+		arr, ok := value.([]any)
+		if !ok {
+			return
+		}
+		currentArr, _ := current.([]any)
+
+		for idx, elem := range arr {
+			elemPath := fmt.Sprintf("%s[%d]", path, idx)
+			enforceNested(typ.Elem(), elem, matchElement(typ.Elem(), elem, currentArr), creating, updating, elemPath, fieldErrs)
+		}
+
+	case reflect.Map:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return
+		}
+		currentObj, _ := current.(map[string]any)
+
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			enforceNested(typ.Elem(), obj[key], currentObj[key], creating, updating, path+"."+key, fieldErrs)
+		}
+	}
+}
+
+// parseDefault converts the default tag value to the JSON value of the field's type.
+func parseDefault(typ reflect.Type, def string) (any, error) {
+	switch typ.Kind() {
+	case reflect.String:
+		return def, nil
+
+	case reflect.Bool:
+		return strconv.ParseBool(def)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(def, 64); err != nil {
+			return nil, err
+		}
+		return json.Number(def), nil
+	}
+
+	var value any
+	if err := decodeJSON([]byte(def), &value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// isBlank reports whether the decoded JSON value is an empty string, array or object.
+func isBlank(value any) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+
+	return false
+}
+
+// PrintDecodeError responds with the failure of DecodeItem, the invalid fields are listed if known.
+func PrintDecodeError(ctx *gin.Context, code int, err error, pkgName, key string) {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		ctx.IndentedJSON(code, gin.H{
+			"code":    code,
+			"error":   err.Error(),
+			"key":     key,
+			"message": "cannot bind input JSON stream",
+			"package": pkgName,
+		})
+		return
+	}
+
+	ctx.IndentedJSON(code, gin.H{
+		"code":    code,
+		"error":   err.Error(),
+		"fields":  validationErr.Fields,
+		"key":     key,
+		"message": "item is not valid",
+		"package": pkgName,
+	})
+	return
+}
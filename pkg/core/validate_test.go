@@ -0,0 +1,155 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type taggedConfig struct {
+	Port    int    `json:"port" default:"8080" binding:"omitempty,min=1,max=65535"`
+	Address string `json:"address" required:"true"`
+}
+
+type taggedItem struct {
+	ID      string        `json:"id" required:"true" readonly:"true"`
+	Name    string        `json:"name" required:"true"`
+	Enabled bool          `json:"enabled" default:"true"`
+	Labels  []string      `json:"labels" default:"[\"new\"]"`
+	Config  *taggedConfig `json:"config"`
+	Secret  Secret        `json:"secret"`
+
+	Backends []taggedConfig          `json:"backends"`
+	Zones    map[string]taggedConfig `json:"zones"`
+}
+
+func TestDecodeItem(t *testing.T) {
+	current := &taggedItem{
+		ID:      "a",
+		Name:    "a",
+		Enabled: false,
+		Config:  &taggedConfig{Port: 22, Address: "localhost"},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		data    string
+		current *taggedItem
+		want    taggedItem
+		fields  []string
+	}{
+		{"create with the defaults", `{"id": "a", "name": "a"}`, nil,
+			taggedItem{ID: "a", Name: "a", Enabled: true, Labels: []string{"new"}}, nil},
+		{"create keeps the given values", `{"id": "a", "name": "a", "enabled": false, "labels": []}`, nil,
+			taggedItem{ID: "a", Name: "a", Enabled: false, Labels: []string{}}, nil},
+		{"create with null values", `{"id": "a", "name": "a", "enabled": null}`, nil,
+			taggedItem{ID: "a", Name: "a", Enabled: true, Labels: []string{"new"}}, nil},
+		{"create with the nested defaults", `{"id": "a", "name": "a", "config": {"address": "localhost"}}`, nil,
+			taggedItem{ID: "a", Name: "a", Enabled: true, Labels: []string{"new"}, Config: &taggedConfig{Port: 8080, Address: "localhost"}}, nil},
+		{"update does not apply the defaults", `{"id": "a", "name": "b", "config": {"address": "localhost"}}`, current,
+			taggedItem{ID: "a", Name: "b", Config: &taggedConfig{Address: "localhost"}}, nil},
+		{"update keeps the missing read-only field", `{"name": "b"}`, current,
+			taggedItem{ID: "a", Name: "b"}, nil},
+		{"missing required fields", `{"enabled": true}`, nil, taggedItem{}, []string{"id", "name"}},
+		{"blank required field", `{"id": "a", "name": " "}`, nil, taggedItem{}, []string{"name"}},
+		{"missing nested required field", `{"id": "a", "name": "a", "config": {"port": 22}}`, nil, taggedItem{}, []string{"config.address"}},
+		{"create with the defaults of the list and map elements", `{"id": "a", "name": "a", "backends": [{"address": "b"}], "zones": {"eu": {"address": "c"}}}`, nil,
+			taggedItem{ID: "a", Name: "a", Enabled: true, Labels: []string{"new"}, Backends: []taggedConfig{{Port: 8080, Address: "b"}}, Zones: map[string]taggedConfig{"eu": {Port: 8080, Address: "c"}}}, nil},
+		{"missing required fields of the list and map elements", `{"id": "a", "name": "a", "backends": [{"address": "b"}, {"port": 22}], "zones": {"eu": {"address": " "}}}`, nil,
+			taggedItem{}, []string{"backends[1].address", "zones.eu.address"}},
+		{"changed read-only field", `{"id": "b", "name": "a"}`, current, taggedItem{}, []string{"id"}},
+		{"binding rules", `{"id": "a", "name": "a", "config": {"address": "localhost", "port": 70000}}`, nil, taggedItem{}, []string{"config.port"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			item, err := DecodeItem([]byte(tc.data), tc.current)
+
+			if tc.fields == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, item)
+				return
+			}
+
+			var validationErr *ValidationError
+			if assert.True(t, errors.As(err, &validationErr), err) {
+				var fields []string
+				for _, field := range validationErr.Fields {
+					fields = append(fields, field.Field)
+				}
+
+				assert.ElementsMatch(t, tc.fields, fields)
+			}
+		})
+	}
+
+	for _, data := range []string{`[]`, `"a"`, `{"id": `} {
+		_, err := DecodeItem[taggedItem]([]byte(data), nil)
+		assert.Error(t, err, data)
+	}
+
+	// the redacted secret keeps its current value on updates, it is refused when there is none
+	secret, err := NewSecret("s3cret")
+	assert.NoError(t, err)
+	current.Secret = secret
+
+	item, err := DecodeItem([]byte(`{"name": "a", "secret": "`+RedactedSecret+`"}`), current)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", item.Secret.Reveal())
+
+	_, err = DecodeItem[taggedItem]([]byte(`{"id": "a", "name": "a", "secret": "`+RedactedSecret+`"}`), nil)
+	assert.Error(t, err)
+}
+
+type secretDevice struct {
+	Name string `json:"name" key:"true"`
+	Key  Secret `json:"key"`
+}
+
+type secretLabel struct {
+	Label string `json:"label"`
+	Key   Secret `json:"key"`
+}
+
+type secretItem struct {
+	Note    string         `json:"note"`
+	Devices []secretDevice `json:"devices"`
+	Labels  []secretLabel  `json:"labels"`
+}
+
+func TestDecodeItemSecretList(t *testing.T) {
+	secret := func(value string) Secret {
+		s, err := NewSecret(value)
+		assert.NoError(t, err)
+		return s
+	}
+
+	current := &secretItem{
+		Devices: []secretDevice{{"a", secret("s1")}, {"b", secret("s2")}, {"c", secret("s3")}},
+		Labels:  []secretLabel{{"x", secret("s4")}, {"y", secret("s5")}},
+	}
+
+	// a device removed and the others reordered keep their own keys, the other strings are left as they are
+	item, err := DecodeItem([]byte(`{
+		"note": "`+RedactedSecret+`",
+		"devices": [{"name": "c", "key": "`+RedactedSecret+`"}, {"name": "a", "key": "`+RedactedSecret+`"}],
+		"labels": [{"label": "y", "key": "`+RedactedSecret+`"}, {"label": "x", "key": "`+RedactedSecret+`"}]
+	}`), current)
+	assert.NoError(t, err)
+
+	assert.Equal(t, RedactedSecret, item.Note)
+	assert.Len(t, item.Devices, 2)
+	assert.Equal(t, "c", item.Devices[0].Name)
+	assert.Equal(t, "s3", item.Devices[0].Key.Reveal())
+	assert.Equal(t, "s1", item.Devices[1].Key.Reveal())
+	assert.Equal(t, "s5", item.Labels[0].Key.Reveal())
+	assert.Equal(t, "s4", item.Labels[1].Key.Reveal())
+
+	// the redacted key of a new device or of a changed element is refused
+	for _, data := range []string{
+		`{"devices": [{"name": "d", "key": "` + RedactedSecret + `"}]}`,
+		`{"labels": [{"label": "z", "key": "` + RedactedSecret + `"}]}`,
+	} {
+		_, err := DecodeItem([]byte(data), current)
+		assert.ErrorIs(t, err, ErrRedactedSecret, data)
+	}
+}
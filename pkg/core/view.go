@@ -0,0 +1,153 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetView sets the function the items are passed through before they are served to a request, e.g. to hide the
+// fields the requester may not see. The listings are queried after the view is applied.
+func (c *Cache[T]) SetView(view func(ctx *gin.Context, item T) T) {
+	c.mu.Lock()
+	c.view = view
+	c.mu.Unlock()
+}
+
+// View returns the item as it is to be served to the request, its secrets are redacted.
+func (c *Cache[T]) View(ctx *gin.Context, item T) T {
+	c.mu.RLock()
+	view := c.view
+	c.mu.RUnlock()
+
+	if view != nil {
+		item = view(ctx, item)
+	}
+
+	return redactSecrets(item)
+}
+
+// SetGuard sets the function the items are passed through before the generic create, update and patch handlers
+// save them, e.g. to set the fields the requester may not choose. The request is refused if it returns an error.
+func (c *Cache[T]) SetGuard(guard func(ctx *gin.Context, item T) (T, error)) {
+	c.mu.Lock()
+	c.guard = guard
+	c.mu.Unlock()
+}
+
+// Guard returns the item as it is to be saved by the request, see SetGuard.
+func (c *Cache[T]) Guard(ctx *gin.Context, item T) (T, error) {
+	c.mu.RLock()
+	guard := c.guard
+	c.mu.RUnlock()
+
+	if guard == nil {
+		return item, nil
+	}
+
+	return guard(ctx, item)
+}
+
+// PrintGuardError responds to the requests refused by the cache's guard, the items it finds invalid (reported as
+// a *ValidationError) are refused as DecodeItem's ones are.
+func PrintGuardError(ctx *gin.Context, err error, pkgName, key string) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		PrintDecodeError(ctx, http.StatusBadRequest, err, pkgName, key)
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusForbidden, gin.H{
+		"code":    http.StatusForbidden,
+		"error":   err.Error(),
+		"key":     key,
+		"message": "item cannot be saved by the requester",
+		"package": pkgName,
+	})
+}
+
+// viewItems applies the view to all the items, the map is changed in place.
+func (c *Cache[T]) viewItems(ctx *gin.Context, items map[string]T) map[string]T {
+	for key, item := range items {
+		items[key] = c.View(ctx, item)
+	}
+
+	return items
+}
+
+// ViewChange returns the change with its items as they are served to the request (e.g. with the secrets redacted).
+func ViewChange(ctx *gin.Context, change Change) Change {
+	cache, ok := registry[change.Cache]
+	if !ok {
+		return change
+	}
+
+	change.Before = cache.viewAny(ctx, change.Before)
+	change.After = cache.viewAny(ctx, change.After)
+	return change
+}
+
+func (c *Cache[T]) viewAny(ctx *gin.Context, item any) any {
+	if value, ok := item.(T); ok {
+		return c.View(ctx, value)
+	}
+
+	return item
+}
+
+// ViewFeedEvent returns the change as it is to be served to the request, its item passed through the cache's view.
+// The requests limited to their user's items are served only the changes of such items (the deletes excluded).
+func ViewFeedEvent(ctx *gin.Context, ev FeedEvent) (FeedEvent, bool) {
+	cache, ok := registry[ev.Cache]
+	if !ok {
+		return ev, false
+	}
+
+	value, ok := cache.viewRaw(ctx, ev.Value)
+	if !ok {
+		return ev, false
+	}
+
+	ev.Value = value
+	return ev, true
+}
+
+func (c *Cache[T]) viewRaw(ctx *gin.Context, raw json.RawMessage) (json.RawMessage, bool) {
+	user, scoped := OwnerScope(ctx)
+
+	c.mu.RLock()
+	view := c.view
+	c.mu.RUnlock()
+
+	if raw == nil {
+		return raw, !scoped
+	}
+
+	secrets := hasSecrets(reflect.TypeFor[T]())
+	if view == nil && !scoped && !secrets {
+		return raw, true
+	}
+
+	var item T
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return nil, false
+	}
+
+	if scoped && !c.Owns(item, user) {
+		return nil, false
+	}
+
+	if view == nil && !secrets {
+		return raw, true
+	}
+
+	data, err := json.Marshal(c.View(ctx, item))
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
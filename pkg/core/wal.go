@@ -0,0 +1,324 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// walSegmentSize is the size in bytes after which the current WAL segment is rotated.
+const walSegmentSize int64 = 16 << 20
+
+// WALRecord is a single cache operation as written to the write-ahead log.
+type WALRecord struct {
+	// Timestamp of the operation.
+	Timestamp time.Time `json:"timestamp"`
+
+	// User is the name of the user who invoked the operation (blank for internal ones).
+	User string `json:"user"`
+
+	// Package is the name of the package owning the cache.
+	Package string `json:"package"`
+
+	// Cache is the full name of the cache (e.g. dish/sockets).
+	Cache string `json:"cache"`
+
+	// Op is the operation done on the cache (set, delete).
+	Op string `json:"op"`
+
+	// Key is the item's key in the cache.
+	Key string `json:"key"`
+
+	// Revision is the item's revision after the set operation.
+	Revision uint64 `json:"revision,omitempty"`
+
+	// Value holds the JSON-encoded item for the set operation.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// WALSegment describes a single WAL segment file.
+type WALSegment struct {
+	// Name of the segment file.
+	Name string `json:"name"`
+
+	// Size of the segment in bytes.
+	Size int64 `json:"size"`
+
+	// Records is the count of records in such segment.
+	Records int `json:"records"`
+
+	// From is the timestamp of the first record in such segment.
+	From time.Time `json:"from"`
+
+	// To is the timestamp of the last record in such segment.
+	To time.Time `json:"to"`
+
+	// Checkpoint tells the segment has a checkpoint, the replay can start there.
+	Checkpoint bool `json:"checkpoint"`
+}
+
+type wal struct {
+	dir string
+
+	mu      sync.Mutex
+	file    *os.File
+	segment string
+	size    int64
+
+	// checkpointMu serializes the checkpoints, retention is how long the covered segments are kept, see
+	// SetWALRetention.
+	checkpointMu sync.Mutex
+	retention    time.Duration
+}
+
+// walLog is the write-ahead log all persistent caches append to. Nil value disables the WAL.
+var walLog *wal
+
+// SetWALDir enables the write-ahead log in such directory. Blank dir disables it.
+func SetWALDir(dir string) error {
+	if dir == "" {
+		walLog = nil
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	w := &wal{dir: dir}
+	if err := w.rotate(); err != nil {
+		return err
+	}
+
+	walLog = w
+	return nil
+}
+
+// rotate opens a new segment, segments are named after their creation time to keep them ordered.
+func (w *wal) rotate() error {
+	name := fmt.Sprintf("%020d.wal", time.Now().UnixNano())
+
+	file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+
+	if w.file != nil {
+		w.file.Close()
+	}
+
+	w.file = file
+	w.segment = name
+	w.size = 0
+	return nil
+}
+
+func (w *wal) append(rec WALRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.size >= walSegmentSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+
+		// The caches are locked by the writers meanwhile, so the snapshot is taken aside.
+		go func(segment string) {
+			if err := w.checkpoint(segment); err != nil {
+				log.Printf("wal: cannot write the checkpoint of %s: %s", segment, err.Error())
+			}
+		}(w.segment)
+	}
+
+	n, err := w.file.Write(append(data, '\n'))
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+// walSegmentNames returns the sorted list of segment file names in such directory.
+func walSegmentNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".wal") {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// readWALSegment calls fn for every record of such segment until fn returns false.
+func readWALSegment(path string, fn func(rec WALRecord) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		var rec WALRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn write at the end of a segment, nothing more to read there.
+			log.Printf("wal %s: skipping the segment tail: %s", path, err.Error())
+			break
+		}
+
+		if !fn(rec) {
+			break
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ListWALSegments describes all segments of the active write-ahead log.
+func ListWALSegments() ([]WALSegment, error) {
+	if walLog == nil {
+		return nil, fmt.Errorf("write-ahead log is not enabled")
+	}
+
+	names, err := walSegmentNames(walLog.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []WALSegment{}
+
+	for _, name := range names {
+		path := filepath.Join(walLog.dir, name)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		segment := WALSegment{Name: name, Size: info.Size()}
+
+		if _, err := os.Stat(filepath.Join(walLog.dir, checkpointName(name))); err == nil {
+			segment.Checkpoint = true
+		}
+
+		err = readWALSegment(path, func(rec WALRecord) bool {
+			if segment.Records == 0 {
+				segment.From = rec.Timestamp
+			}
+			segment.To = rec.Timestamp
+			segment.Records++
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+// ReplayWAL applies all records of the WAL in such directory made until the given time to the registered caches,
+// starting with the latest checkpoint taken by then (if any). It returns the count of replayed records.
+func ReplayWAL(dir string, until time.Time) (int, error) {
+	names, err := walSegmentNames(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	checkpoints, err := readCheckpoints(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var base *walCheckpoint
+	for idx := range checkpoints {
+		if !checkpoints[idx].Timestamp.After(until) {
+			base = &checkpoints[idx]
+		}
+	}
+
+	switch {
+	case base != nil:
+		if err := loadCheckpoint(dir, *base); err != nil {
+			return 0, err
+		}
+
+		log.Printf("wal replay: starting with the checkpoint of %s taken at %s", base.Segment, base.Timestamp.Format(time.RFC3339))
+
+		// The records of the checkpoint's segment are replayed again, the later ones fix the state.
+		names = slices.DeleteFunc(names, func(name string) bool {
+			return name < base.Segment
+		})
+
+	case len(checkpoints) > 0 && len(names) > 0 && checkpoints[0].Segment == names[0]:
+		// The log starts with a checkpoint, the earlier state is not known (or the segments have been pruned).
+		return 0, fmt.Errorf("no checkpoint taken by %s, the first one is of %s", until.Format(time.RFC3339), checkpoints[0].Timestamp.Format(time.RFC3339))
+	}
+
+	var count int
+	var replayErr error
+
+	for _, name := range names {
+		done := false
+
+		err := readWALSegment(filepath.Join(dir, name), func(rec WALRecord) bool {
+			if rec.Timestamp.After(until) {
+				done = true
+				return false
+			}
+
+			cache, ok := registry[rec.Cache]
+			if !ok || !cache.Persistent() {
+				log.Printf("wal replay: skipping a record of unknown cache '%s'", rec.Cache)
+				return true
+			}
+
+			if err := cache.apply(rec.Op, rec.Key, rec.Value, rec.Revision); err != nil {
+				replayErr = fmt.Errorf("%s: cannot decode '%s' item of '%s': %w", name, rec.Key, rec.Cache, err)
+				return false
+			}
+
+			count++
+			return true
+		})
+		if err != nil {
+			return count, err
+		}
+
+		if replayErr != nil {
+			return count, replayErr
+		}
+
+		if done {
+			break
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWALCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, SetWALDir(dir))
+	defer SetWALDir("")
+	SetWALRetention(time.Hour)
+
+	cache := mountTestCache("waltest")
+
+	beforeCheckpoint := time.Now()
+	cache.Set("a", testItem{Name: "a", Count: 1})
+	assert.NoError(t, CheckpointWAL())
+
+	cache.Set("a", testItem{Name: "a", Count: 2})
+	firstSegment := time.Now()
+
+	// a restart opens the next segment
+	assert.NoError(t, SetWALDir(dir))
+	SetWALRetention(time.Hour)
+
+	cache.Set("b", testItem{Name: "b", Count: 1})
+	assert.NoError(t, CheckpointWAL())
+
+	cache.Delete("a")
+	end := time.Now()
+
+	segments, err := ListWALSegments()
+	assert.NoError(t, err)
+	assert.Len(t, segments, 2)
+	assert.True(t, segments[0].Checkpoint)
+	assert.True(t, segments[1].Checkpoint)
+
+	for _, tc := range []struct {
+		name  string
+		until time.Time
+		want  map[string]testItem
+		err   bool
+	}{
+		{"before the first checkpoint", beforeCheckpoint, nil, true},
+		{"first segment", firstSegment, map[string]testItem{"a": {Name: "a", Count: 2}}, false},
+		{"second segment", end, map[string]testItem{"b": {Name: "b", Count: 1}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			replayed := mountTestCache("waltest")
+
+			_, err := ReplayWAL(dir, tc.until)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			items, _ := replayed.GetAll()
+			assert.Equal(t, tc.want, items)
+		})
+	}
+
+	// the segments covered by the latest checkpoint are pruned once out of the retention
+	SetWALRetention(0)
+	assert.NoError(t, CheckpointWAL())
+
+	segments, err = ListWALSegments()
+	assert.NoError(t, err)
+	assert.Len(t, segments, 1)
+	assert.True(t, segments[0].Checkpoint)
+
+	replayed := mountTestCache("waltest")
+
+	_, err = ReplayWAL(dir, time.Now())
+	assert.NoError(t, err)
+
+	items, _ := replayed.GetAll()
+	assert.Equal(t, map[string]testItem{"b": {Name: "b", Count: 1}}, items)
+
+	_, err = ReplayWAL(dir, firstSegment)
+	assert.Error(t, err)
+}
@@ -11,10 +11,16 @@ import (
 )
 
 var (
-	Cache *core.Cache
+	Cache = &core.Cache[DepotItem]{}
 
-	caches = []**core.Cache{
-		&Cache,
+	caches = []core.CacheInterface{
+		Cache,
+	}
+	indexes = map[core.CacheInterface][]string{
+		Cache: {"owner_name"},
+	}
+	owners = map[core.CacheInterface]string{
+		Cache: "owner_name",
 	}
 	pkgName string = "depots"
 )
@@ -26,14 +32,15 @@ var Package *core.Package = &core.Package{
 	Subpackages: []string{
 		"items",
 	},
+	Indexes: indexes,
+	Owners:  owners,
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"Cache"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
 }
 
 // GetAllDepotItems GET method
@@ -86,6 +93,18 @@ func UpdateDepotItemByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch depot item by its key
+// @Description patch depot by its key (JSON merge patch)
+// @Tags depots
+// @Produce json
+// @Param  id  path  string  true  "depot key"
+// @Success 200 {object} depots.DepotItem
+// @Router /depots/items/{key} [patch]
+func PatchDepotItemByKey(ctx *gin.Context) {
+	core.PatchItemByParam[DepotItem](ctx, Cache, pkgName, DepotItem{})
+	return
+}
+
 // @Summary Delete depot item by its key
 // @Description delete depot item by its key
 // @Tags depots
@@ -130,29 +149,15 @@ func GetDepotItemsByOwner(ctx *gin.Context) {
 	var owner string = ctx.Param("owner")
 	var exportedItemsMap = make(map[int]DepotItem)
 
-	rawItemsMap, _ := Cache.GetAll()
+	rawItemsMap := core.AccessibleItems(ctx, Cache, Cache.Lookup("owner_name", owner))
 
-	for rawKey, rawItem := range rawItemsMap {
+	for rawKey, item := range rawItemsMap {
 		key, err := strconv.Atoi(rawKey)
 		if err != nil {
 			continue
 		}
 
-		item, ok := rawItem.(DepotItem)
-		if !ok {
-			continue
-		}
-
-		if item.Owner == owner {
-			// TODO: reimplement this
-			// order items ASC alphabetically
-			// https://pkg.go.dev/sort#Slice
-			//sort.Slice(depot.DepotItems, func(i, j int) bool {
-			//	return (depot.DepotItems[i].Description < depot.DepotItems[j].Description)
-			//})
-
-			exportedItemsMap[key] = item
-		}
+		exportedItemsMap[key] = item
 	}
 
 	if len(exportedItemsMap) > 0 {
@@ -14,10 +14,11 @@ import (
 
 var TestPackage *core.Package = &core.Package{
 	Name: pkgName,
-	Cache: []**core.Cache{
-		&Cache,
+	Cache: []core.CacheInterface{
+		Cache,
 	},
-	Routes: Routes,
+	Routes:  Routes,
+	Indexes: indexes,
 }
 
 /*
@@ -30,6 +31,7 @@ func TestPostNewDepotItem(t *testing.T) {
 	var item DepotItem = DepotItem{
 		ID:          "1",
 		Description: "An absolutely generic item.",
+		Location:    "cellar",
 	}
 
 	jsonValue, _ := json.Marshal(item)
@@ -80,6 +82,7 @@ func TestUpdateDepotItemByKey(t *testing.T) {
 	var item DepotItem = DepotItem{
 		ID:          "1",
 		Description: "An absolutely generic item, edited.",
+		Location:    "cellar",
 	}
 
 	jsonValue, _ := json.Marshal(item)
@@ -98,6 +101,45 @@ func TestUpdateDepotItemByKey(t *testing.T) {
 	assert.Equal(t, item.Description, ret.Item.Description)
 }
 
+func TestGetDepotItemsByOwner(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	getByOwner := func(owner string) (int, map[string]DepotItem) {
+		req, _ := http.NewRequest("GET", "/depots/items/owner/"+owner, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var ret = struct {
+			Items map[string]DepotItem `json:"items"`
+		}{}
+		json.Unmarshal(w.Body.Bytes(), &ret)
+
+		return w.Code, ret.Items
+	}
+
+	for _, owner := range []string{"alice", "bob"} {
+		jsonValue, _ := json.Marshal(DepotItem{
+			ID:          "1",
+			Description: "An absolutely generic item, edited.",
+			Location:    "cellar",
+			Owner:       owner,
+		})
+		req, _ := http.NewRequest("PUT", "/depots/items/1", bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// the owner index follows the updates
+	code, _ := getByOwner("alice")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, items := getByOwner("bob")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, items, "1")
+}
+
 func TestDeleteDepotItemByKey(t *testing.T) {
 	r := core.SetupTestEnv(TestPackage)
 
@@ -18,6 +18,8 @@ func Routes(g *gin.RouterGroup) {
 		GetDepotItemsByOwner)
 	g.PUT("/items/:key",
 		UpdateDepotItemByKey)
+	g.PATCH("/items/:key",
+		PatchDepotItemByKey)
 	g.DELETE("/items/:key",
 		DeleteDepotItemByKey)
 
@@ -3,6 +3,7 @@ package dish
 import (
 	//"encoding/json"
 
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
@@ -15,27 +16,36 @@ import (
 )
 
 var (
-	CacheIncidents *core.Cache
-	CacheSockets   *core.Cache
-	CacheStreamer  *core.Cache
+	CacheIncidents = &core.Cache[Incident]{}
+	CacheSockets   = &core.Cache[Socket]{}
+	CacheStreamer  = &core.Cache[StreamerStats]{Volatile: true}
 	Dispatcher     *Stream
 
-	caches = []**core.Cache{
-		&CacheIncidents,
-		&CacheSockets,
-		&CacheStreamer,
+	caches = []core.CacheInterface{
+		CacheIncidents,
+		CacheSockets,
+		CacheStreamer,
+	}
+	indexes = map[core.CacheInterface][]string{
+		CacheSockets: {"dish_target"},
 	}
 	pkgName string = "dish"
 )
 
 var Package *core.Package = &core.Package{
-	Name:   pkgName,
-	Cache:  caches,
+	Name:  pkgName,
+	Cache: caches,
+	CacheNames: []string{
+		"incidents",
+		"sockets",
+		"streamer",
+	},
 	Routes: Routes,
 	Subpackages: []string{
 		"incidents",
 		"sockets",
 	},
+	Indexes: indexes,
 }
 
 var restorePackage = &core.RestorePackage{
@@ -50,10 +60,6 @@ var restorePackage = &core.RestorePackage{
 		"incidents",
 		"sockets",
 	},
-	SubpackageModels: map[string]any{
-		"incidents": Incident{},
-		"sockets":   Socket{},
-	},
 }
 
 //
@@ -97,6 +103,18 @@ func UpdateSocketByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch socket by its ID
+// @Description patch socket by its ID (JSON merge patch)
+// @Tags dish
+// @Produce json
+// @Param request body dish.Socket true "merge patch of the item"
+// @Success 200 {object} dish.Socket
+// @Router /dish/sockets/{key} [patch]
+func PatchSocketByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Socket](ctx, CacheSockets, pkgName, Socket{})
+	return
+}
+
 // remove existing socket by ID
 // @Summary Delete socket by its ID
 // @Description delete socket by its ID
@@ -120,17 +138,9 @@ func GetSocketListPublic(ctx *gin.Context) {
 	var exportedSockets []Socket
 	var counter int = 0
 
-	rawSocketsMap, _ := CacheSockets.GetAll()
-
-	for _, rawSocket := range rawSocketsMap {
-		socket, ok := rawSocket.(Socket)
-		if !ok {
-			/*fmt.Printf("cannot assert type: %s\n", reflect.TypeOf(rawSocket))
-			fmt.Printf("rawSocket: %v\n", rawSocket)
-			fmt.Printf("Socket: %v\n", Socket{})*/
-			continue
-		}
+	socketsMap, _ := CacheSockets.GetAll()
 
+	for _, socket := range socketsMap {
 		if socket.Public {
 			exportedSockets = append(exportedSockets, socket)
 			counter++
@@ -158,15 +168,10 @@ func GetSocketListByHost(ctx *gin.Context) {
 	var exportedSockets []Socket
 	var counter int = 0
 
-	rawSocketsMap, _ := CacheSockets.GetAll()
-
-	for _, rawSocket := range rawSocketsMap {
-		socket, ok := rawSocket.(Socket)
-		if !ok {
-			continue
-		}
+	socketsMap := CacheSockets.Lookup("dish_target", host)
 
-		if contains(socket.DishTarget, host) && !socket.Muted {
+	for _, socket := range socketsMap {
+		if !socket.Muted {
 			exportedSockets = append(exportedSockets, socket)
 			counter++
 		}
@@ -206,43 +211,35 @@ func BatchPostHealthyStatus(ctx *gin.Context) {
 	var count int = 0
 
 	for key, result := range results.Map {
-		var socket Socket
-		var ok bool
+		var changed bool
+
+		// update the result fields only, not to overwrite concurrent changes of the socket's settings
+		socket, _, err := CacheSockets.Update(ctx, key, func(socket Socket) Socket {
+			changed = socket.Healthy != result
 
-		if rawSocket, found := CacheSockets.Get(key); !found {
+			socket.Healthy = result
+			socket.TestTimestamp = time.Now().UnixNano()
+			return socket
+		})
+		if errors.Is(err, core.ErrItemNotFound) {
 			continue
-		} else {
-			if socket, ok = rawSocket.(Socket); !ok {
-				ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-					"code":    http.StatusInternalServerError,
-					"key":     key,
-					"message": "cannot assert data type, database internal error",
-					"package": pkgName,
-				})
-				return
-			}
+		} else if err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"code":    http.StatusInternalServerError,
+				"key":     key,
+				"message": "cannot update socket's healthy state by key",
+			})
+			return
 		}
 
 		// add socket ID to the exported array (via event dispatcher) if changed its state only
-		if socket.Healthy != result {
+		if changed {
 			if result {
 				socketsUp = append(socketsUp, socket.ID)
 			} else {
 				socketsDown = append(socketsDown, socket.ID)
 			}
 			count++
-			socket.Healthy = result
-		}
-
-		socket.TestTimestamp = time.Now().UnixNano()
-
-		if saved := CacheSockets.Set(key, socket); !saved {
-			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-				"code":    http.StatusInternalServerError,
-				"key":     key,
-				"message": "cannot update socket's healthy state by key",
-			})
-			return
 		}
 	}
 
@@ -298,10 +295,8 @@ func BatchPostHealthyStatus(ctx *gin.Context) {
 // @Router       /dish/sockets/{key}/maintenance [put]
 func MaintenanceToggleSocketByKey(ctx *gin.Context) {
 	var id string = ctx.Param("key")
-	var updatedSocket Socket
 
-	rawSocket, ok := CacheSockets.Get(id)
-	if !ok {
+	if _, ok := CacheSockets.Get(id); !ok {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
 			"message": "socket not found",
@@ -310,23 +305,16 @@ func MaintenanceToggleSocketByKey(ctx *gin.Context) {
 		return
 	}
 
-	updatedSocket, ok = rawSocket.(Socket)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"message": "cannot assert data type, database internal error",
-		})
-		return
-	}
+	// inverse the Maintenance field value, other fields may have been changed meanwhile (e.g. by dish agents)
+	updatedSocket, rev, err := CacheSockets.Update(ctx, id, func(socket Socket) Socket {
+		socket.Maintenance = !socket.Maintenance
 
-	// inverse the Maintenance field value
-	updatedSocket.Maintenance = !updatedSocket.Maintenance
-
-	if updatedSocket.Maintenance {
-		updatedSocket.Muted = true
-	}
-
-	if saved := CacheSockets.Set(updatedSocket.ID, updatedSocket); !saved {
+		if socket.Maintenance {
+			socket.Muted = true
+		}
+		return socket
+	})
+	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "socket couldn't be saved to database",
@@ -334,6 +322,8 @@ func MaintenanceToggleSocketByKey(ctx *gin.Context) {
 		return
 	}
 
+	ctx.Header("ETag", core.ETag(rev))
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
 		"message": "socket mute toggle pressed!",
@@ -356,10 +346,8 @@ func MaintenanceToggleSocketByKey(ctx *gin.Context) {
 // @Router       /dish/sockets/{key}/mute [put]
 func MuteToggleSocketByKey(ctx *gin.Context) {
 	var id string = ctx.Param("key")
-	var updatedSocket Socket
 
-	rawSocket, ok := CacheSockets.Get(id)
-	if !ok {
+	if _, ok := CacheSockets.Get(id); !ok {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
 			"message": "socket not found",
@@ -368,23 +356,16 @@ func MuteToggleSocketByKey(ctx *gin.Context) {
 		return
 	}
 
-	updatedSocket, ok = rawSocket.(Socket)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"message": "cannot assert data type, database internal error",
-		})
-		return
-	}
-
-	// inverse the Muted field value
-	updatedSocket.Muted = !updatedSocket.Muted
-
-	if updatedSocket.Muted {
-		updatedSocket.MutedFrom = time.Now().Unix()
-	}
+	// inverse the Muted field value, other fields may have been changed meanwhile (e.g. by dish agents)
+	updatedSocket, rev, err := CacheSockets.Update(ctx, id, func(socket Socket) Socket {
+		socket.Muted = !socket.Muted
 
-	if saved := CacheSockets.Set(updatedSocket.ID, updatedSocket); !saved {
+		if socket.Muted {
+			socket.MutedFrom = time.Now().Unix()
+		}
+		return socket
+	})
+	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "socket couldn't be saved to database",
@@ -392,6 +373,8 @@ func MuteToggleSocketByKey(ctx *gin.Context) {
 		return
 	}
 
+	ctx.Header("ETag", core.ETag(rev))
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
 		"message": "socket mute toggle pressed!",
@@ -414,10 +397,8 @@ func MuteToggleSocketByKey(ctx *gin.Context) {
 // @Router       /dish/sockets/{key}/public [put]
 func PublicToggleSocketByKey(ctx *gin.Context) {
 	var id string = ctx.Param("key")
-	var updatedSocket Socket
 
-	rawSocket, ok := CacheSockets.Get(id)
-	if !ok {
+	if _, ok := CacheSockets.Get(id); !ok {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
 			"message": "socket not found",
@@ -426,19 +407,12 @@ func PublicToggleSocketByKey(ctx *gin.Context) {
 		return
 	}
 
-	updatedSocket, ok = rawSocket.(Socket)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"message": "cannot assert data type, database internal error",
-		})
-		return
-	}
-
-	// inverse the Muted field value
-	updatedSocket.Public = !updatedSocket.Public
-
-	if saved := CacheSockets.Set(updatedSocket.ID, updatedSocket); !saved {
+	// inverse the Public field value, other fields may have been changed meanwhile (e.g. by dish agents)
+	updatedSocket, rev, err := CacheSockets.Update(ctx, id, func(socket Socket) Socket {
+		socket.Public = !socket.Public
+		return socket
+	})
+	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "socket couldn't be saved to database",
@@ -446,6 +420,8 @@ func PublicToggleSocketByKey(ctx *gin.Context) {
 		return
 	}
 
+	ctx.Header("ETag", core.ETag(rev))
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
 		"message": "socket public toggle pressed!",
@@ -561,7 +537,7 @@ func PostNewIncident(ctx *gin.Context) {
 
 	newIncident.ID = id
 
-	if saved := CacheIncidents.Set(id, newIncident); !saved {
+	if saved := CacheIncidents.SetContext(ctx, id, newIncident); !saved {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "incident couldn't be saved to database",
@@ -596,6 +572,22 @@ func UpdateIncidentByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary      Patch incident by its key
+// @Description  patch incident by its key (JSON merge patch)
+// @Tags         dish
+// @Accept       json
+// @Produce      json
+// @Param        request  body  dish.Incident  true  "merge patch of the item"
+// @Success      200  {array}   dish.Incident
+// @Failure      404  {object}  dish.Incident
+// @Failure      412  {object}  dish.Incident
+// @Failure      422  {object}  dish.Incident
+// @Router       /dish/incidents/{key} [patch]
+func PatchIncidentByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Incident](ctx, CacheIncidents, pkgName, Incident{})
+	return
+}
+
 // DeleteIncidentByKey deletes given incident
 //
 // @Summary      Delete incident by its key
@@ -626,14 +618,9 @@ func GetGlobalIncidentList(ctx *gin.Context) {
 	var exportedIncidents []Incident = []Incident{}
 	var counter int = 0
 
-	rawIncidentsMap, _ := CacheIncidents.GetAll()
-
-	for _, rawIncident := range rawIncidentsMap {
-		incident, ok := rawIncident.(Incident)
-		if !ok {
-			continue
-		}
+	incidentsMap, _ := CacheIncidents.GetAll()
 
+	for _, incident := range incidentsMap {
 		if incident.SocketID == "" {
 			exportedIncidents = append(exportedIncidents, incident)
 			counter++
@@ -662,14 +649,9 @@ func GetPublicIncidentList(ctx *gin.Context) {
 	var exportedIncidents []Incident = []Incident{}
 	var counter int = 0
 
-	rawIncidentsMap, _ := CacheIncidents.GetAll()
-
-	for _, rawIncident := range rawIncidentsMap {
-		incident, ok := rawIncident.(Incident)
-		if !ok {
-			continue
-		}
+	incidentsMap, _ := CacheIncidents.GetAll()
 
+	for _, incident := range incidentsMap {
 		if incident.Public {
 			exportedIncidents = append(exportedIncidents, incident)
 			counter++
@@ -723,14 +705,9 @@ func GetIncidentListBySocketID(ctx *gin.Context) {
 		return
 	}
 
-	rawIncidentsMap, _ := CacheIncidents.GetAll()
-
-	for _, rawIncident := range rawIncidentsMap {
-		incident, ok := rawIncident.(Incident)
-		if !ok {
-			continue
-		}
+	incidentsMap, _ := CacheIncidents.GetAll()
 
+	for _, incident := range incidentsMap {
 		if incident.SocketID == key {
 			//exportedIncidents[incident.SocketID] = incident
 			exportedIncidents = append(exportedIncidents, incident)
@@ -764,7 +741,6 @@ func GetIncidentListBySocketID(ctx *gin.Context) {
 // @Router       /dish/streamer/stats [get]
 func GetStreamerStats(ctx *gin.Context) {
 	var counter int
-	var exportedStats = map[string]StreamerStats{}
 
 	if CacheStreamer == nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
@@ -776,17 +752,7 @@ func GetStreamerStats(ctx *gin.Context) {
 		return
 	}
 
-	rawStats, counter := CacheStreamer.GetAll()
-
-	// loop over string-map of interface{}
-	for key, rawStat := range rawStats {
-		stat, ok := rawStat.(StreamerStats)
-		if !ok {
-			continue
-		}
-
-		exportedStats[key] = stat
-	}
+	exportedStats, counter := CacheStreamer.GetAll()
 
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
@@ -886,7 +852,7 @@ func PostDumpRestore(ctx *gin.Context) {
 			continue
 		}
 
-		CacheIncidents.Set(key, item)
+		CacheIncidents.SetContext(ctx, key, item)
 		counter[0]++
 	}
 
@@ -895,7 +861,7 @@ func PostDumpRestore(ctx *gin.Context) {
 			continue
 		}
 
-		CacheSockets.Set(key, item)
+		CacheSockets.SetContext(ctx, key, item)
 		counter[1]++
 	}
 
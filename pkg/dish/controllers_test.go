@@ -14,15 +14,16 @@ import (
 )
 
 // app = array of pointers to pointers to Cache
-type appCache []**core.Cache
+type appCache []core.CacheInterface
 
 var TestPackage *core.Package = &core.Package{
 	Name: pkgName,
-	Cache: []**core.Cache{
-		&CacheIncidents,
-		&CacheSockets,
+	Cache: []core.CacheInterface{
+		CacheIncidents,
+		CacheSockets,
 	},
-	Routes: Routes,
+	Routes:  Routes,
+	Indexes: indexes,
 }
 
 // variable used to catch the Incident.ID property
@@ -346,6 +347,141 @@ func TestUpdateSocketByKey(t *testing.T) {
 	assert.Equal(t, false, item.Socket.Healthy)
 }
 
+func TestPatchSocketByKey(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	// merge patch: only the port changes, null removes the targets
+	req, _ := http.NewRequest("PATCH", "/dish/sockets/test_socket", bytes.NewBufferString(`{"port_tcp": 443, "dish_target": null}`))
+	req.Header.Set("Content-Type", core.MergePatchType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var item = struct {
+		Socket Socket `json:"item"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &item)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 443, item.Socket.Port)
+	assert.Equal(t, "host.example.com", item.Socket.Host)
+	assert.Equal(t, true, item.Socket.Public)
+	assert.Empty(t, item.Socket.DishTarget)
+
+	// JSON patch: the failed test operation discards the whole patch
+	req, _ = http.NewRequest("PATCH", "/dish/sockets/test_socket", bytes.NewBufferString(`[
+		{"op": "add", "path": "/dish_target", "value": ["dish_target1"]},
+		{"op": "test", "path": "/port_tcp", "value": 80}
+	]`))
+	req.Header.Set("Content-Type", core.JSONPatchType)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	req, _ = http.NewRequest("PATCH", "/dish/sockets/test_socket", bytes.NewBufferString(`[
+		{"op": "test", "path": "/port_tcp", "value": 443},
+		{"op": "add", "path": "/dish_target", "value": ["dish_target1"]},
+		{"op": "add", "path": "/dish_target/-", "value": "dish_target2"},
+		{"op": "replace", "path": "/public", "value": false}
+	]`))
+	req.Header.Set("Content-Type", core.JSONPatchType)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	json.Unmarshal(w.Body.Bytes(), &item)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"dish_target1", "dish_target2"}, item.Socket.DishTarget)
+	assert.Equal(t, false, item.Socket.Public)
+
+	// the patched item still has to be valid
+	req, _ = http.NewRequest("PATCH", "/dish/sockets/test_socket", bytes.NewBufferString(`{"host_name": null}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestSocketValidation(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	type response struct {
+		Socket Socket            `json:"item"`
+		Fields []core.FieldError `json:"fields"`
+	}
+
+	// missing fields get their defaults
+	req, _ := http.NewRequest("POST", "/dish/sockets", bytes.NewBufferString(`{
+		"id": "defaults_socket", "socket_name": "defaults", "host_name": "defaults.example.com"
+	}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var ret response
+	json.Unmarshal(w.Body.Bytes(), &ret)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, true, ret.Socket.Muted)
+
+	// required fields are reported one by one
+	req, _ = http.NewRequest("POST", "/dish/sockets", bytes.NewBufferString(`{"id": "invalid_socket", "host_name": " "}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	ret = response{}
+	json.Unmarshal(w.Body.Bytes(), &ret)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.ElementsMatch(t, []core.FieldError{
+		{Field: "socket_name", Message: "required field is missing"},
+		{Field: "host_name", Message: "required field is blank"},
+	}, ret.Fields)
+
+	// read-only fields cannot be changed, missing ones are kept
+	req, _ = http.NewRequest("PUT", "/dish/sockets/defaults_socket", bytes.NewBufferString(`{
+		"id": "renamed_socket", "socket_name": "defaults", "host_name": "defaults.example.com"
+	}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	ret = response{}
+	json.Unmarshal(w.Body.Bytes(), &ret)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []core.FieldError{{Field: "id", Message: "read-only field cannot be changed"}}, ret.Fields)
+
+	req, _ = http.NewRequest("PUT", "/dish/sockets/defaults_socket", bytes.NewBufferString(`{
+		"socket_name": "defaults", "host_name": "defaults.example.com", "muted": false
+	}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	ret = response{}
+	json.Unmarshal(w.Body.Bytes(), &ret)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "defaults_socket", ret.Socket.ID)
+	assert.Equal(t, false, ret.Socket.Muted)
+
+	req, _ = http.NewRequest("DELETE", "/dish/sockets/defaults_socket", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSocketSchema(t *testing.T) {
+	schema := core.JSONSchema(Socket{})
+
+	props := schema["properties"].(map[string]any)
+
+	assert.Equal(t, "dish.Socket", schema["title"])
+	assert.ElementsMatch(t, []string{"id", "socket_name", "host_name"}, schema["required"])
+	assert.Equal(t, map[string]any{"type": "string", "readOnly": true}, props["id"])
+	assert.Equal(t, map[string]any{"type": "boolean", "default": true}, props["muted"])
+	assert.Equal(t, map[string]any{"type": "array", "items": map[string]any{"type": "string"}}, props["dish_target"])
+}
+
 func TestGetSocketListByHost(t *testing.T) {
 	r := core.SetupTestEnv(TestPackage)
 
@@ -1,12 +0,0 @@
-package dish
-
-// contains checks if a string is present in a slice
-// https://freshman.tech/snippets/go/check-if-slice-contains-element/
-func contains(s []string, str string) bool {
-	for _, v := range s {
-		if v == str {
-			return true
-		}
-	}
-	return false
-}
@@ -33,13 +33,13 @@ type Socket struct {
 	DishTarget []string `json:"dish_target"`
 
 	// Muted bool indicates that the socket is not propagated to any dish if true.
-	Muted bool `json:"muted" default:true`
+	Muted bool `json:"muted" default:"true"`
 
 	// MutedFrom UNIX timestamp.
 	MutedFrom int64 `json:"muted_from"`
 
 	// FailCount indicates how many times socket has to be in failed state before alerting.
-	FailCount int `json:"fail_count" default:0`
+	FailCount int `json:"fail_count" default:"0"`
 
 	// ResponseTime is the time for the request to be processed.
 	ResponseTime float64 `json:"response_time"`
@@ -51,13 +51,13 @@ type Socket struct {
 	SLATime float64 `json:"sla_time"`
 
 	// Healthy boolean indicates wheter is socket okay, or the way around.
-	Healthy bool `json:"healthy" default:false`
+	Healthy bool `json:"healthy" default:"false"`
 
 	// Public boolean tells the frontendee to show itself.
-	Public bool `json:"public" default:false`
+	Public bool `json:"public" default:"false"`
 
 	// Maintenance boolean states for the M. mode being applied to such socket/endpoint.
-	Maintenance bool `json:"maintenance" default>false`
+	Maintenance bool `json:"maintenance" default:"false"`
 }
 
 type Incident struct {
@@ -90,7 +90,7 @@ type Incident struct {
 	Reason string `json:"reason"`
 
 	// Public indicates the state of visibility for all.
-	Public bool `json:"public" default:false`
+	Public bool `json:"public" default:"false"`
 
 	// Other commentary to the incident.
 	Comment string `json:"comment"`
@@ -27,7 +27,7 @@ func Routes(g *gin.RouterGroup) {
 	g.PUT("/incidents/:key",
 		UpdateIncidentByKey)
 	g.PATCH("/incidents/:key",
-		UpdateIncidentByKey)
+		PatchIncidentByKey)
 	g.DELETE("/incidents/:key",
 		DeleteIncidentByKey)
 
@@ -47,7 +47,7 @@ func Routes(g *gin.RouterGroup) {
 	g.PUT("/sockets/:key",
 		UpdateSocketByKey)
 	g.PATCH("/sockets/:key",
-		UpdateSocketByKey)
+		PatchSocketByKey)
 	g.PUT("/sockets/:key/mute",
 		MuteToggleSocketByKey)
 	g.PUT("/sockets/:key/maintenance",
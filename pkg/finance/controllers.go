@@ -10,24 +10,42 @@ import (
 )
 
 var (
-	CacheAccounts *core.Cache
-	CacheItems    *core.Cache
+	CacheAccounts = &core.Cache[Account]{}
+	CacheItems    = &core.Cache[Item]{}
 
-	caches = []**core.Cache{
-		&CacheAccounts,
-		&CacheItems,
+	caches = []core.CacheInterface{
+		CacheAccounts,
+		CacheItems,
+	}
+	indexes = map[core.CacheInterface][]string{
+		CacheAccounts: {"account_owner"},
+		CacheItems:    {"account_id"},
+	}
+	owners = map[core.CacheInterface]string{
+		CacheAccounts: "account_owner",
 	}
 	pkgName string = "finance"
 )
 
 var Package *core.Package = &core.Package{
-	Name:   pkgName,
-	Cache:  caches,
+	Name:  pkgName,
+	Cache: caches,
+	CacheNames: []string{
+		"accounts",
+		"items",
+	},
 	Routes: Routes,
 	Subpackages: []string{
 		"accounts",
 		"items",
 	},
+	Indexes: indexes,
+	Owners:  owners,
+}
+
+func init() {
+	// The items are owned by their account's owner.
+	CacheItems.SetOwnerFunc(itemOwners)
 }
 
 var restorePackage = &core.RestorePackage{
@@ -41,10 +59,6 @@ var restorePackage = &core.RestorePackage{
 		"accounts",
 		"items",
 	},
-	SubpackageModels: map[string]any{
-		"accounts": Account{},
-		"items":    Item{},
-	},
 }
 
 /*
@@ -99,6 +113,18 @@ func UpdateAccountByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch finance account by ID
+// @Description patch finance account by ID (JSON merge patch)
+// @Tags finance
+// @Produce json
+// @Param request body finance.Account true "merge patch of the item"
+// @Success 200 {object} finance.Account
+// @Router /finance/accounts/{key} [patch]
+func PatchAccountByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Account](ctx, CacheAccounts, pkgName, Account{})
+	return
+}
+
 // @Summary Delete finance account by ID
 // @Description delete finance account by ID
 // @Tags finance
@@ -119,26 +145,11 @@ func DeleteAccountByKey(ctx *gin.Context) {
 // @Router /finance/accounts/owner/:key [get]
 func GetAccountByOwnerKey(ctx *gin.Context) {
 	owner := ctx.Param("key")
-	exportedAccounts := make(map[string]Account)
-	counter := 0
-
-	rawAccounts, _ := CacheAccounts.GetAll()
-
-	for _, rawAccount := range rawAccounts {
-		acc, ok := rawAccount.(Account)
-		if !ok {
-			continue
-		}
-
-		if acc.Owner == owner {
-			exportedAccounts[acc.ID] = acc
-			counter++
-		}
-	}
+	exportedAccounts := core.AccessibleItems(ctx, CacheAccounts, CacheAccounts.Lookup("account_owner", owner))
 
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
-		"count":   counter,
+		"count":   len(exportedAccounts),
 		"items":   exportedAccounts,
 		"message": "ok, dumping accounts by owner",
 		"owner":   owner,
@@ -199,6 +210,18 @@ func UpdateItemByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch account item by its key
+// @Description patch account item ba its key (JSON merge patch)
+// @Tags finance
+// @Produce json
+// @Param request body finance.Item true "merge patch of the item"
+// @Success 200 {object} finance.Item
+// @Router /finance/items/{key} [patch]
+func PatchItemByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Item](ctx, CacheItems, pkgName, Item{})
+	return
+}
+
 // @Summary Delete account item by its ID
 // @Description delete account item by its ID
 // @Tags finance
@@ -219,26 +242,11 @@ func DeleteItemByKey(ctx *gin.Context) {
 // @Router /finance/items/account/:key [get]
 func GetItemsByAccountID(ctx *gin.Context) {
 	acc := ctx.Param("key")
-	exportedItems := make(map[string]Item)
-	counter := 0
-
-	rawItems, _ := CacheItems.GetAll()
-
-	for _, rawItem := range rawItems {
-		item, ok := rawItem.(Item)
-		if !ok {
-			continue
-		}
-
-		if item.AccountID == acc {
-			exportedItems[item.ID] = item
-			counter++
-		}
-	}
+	exportedItems := core.AccessibleItems(ctx, CacheItems, CacheItems.Lookup("account_id", acc))
 
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
-		"count":   counter,
+		"count":   len(exportedItems),
 		"items":   exportedItems,
 		"message": "ok, dumping items by accountID",
 		"account": acc,
@@ -264,6 +272,11 @@ func DoTaxesByOwner(ctx *gin.Context) {
 	tax := Tax{}
 	counter := 0
 
+	if user, scoped := core.OwnerScope(ctx); scoped && user != owner {
+		core.PrintOwnerScopeError(ctx, pkgName, owner)
+		return
+	}
+
 	y := ctx.Param("year")
 	year, err := strconv.Atoi(y)
 	if err != nil {
@@ -276,48 +289,16 @@ func DoTaxesByOwner(ctx *gin.Context) {
 		return
 	}
 
-	accounts := make(map[string]Account)
 	items := make(map[string][]Item)
 	keys := []string{}
 
-	// fetch users's account(s)
-	rawAccounts, _ := CacheAccounts.GetAll()
-	for key, rawAccount := range rawAccounts {
-		acc, ok := rawAccount.(Account)
-		if !ok {
-			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-				"code":    http.StatusInternalServerError,
-				"message": "cannot assert type, backend data error",
-				"tax":     tax,
-				"account": key,
-				"key":     owner,
-			})
-			return
-		}
-
-		if acc.Owner == owner {
-			accounts[acc.ID] = acc
-			keys = append(keys, key)
-		}
-	}
-
-	// fetch all items and filter out only those for gotten accounts
-	rawItems, _ := CacheItems.GetAll()
-	for key, rawItem := range rawItems {
-		item, ok := rawItem.(Item)
-		if !ok {
-			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-				"code":    http.StatusInternalServerError,
-				"message": "cannot assert type, backend data error",
-				"tax":     tax,
-				"item":    key,
-				"key":     owner,
-			})
-			return
-		}
+	// fetch users's account(s) and their items by the indexes
+	accounts := CacheAccounts.Lookup("account_owner", owner)
+	for key := range accounts {
+		keys = append(keys, key)
 
-		if contains(keys, item.AccountID) {
-			items[item.AccountID] = append(items[item.AccountID], item)
+		for _, item := range CacheItems.Lookup("account_id", key) {
+			items[key] = append(items[key], item)
 		}
 	}
 
@@ -434,6 +415,9 @@ func GetRootData(ctx *gin.Context) {
 	accounts, _ := CacheAccounts.GetAll()
 	items, _ := CacheItems.GetAll()
 
+	accounts = core.AccessibleItems(ctx, CacheAccounts, accounts)
+	items = core.AccessibleItems(ctx, CacheItems, items)
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":     http.StatusOK,
 		"message":  "ok, dumping dish root",
@@ -475,7 +459,7 @@ func PostDumpRestore2(ctx *gin.Context) {
 			continue
 		}
 
-		CacheAccounts.Set(key, item)
+		CacheAccounts.SetContext(ctx, key, item)
 		counter[0]++
 	}
 
@@ -484,7 +468,7 @@ func PostDumpRestore2(ctx *gin.Context) {
 			continue
 		}
 
-		CacheItems.Set(key, item)
+		CacheItems.SetContext(ctx, key, item)
 		counter[1]++
 	}
 
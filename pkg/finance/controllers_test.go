@@ -10,19 +10,22 @@ import (
 
 	"go.vxn.dev/swis/v5/pkg/core"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 // app = array of pointers to pointers to Cache
-type appCache []**core.Cache
+type appCache []core.CacheInterface
 
 var TestPackage *core.Package = &core.Package{
 	Name: pkgName,
-	Cache: []**core.Cache{
-		&CacheAccounts,
-		&CacheItems,
+	Cache: []core.CacheInterface{
+		CacheAccounts,
+		CacheItems,
 	},
-	Routes: Routes,
+	Routes:  Routes,
+	Indexes: indexes,
+	Owners:  owners,
 }
 
 /*
@@ -281,6 +284,59 @@ func TestGetItems(t *testing.T) {
 	assert.NotEmpty(t, items.Items)
 }
 
+func TestGetItemsQuery(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	type page struct {
+		Items      map[string]map[string]any `json:"items"`
+		Keys       []string                  `json:"keys"`
+		Total      int                       `json:"total"`
+		NextCursor string                    `json:"next_cursor"`
+	}
+
+	// filter and project
+	req, _ := http.NewRequest("GET", "/finance/items?type=income&account_id=test_acc&fields=amount", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var items page
+	json.Unmarshal(w.Body.Bytes(), &items)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"test_item2"}, items.Keys)
+	assert.Equal(t, map[string]any{"amount": 5.77}, items.Items["test_item2"])
+
+	// sort and page through
+	var keys []string
+	cursor := ""
+
+	for {
+		req, _ = http.NewRequest("GET", "/finance/items?sort=-amount&limit=1&cursor="+cursor, nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		items = page{}
+		json.Unmarshal(w.Body.Bytes(), &items)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 2, items.Total)
+
+		keys = append(keys, items.Keys...)
+		if cursor = items.NextCursor; cursor == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"test_item", "test_item2"}, keys)
+
+	// unknown fields are rejected
+	req, _ = http.NewRequest("GET", "/finance/items?colour=red", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestGetItemsByAccountID(t *testing.T) {
 	r := core.SetupTestEnv(TestPackage)
 
@@ -295,7 +351,7 @@ func TestGetItemsByAccountID(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), &items)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, 1, items.Count)
+	assert.Equal(t, 2, items.Count)
 	assert.NotEmpty(t, items.Items)
 }
 
@@ -340,3 +396,144 @@ func TestDeleteItemByKey(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "test_item2", ret.Key)
 }
+
+func TestOwnerScope(t *testing.T) {
+	core.SetupTestEnv(TestPackage)
+
+	// the requests are limited to alice's items as if by the alice's ACL entry 'finance:own'
+	r := gin.New()
+	r.Use(func(ctx *gin.Context) {
+		ctx.Set(core.ContextOwnerScope, "alice")
+	})
+	Routes(r.Group("/finance"))
+
+	account := Account{
+		AccountNumber: "123",
+		Currency:      "CZK",
+		SWIFT:         "CZxxx",
+		IBAN:          "CZ123",
+	}
+
+	account.ID, account.Owner = "alice_acc", "alice"
+	CacheAccounts.Set(account.ID, account)
+
+	account.ID, account.Owner = "bob_acc", "bob"
+	CacheAccounts.Set(account.ID, account)
+
+	// the items are owned by their account's owner
+	paid := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	item := func(id, account string) *Item {
+		return &Item{ID: id, Type: "income", Amount: 100, Currency: "CZK", AccountID: account, PaymentDate: paid}
+	}
+
+	CacheItems.Set("alice_item", *item("alice_item", "alice_acc"))
+	CacheItems.Set("bob_item", *item("bob_item", "bob_acc"))
+
+	req, _ := http.NewRequest("GET", "/finance/accounts", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var items = struct {
+		Accounts map[string]Account `json:"items"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &items)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, items.Accounts, "alice_acc")
+	for _, acc := range items.Accounts {
+		assert.Equal(t, "alice", acc.Owner)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		body         any
+		code         int
+	}{
+		{"GET", "/finance/accounts/alice_acc", nil, http.StatusOK},
+		{"GET", "/finance/accounts/bob_acc", nil, http.StatusNotFound},
+		{"DELETE", "/finance/accounts/bob_acc", nil, http.StatusNotFound},
+		{"PUT", "/finance/accounts/alice_acc", &Account{ID: "alice_acc", AccountNumber: "123", Currency: "CZK", SWIFT: "CZxxx", IBAN: "CZ123", Owner: "bob"}, http.StatusForbidden},
+		{"POST", "/finance/accounts", &Account{ID: "bob_acc2", AccountNumber: "123", Currency: "CZK", SWIFT: "CZxxx", IBAN: "CZ123", Owner: "bob"}, http.StatusForbidden},
+		{"GET", "/finance/taxes/bob/2024", nil, http.StatusForbidden},
+		{"POST", "/finance/restore", &Account{}, http.StatusForbidden},
+		{"GET", "/finance/items/alice_item", nil, http.StatusOK},
+		{"GET", "/finance/items/bob_item", nil, http.StatusNotFound},
+		{"DELETE", "/finance/items/bob_item", nil, http.StatusNotFound},
+		{"PUT", "/finance/items/alice_item", item("alice_item", "bob_acc"), http.StatusForbidden},
+		{"POST", "/finance/items", item("alice_item2", "bob_acc"), http.StatusForbidden},
+		{"POST", "/finance/items", item("alice_item3", "missing_acc"), http.StatusForbidden},
+		{"POST", "/finance/items", item("alice_item4", "alice_acc"), http.StatusCreated},
+	} {
+		var body []byte
+		if tc.body != nil {
+			body, _ = json.Marshal(tc.body)
+		}
+
+		req, _ := http.NewRequest(tc.method, tc.path, bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "%s %s", tc.method, tc.path)
+	}
+
+	bob, _ := CacheAccounts.Get("bob_acc")
+	assert.Equal(t, "bob", bob.Owner)
+
+	for _, tc := range []struct {
+		path string
+		keys []string
+	}{
+		{"/finance/items", []string{"alice_item", "alice_item4"}},
+		{"/finance/items/account/alice_acc", []string{"alice_item", "alice_item4"}},
+		{"/finance/items/account/bob_acc", nil},
+	} {
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var listed = struct {
+			Items map[string]Item `json:"items"`
+		}{}
+		json.Unmarshal(w.Body.Bytes(), &listed)
+
+		var keys []string
+		for key := range listed.Items {
+			keys = append(keys, key)
+		}
+
+		assert.Equal(t, http.StatusOK, w.Code, tc.path)
+		assert.ElementsMatch(t, tc.keys, keys, tc.path)
+	}
+
+	req, _ = http.NewRequest("GET", "/finance", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var root = struct {
+		Items map[string]Item `json:"items"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &root)
+
+	assert.Contains(t, root.Items, "alice_item")
+	assert.NotContains(t, root.Items, "bob_item")
+
+	// the taxes count the owner's items only
+	req, _ = http.NewRequest("GET", "/finance/taxes/alice/2024", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var taxes = struct {
+		Tax Tax `json:"tax"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &taxes)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 200.0, taxes.Tax.IncomeTotal)
+
+	// the items follow their account's owner
+	assert.True(t, CacheItems.Owns(*item("bob_item", "bob_acc"), "bob"))
+
+	account.ID, account.Owner = "bob_acc", "alice"
+	CacheAccounts.Set(account.ID, account)
+	assert.True(t, CacheItems.Owns(*item("bob_item", "bob_acc"), "alice"))
+}
@@ -1,12 +1,11 @@
 package finance
 
-// contains checks if a string is present in a slice
-// https://freshman.tech/snippets/go/check-if-slice-contains-element/
-func contains(s []string, str string) bool {
-	for _, v := range s {
-		if v == str {
-			return true
-		}
+// itemOwners returns the owner of the item's account, the items of missing accounts are owned by no one.
+func itemOwners(item Item) []string {
+	account, ok := CacheAccounts.Get(item.AccountID)
+	if !ok || account.Owner == "" {
+		return nil
 	}
-	return false
+
+	return []string{account.Owner}
 }
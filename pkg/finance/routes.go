@@ -23,6 +23,8 @@ func Routes(g *gin.RouterGroup) {
 		GetAccountByOwnerKey)
 	g.PUT("/accounts/:key",
 		UpdateAccountByKey)
+	g.PATCH("/accounts/:key",
+		PatchAccountByKey)
 	g.DELETE("/accounts/:key",
 		DeleteAccountByKey)
 
@@ -38,6 +40,8 @@ func Routes(g *gin.RouterGroup) {
 		GetItemsByAccountID)
 	g.PUT("/items/:key",
 		UpdateItemByKey)
+	g.PATCH("/items/:key",
+		PatchItemByKey)
 	g.DELETE("/items/:key",
 		DeleteItemByKey)
 
@@ -0,0 +1,51 @@
+package follower
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const pkgName = "system"
+
+// GetStatus prints the follower's sync status.
+func GetStatus(ctx *gin.Context) {
+	status, ok := CurrentStatus()
+	if !ok {
+		ctx.IndentedJSON(http.StatusOK, gin.H{
+			"code":    http.StatusOK,
+			"item":    status,
+			"message": "not a follower instance",
+			"package": pkgName,
+		})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"item":    status,
+		"message": "ok, dumping follower status",
+		"package": pkgName,
+	})
+}
+
+// PostPromote stops following the leader, so that the instance takes the writes (the failover).
+func PostPromote(ctx *gin.Context) {
+	if !Promote() {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{
+			"code":    http.StatusConflict,
+			"message": "not a follower instance",
+			"package": pkgName,
+		})
+		return
+	}
+
+	status, _ := CurrentStatus()
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"item":    status,
+		"message": "instance promoted, writes accepted",
+		"package": pkgName,
+	})
+}
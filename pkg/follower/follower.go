@@ -0,0 +1,287 @@
+package follower
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+)
+
+// pollWait is how long the leader holds the change feed request when there is no new change.
+const pollWait = 30 * time.Second
+
+var (
+	// retryBackoff is the delay after a failed sync, it doubles with each failure up to maxBackoff.
+	retryBackoff = time.Second
+	maxBackoff   = time.Minute
+
+	errLeaderGone = errors.New("changes no longer available at the leader")
+)
+
+// follower keeps the instance in sync with the leader: it loads the leader's export first, then it applies the
+// leader's change feed. The local writes are refused (or proxied to the leader) meanwhile.
+type follower struct {
+	leader string
+	token  string
+
+	// proxy forwards the local writes to the leader instead of refusing them.
+	proxy bool
+
+	client *http.Client
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// current is the follower started by Start, nil if the instance is not a follower.
+var (
+	current   *follower
+	currentMu sync.RWMutex
+)
+
+// Start makes the instance a follower of the leader (its base URL). The token is used to read the leader's export
+// and change feed, proxy makes the local writes forwarded to the leader. The caches have to be mounted already.
+func Start(leader, token string, proxy bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	f := &follower{
+		leader: leader,
+		token:  token,
+		proxy:  proxy,
+		client: &http.Client{Timeout: pollWait + 30*time.Second},
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: Status{Following: true, Leader: leader},
+	}
+
+	currentMu.Lock()
+	current = f
+	currentMu.Unlock()
+
+	go f.run(ctx)
+}
+
+// following returns the follower, if the instance still follows the leader.
+func following() *follower {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+
+	if current == nil {
+		return nil
+	}
+
+	current.mu.RLock()
+	defer current.mu.RUnlock()
+
+	if !current.status.Following {
+		return nil
+	}
+	return current
+}
+
+// Promote stops following the leader, the instance accepts the writes afterwards. It returns false if the instance
+// is not a follower.
+func Promote() bool {
+	currentMu.RLock()
+	f := current
+	currentMu.RUnlock()
+
+	if f == nil {
+		return false
+	}
+
+	f.mu.Lock()
+	wasFollowing := f.status.Following
+	f.status.Following = false
+	f.mu.Unlock()
+
+	f.cancel()
+	<-f.done
+
+	return wasFollowing
+}
+
+// CurrentStatus returns the follower's status, ok is false if the instance has never been a follower.
+func CurrentStatus() (Status, bool) {
+	currentMu.RLock()
+	f := current
+	currentMu.RUnlock()
+
+	if f == nil {
+		return Status{}, false
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.status, true
+}
+
+func (f *follower) run(ctx context.Context) {
+	defer close(f.done)
+
+	// The changes are recorded as made by the follower.
+	ctx = context.WithValue(ctx, core.ContextUserName, "follower")
+
+	backoff := retryBackoff
+
+	for ctx.Err() == nil {
+		f.mu.RLock()
+		offset := f.status.Offset
+		f.mu.RUnlock()
+
+		var err error
+		if offset == 0 {
+			err = f.bootstrap(ctx)
+		} else {
+			err = f.sync(ctx, offset)
+		}
+
+		if err == nil {
+			backoff = retryBackoff
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, errLeaderGone) {
+			// Start over from a new snapshot.
+			f.mu.Lock()
+			f.status.Offset = 0
+			f.mu.Unlock()
+		}
+
+		f.fail(err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+func (f *follower) fail(err error) {
+	log.Printf("follower: %s", err.Error())
+
+	now := time.Now()
+
+	f.mu.Lock()
+	f.status.LastError = err.Error()
+	f.status.LastErrorAt = &now
+	f.mu.Unlock()
+}
+
+func (f *follower) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.leader+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Auth-Token", f.token)
+
+	return f.client.Do(req)
+}
+
+// bootstrap replaces the local caches with the leader's export.
+func (f *follower) bootstrap(ctx context.Context) error {
+	resp, err := f.get(ctx, "/system/export")
+	if err != nil {
+		return fmt.Errorf("cannot fetch the leader's export: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot fetch the leader's export: %s", resp.Status)
+	}
+
+	offset, err := strconv.ParseUint(resp.Header.Get("X-Feed-Offset"), 10, 64)
+	if err != nil || offset == 0 {
+		return fmt.Errorf("leader's export has no feed offset")
+	}
+
+	var archive core.Archive
+	if err := json.NewDecoder(resp.Body).Decode(&archive); err != nil {
+		return fmt.Errorf("cannot decode the leader's export: %w", err)
+	}
+
+	reports, ok := core.ImportArchive(ctx, &archive)
+	if !ok {
+		data, _ := json.Marshal(reports)
+		return fmt.Errorf("cannot import the leader's export: %s", data)
+	}
+
+	now := time.Now()
+
+	f.mu.Lock()
+	f.status.Offset = offset
+	f.status.Bootstraps++
+	f.status.LastSyncAt = &now
+	f.mu.Unlock()
+
+	log.Printf("follower: loaded the snapshot of %s at offset %d", f.leader, offset)
+	return nil
+}
+
+// sync applies the leader's changes following the offset, it waits for them up to pollWait.
+func (f *follower) sync(ctx context.Context, offset uint64) error {
+	query := url.Values{
+		"after": {strconv.FormatUint(offset, 10)},
+		"wait":  {pollWait.String()},
+	}
+
+	resp, err := f.get(ctx, "/system/changes?"+query.Encode())
+	if err != nil {
+		return fmt.Errorf("cannot fetch the leader's changes: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusGone:
+		io.Copy(io.Discard, resp.Body)
+		return errLeaderGone
+	default:
+		return fmt.Errorf("cannot fetch the leader's changes: %s", resp.Status)
+	}
+
+	var page struct {
+		Items []core.FeedEvent `json:"items"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return fmt.Errorf("cannot decode the leader's changes: %w", err)
+	}
+
+	for _, ev := range page.Items {
+		if err := core.ApplyFeedEvent(ctx, ev); err != nil {
+			return err
+		}
+
+		f.mu.Lock()
+		f.status.Offset = ev.Offset
+		f.status.Applied++
+		f.mu.Unlock()
+	}
+
+	now := time.Now()
+
+	f.mu.Lock()
+	f.status.LastSyncAt = &now
+	f.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package follower
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type thing struct {
+	Name string `json:"name"`
+}
+
+var things = &core.Cache[thing]{}
+
+var TestPackage *core.Package = &core.Package{
+	Name: "things",
+	Cache: []core.CacheInterface{
+		things,
+	},
+	Routes: func(g *gin.RouterGroup) {
+		g.GET("", func(ctx *gin.Context) {
+			ctx.Status(http.StatusOK)
+		})
+		g.POST("", func(ctx *gin.Context) {
+			ctx.Status(http.StatusCreated)
+		})
+	},
+}
+
+// setupRouter mounts the test package behind the middleware.
+func setupRouter() *gin.Engine {
+	core.SetupTestEnv(TestPackage)
+
+	r := gin.New()
+	r.Use(Middleware())
+	r.POST(promotePath, PostPromote)
+	TestPackage.Routes(r.Group(TestPackage.Name))
+
+	return r
+}
+
+func TestFollower(t *testing.T) {
+	r := setupRouter()
+
+	const offset = 100
+
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Auth-Token") != "leader_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch req.URL.Path {
+		case "/system/export":
+			w.Header().Set("X-Feed-Offset", strconv.Itoa(offset))
+			json.NewEncoder(w).Encode(core.Archive{
+				Version: core.ArchiveVersion,
+				Caches: map[string]map[string]json.RawMessage{
+					"things": {"a": json.RawMessage(`{"name":"a"}`)},
+				},
+			})
+
+		case "/system/changes":
+			if req.URL.Query().Get("after") != strconv.Itoa(offset) {
+				// Nothing new, hold the request as the leader would.
+				time.Sleep(10 * time.Millisecond)
+				json.NewEncoder(w).Encode(gin.H{"items": []core.FeedEvent{}})
+				return
+			}
+
+			json.NewEncoder(w).Encode(gin.H{"items": []core.FeedEvent{
+				{Offset: offset + 1, Cache: "things", Key: "b", Op: "set", Value: json.RawMessage(`{"name":"b"}`)},
+				{Offset: offset + 2, Cache: "things", Key: "a", Op: "delete"},
+			}})
+		}
+	}))
+	defer leader.Close()
+
+	Start(leader.URL, "leader_token", false)
+
+	assert.Eventually(t, func() bool {
+		status, _ := CurrentStatus()
+		return status.Applied == uint64(2)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	items, count := things.GetAll()
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "b", items["b"].Name)
+
+	status, ok := CurrentStatus()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(offset+2), status.Offset)
+	assert.Equal(t, 1, status.Bootstraps)
+
+	// the writes are refused while following
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/things", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/things", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the promoted instance takes the writes
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", promotePath, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/things", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", promotePath, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
@@ -0,0 +1,45 @@
+package follower
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// promotePath is the route of the promotion, it is served by the follower itself.
+const promotePath = "/system/follower/promote"
+
+// Middleware refuses the local writes while the instance follows the leader, or forwards them to the leader if
+// the proxying is enabled. It has to follow the authentication middlewares.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			ctx.Next()
+			return
+		}
+
+		f := following()
+		if f == nil || ctx.FullPath() == promotePath {
+			ctx.Next()
+			return
+		}
+
+		if f.proxy {
+			target, err := url.Parse(f.leader)
+			if err == nil {
+				httputil.NewSingleHostReverseProxy(target).ServeHTTP(ctx.Writer, ctx.Request)
+				ctx.Abort()
+				return
+			}
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"code":    http.StatusServiceUnavailable,
+			"leader":  f.leader,
+			"message": "read-only follower instance, write to the leader",
+		})
+	}
+}
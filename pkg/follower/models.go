@@ -0,0 +1,25 @@
+package follower
+
+import (
+	"time"
+)
+
+// Status describes the follower mode of the instance.
+type Status struct {
+	// Following is true until the instance is promoted (or when it is not a follower at all).
+	Following bool `json:"following"`
+
+	// Leader is the base URL of the leader instance.
+	Leader string `json:"leader,omitempty"`
+
+	// Offset is the leader's change feed offset the instance is in sync with.
+	Offset uint64 `json:"offset"`
+
+	// Bootstraps counts the snapshots loaded from the leader, Applied the changes applied since.
+	Bootstraps int    `json:"bootstraps"`
+	Applied    uint64 `json:"applied"`
+
+	LastSyncAt  *time.Time `json:"last_sync_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
@@ -2,30 +2,35 @@ package infra
 
 import (
 	"net/http"
-	"os"
 	"time"
 
+	"go.vxn.dev/swis/v5/pkg/config"
 	"go.vxn.dev/swis/v5/pkg/core"
 
 	"github.com/gin-gonic/gin"
 )
 
 var (
-	CacheHosts    *core.Cache
-	CacheNetworks *core.Cache
-	CacheDomains  *core.Cache
-
-	caches = []**core.Cache{
-		&CacheDomains,
-		&CacheHosts,
-		&CacheNetworks,
+	CacheHosts    = &core.Cache[Host]{}
+	CacheNetworks = &core.Cache[Network]{}
+	CacheDomains  = &core.Cache[Domain]{}
+
+	caches = []core.CacheInterface{
+		CacheDomains,
+		CacheHosts,
+		CacheNetworks,
 	}
 	pkgName string = "infra"
 )
 
 var Package *core.Package = &core.Package{
-	Name:   pkgName,
-	Cache:  caches,
+	Name:  pkgName,
+	Cache: caches,
+	CacheNames: []string{
+		"domains",
+		"hosts",
+		"networks",
+	},
 	Routes: Routes,
 	Subpackages: []string{
 		"domains",
@@ -47,11 +52,6 @@ var restorePackage = &core.RestorePackage{
 		"hosts",
 		"networks",
 	},
-	SubpackageModels: map[string]any{
-		"domains":  Domain{},
-		"hosts":    Host{},
-		"networks": Network{},
-	},
 }
 
 // @Summary Get whole infrastructure
@@ -65,6 +65,10 @@ func GetInfrastructure(ctx *gin.Context) {
 	hosts, _ := CacheHosts.GetAll()
 	networks, _ := CacheNetworks.GetAll()
 
+	for key, host := range hosts {
+		hosts[key] = CacheHosts.View(ctx, host)
+	}
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":     http.StatusOK,
 		"message":  "ok, dumping infrastructure",
@@ -126,6 +130,18 @@ func UpdateDomainByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch domain by its Key
+// @Description patch domain by its Key (JSON merge patch)
+// @Tags infra
+// @Produce json
+// @Param request body infra.Domain true "merge patch of the item"
+// @Success 200 {object} infra.Domain
+// @Router /infra/domains/{key} [patch]
+func PatchDomainByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Domain](ctx, CacheDomains, pkgName, Domain{})
+	return
+}
+
 // @Summary Delete domain by its Key
 // @Description delete domain by its Key
 // @Tags infra
@@ -148,7 +164,7 @@ func DeleteDomainByKey(ctx *gin.Context) {
 func PostDomainDeploymentByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
 
-	rawDomain, ok := CacheDomains.Get(key)
+	domain, ok := CacheDomains.Get(key)
 	if !ok {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
@@ -159,26 +175,13 @@ func PostDomainDeploymentByKey(ctx *gin.Context) {
 		return
 	}
 
-	var domain Domain
-
-	domain, ok = rawDomain.(Domain)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"message": "cannot assert Domain data type",
-			"package": pkgName,
-			"key":     key,
-		})
-		return
-	}
-
-	email := os.Getenv("CF_API_EMAIL")
-	token := os.Getenv("CF_API_TOKEN")
+	email := config.Current().Cloudflare.APIEmail
+	token := config.Current().Cloudflare.APIToken
 
 	if email == "" || token == "" {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
-			"message": "Cloudflare API key and e-mail not provided as ENV variables",
+			"message": "Cloudflare API key and e-mail not configured",
 			"package": pkgName,
 		})
 		return
@@ -232,7 +235,7 @@ func PostDomainDeploymentByKey(ctx *gin.Context) {
 func PostDomainMailReportByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
 
-	rawDomain, ok := CacheDomains.Get(key)
+	domain, ok := CacheDomains.Get(key)
 	if !ok {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
@@ -243,19 +246,6 @@ func PostDomainMailReportByKey(ctx *gin.Context) {
 		return
 	}
 
-	var domain Domain
-
-	domain, ok = rawDomain.(Domain)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"message": "cannot assert Domain data type",
-			"package": pkgName,
-			"key":     key,
-		})
-		return
-	}
-
 	var report SimpleReport
 
 	if err := ctx.BindJSON(&report); err != nil {
@@ -281,7 +271,7 @@ func PostDomainMailReportByKey(ctx *gin.Context) {
 
 	newReports = append(newReports, report)
 
-	if saved := CacheDomains.Set(key, domain); !saved {
+	if saved := CacheDomains.SetContext(ctx, key, domain); !saved {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"key":     key,
@@ -337,7 +327,7 @@ func GetHostByKey(ctx *gin.Context) {
 // @Router /infra/hosts/{key}/config [post]
 func PostHostConfigByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
-	rawHost, ok := CacheHosts.Get(key)
+	host, ok := CacheHosts.Get(key)
 	config := Configuration{}
 
 	// look up the host
@@ -352,17 +342,6 @@ func PostHostConfigByKey(ctx *gin.Context) {
 	}
 
 	// assert type Host to the fetched raw data
-	host, ok := rawHost.(Host)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"key":     key,
-			"message": "cannot assert data type, database internal error",
-			"package": pkgName,
-		})
-		return
-	}
-
 	// load the payload into configuration struct, must bind
 	if err := ctx.BindJSON(&config); err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
@@ -375,10 +354,12 @@ func PostHostConfigByKey(ctx *gin.Context) {
 		return
 	}
 
-	// overwright the configuration
-	host.Configuration = config
-
-	if saved := CacheHosts.Set(key, host); !saved {
+	// overwrite the configuration only, other fields may have been changed meanwhile (e.g. facts)
+	host, rev, err := CacheHosts.Update(ctx, key, func(host Host) Host {
+		host.Configuration = config
+		return host
+	})
+	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"key":     key,
@@ -388,9 +369,11 @@ func PostHostConfigByKey(ctx *gin.Context) {
 		return
 	}
 
+	ctx.Header("ETag", core.ETag(rev))
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
-		"item":    host,
+		"item":    CacheHosts.View(ctx, host),
 		"key":     key,
 		"message": "host's configuration updated",
 		"packege": pkgName,
@@ -407,7 +390,7 @@ func PostHostConfigByKey(ctx *gin.Context) {
 // @Router /infra/hosts/{key}/vmic [post]
 func PostHostVMICByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
-	rawHost, ok := CacheHosts.Get(key)
+	host, ok := CacheHosts.Get(key)
 	config := VMInstallConfig{}
 
 	// look up the host
@@ -422,17 +405,6 @@ func PostHostVMICByKey(ctx *gin.Context) {
 	}
 
 	// assert type Host to the fetched raw data
-	host, ok := rawHost.(Host)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"key":     key,
-			"message": "cannot assert data type, database internal error",
-			"package": pkgName,
-		})
-		return
-	}
-
 	// load the payload into VMIC struct, must bind
 	if err := ctx.BindJSON(&config); err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
@@ -446,21 +418,23 @@ func PostHostVMICByKey(ctx *gin.Context) {
 	}
 
 	// loop over children, add/overwrite their install configs
-	for idx, name := range host.Children {
-		if config.LocalName == name {
-			configs := host.ChildrenConfigs
-			if len(configs) == 0 {
-				configs = append(configs, config)
-			} else {
-				configs[idx] = config
+	host, rev, err := CacheHosts.Update(ctx, key, func(host Host) Host {
+		for idx, name := range host.Children {
+			if config.LocalName == name {
+				// copy the configs not to modify the cached item in place
+				configs := append([]VMInstallConfig{}, host.ChildrenConfigs...)
+				if len(configs) == 0 {
+					configs = append(configs, config)
+				} else {
+					configs[idx] = config
+				}
+				host.ChildrenConfigs = configs
+				break
 			}
-			host.ChildrenConfigs = configs
-			break
 		}
-	}
-
-	// save updated Host struct to backend
-	if saved := CacheHosts.Set(key, host); !saved {
+		return host
+	})
+	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"key":     key,
@@ -470,9 +444,11 @@ func PostHostVMICByKey(ctx *gin.Context) {
 		return
 	}
 
+	ctx.Header("ETag", core.ETag(rev))
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
-		"item":    host,
+		"item":    CacheHosts.View(ctx, host),
 		"key":     key,
 		"message": "host's VMIC updated",
 		"vm":      config.Name,
@@ -490,7 +466,7 @@ func PostHostVMICByKey(ctx *gin.Context) {
 func DeleteHostVMICByKeyAndVM(ctx *gin.Context) {
 	key := ctx.Param("key")
 	vm := ctx.Param("vm")
-	rawHost, ok := CacheHosts.Get(key)
+	host, ok := CacheHosts.Get(key)
 
 	// look up the host
 	if !ok {
@@ -503,29 +479,19 @@ func DeleteHostVMICByKeyAndVM(ctx *gin.Context) {
 		return
 	}
 
-	// assert type Host to the fetched raw data
-	host, ok := rawHost.(Host)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"key":     key,
-			"message": "cannot assert data type, database internal error",
-			"package": pkgName,
-		})
-		return
-	}
-
 	// loop over children, search for key with requested VM name
-	for idx, name := range host.Children {
-		if vm == name {
-			configs := host.ChildrenConfigs
-			configs[idx] = VMInstallConfig{}
-			host.ChildrenConfigs = configs
+	host, rev, err := CacheHosts.Update(ctx, key, func(host Host) Host {
+		for idx, name := range host.Children {
+			if vm == name {
+				// copy the configs not to modify the cached item in place
+				configs := append([]VMInstallConfig{}, host.ChildrenConfigs...)
+				configs[idx] = VMInstallConfig{}
+				host.ChildrenConfigs = configs
+			}
 		}
-	}
-
-	// save the updated Host struct to backend
-	if saved := CacheHosts.Set(key, host); !saved {
+		return host
+	})
+	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"key":     key,
@@ -535,9 +501,11 @@ func DeleteHostVMICByKeyAndVM(ctx *gin.Context) {
 		return
 	}
 
+	ctx.Header("ETag", core.ETag(rev))
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
-		"item":    host,
+		"item":    CacheHosts.View(ctx, host),
 		"key":     key,
 		"message": "host's VMIC deleted",
 		"vm":      vm,
@@ -555,7 +523,7 @@ func DeleteHostVMICByKeyAndVM(ctx *gin.Context) {
 // @Router /infra/hosts/{key}/facts [post]
 func PostHostFactsByKey(ctx *gin.Context) {
 	key := ctx.Param("key")
-	rawHost, ok := CacheHosts.Get(key)
+	host, ok := CacheHosts.Get(key)
 	facts := Facts{}
 
 	// look up the host
@@ -570,17 +538,6 @@ func PostHostFactsByKey(ctx *gin.Context) {
 	}
 
 	// assert type Host to the fetched raw data
-	host, ok := rawHost.(Host)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"key":     key,
-			"message": "cannot assert data type, database internal error",
-			"package": pkgName,
-		})
-		return
-	}
-
 	// load the payload into facts struct, must bind
 	if err := ctx.BindJSON(&facts); err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
@@ -593,10 +550,12 @@ func PostHostFactsByKey(ctx *gin.Context) {
 		return
 	}
 
-	// overwright the facts
-	host.Facts = facts
-
-	if saved := CacheHosts.Set(key, host); !saved {
+	// overwrite the facts only, other fields may have been changed meanwhile (e.g. configuration)
+	host, rev, err := CacheHosts.Update(ctx, key, func(host Host) Host {
+		host.Facts = facts
+		return host
+	})
+	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"key":     key,
@@ -606,9 +565,11 @@ func PostHostFactsByKey(ctx *gin.Context) {
 		return
 	}
 
+	ctx.Header("ETag", core.ETag(rev))
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
-		"item":    host,
+		"item":    CacheHosts.View(ctx, host),
 		"key":     key,
 		"message": "host's facts updated",
 		"packege": pkgName,
@@ -640,6 +601,18 @@ func UpdateHostByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch host by its Key
+// @Description patch host by its Key (JSON merge patch)
+// @Tags infra
+// @Produce json
+// @Param request body infra.Host true "merge patch of the item"
+// @Success 200 {object} infra.Host
+// @Router /infra/hosts/{key} [patch]
+func PatchHostByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Host](ctx, CacheHosts, pkgName, Host{})
+	return
+}
+
 // @Summary Delete host by its Key
 // @Description delete host by its Key
 // @Tags infra
@@ -704,6 +677,18 @@ func UpdateNetworkByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch network by its Key
+// @Description patch network by its Key (JSON merge patch)
+// @Tags infra
+// @Produce json
+// @Param request body infra.Network true "merge patch of the item"
+// @Success 200 {object} infra.Network
+// @Router /infra/networks/{key} [patch]
+func PatchNetworkByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Network](ctx, CacheNetworks, pkgName, Network{})
+	return
+}
+
 // @Summary Delete network by its Key
 // @Description delete network by its Key
 // @Tags infra
@@ -789,7 +774,7 @@ func PostDumpRestore2(ctx *gin.Context) {
 			continue
 		}
 
-		CacheDomains.Set(key, item)
+		CacheDomains.SetContext(ctx, key, item)
 		counter[0]++
 	}
 
@@ -798,7 +783,7 @@ func PostDumpRestore2(ctx *gin.Context) {
 			continue
 		}
 
-		CacheHosts.Set(key, item)
+		CacheHosts.SetContext(ctx, key, item)
 		counter[1]++
 	}
 
@@ -807,7 +792,7 @@ func PostDumpRestore2(ctx *gin.Context) {
 			continue
 		}
 
-		CacheNetworks.Set(key, item)
+		CacheNetworks.SetContext(ctx, key, item)
 		counter[2]++
 	}
 
@@ -13,14 +13,14 @@ import (
 )
 
 // app = array of pointers to pointers to Cache
-type appCache []**core.Cache
+type appCache []core.CacheInterface
 
 var TestPackage *core.Package = &core.Package{
 	Name: pkgName,
-	Cache: []**core.Cache{
-		&CacheDomains,
-		&CacheHosts,
-		&CacheNetworks,
+	Cache: []core.CacheInterface{
+		CacheDomains,
+		CacheHosts,
+		CacheNetworks,
 	},
 	Routes: Routes,
 }
@@ -314,6 +314,51 @@ func TestUpdateHostByKey(t *testing.T) {
 	assert.Equal(t, host.HostnameFQDN, ret.Host.HostnameFQDN)
 }
 
+func TestUpdateHostByKeyIfMatch(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	req, _ := http.NewRequest("GET", "/infra/hosts/test_host", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	etag := w.Header().Get("ETag")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, etag)
+
+	var host Host = Host{
+		ID:            "test_host",
+		HostnameShort: "host",
+		HostnameFQDN:  "host.dev.example.com",
+	}
+
+	jsonValue, _ := json.Marshal(host)
+
+	// the first update wins and changes the revision
+	req, _ = http.NewRequest("PUT", "/infra/hosts/test_host", bytes.NewBuffer(jsonValue))
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// the second one with the same (stale) revision is refused
+	req, _ = http.NewRequest("PUT", "/infra/hosts/test_host", bytes.NewBuffer(jsonValue))
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	req, _ = http.NewRequest("DELETE", "/infra/hosts/test_host", nil)
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
 func TestDeleteHostByKey(t *testing.T) {
 	r := core.SetupTestEnv(TestPackage)
 
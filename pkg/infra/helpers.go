@@ -6,8 +6,9 @@ import (
 	"errors"
 	"io"
 	"net/http"
-	"os"
 	"strings"
+
+	"go.vxn.dev/swis/v5/pkg/config"
 )
 
 // https://developers.cloudflare.com/api/operations/dns-records-for-a-zone-create-dns-record
@@ -95,8 +96,9 @@ func callCfAPI(zoneID string, payload interface{}) error {
 	}
 
 	// set request headers according to the Cloudflare API docs
-	reqest.Header.Set("X-Auth-Email", os.Getenv("CF_API_EMAIL"))
-	reqest.Header.Set("X-Auth-Key", os.Getenv("CF_API_TOKEN"))
+	cloudflare := config.Current().Cloudflare
+	reqest.Header.Set("X-Auth-Email", cloudflare.APIEmail)
+	reqest.Header.Set("X-Auth-Key", cloudflare.APIToken)
 	reqest.Header.Set("Content-Type", "application/json")
 
 	client := http.Client{}
@@ -2,6 +2,8 @@ package infra
 
 import (
 	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
 )
 
 type Infrastructures struct {
@@ -41,7 +43,7 @@ type Domain struct {
 	RegistrarName string `json:"registrar_name"`
 
 	// Private details (e.g. addresses, phone number etc in WHOIS)
-	PrivateDetails bool `json:"private_details" default:false`
+	PrivateDetails bool `json:"private_details" default:"false"`
 
 	// Cloudflare Zone ID
 	CfZoneID string `json:"cf_zone_id"`
@@ -154,7 +156,7 @@ type Configuration struct {
 	// ansible root vars
 	AnsibleHost string `json:"ansible_host" yaml:"ansible_host"`
 	AnsibleUser string `json:"ansible_user" yaml:"ansible_user"`
-	Become      bool   `json:"become" yaml:"become" default:true`
+	Become      bool   `json:"become" yaml:"become" default:"true"`
 	BecomeUser  string `json:"become_user" yaml:"become_user"`
 
 	// backup role
@@ -162,93 +164,93 @@ type Configuration struct {
 
 	// base role
 	// https://www.patorjk.com/software/taag/#p=display&f=ANSI%20Regular&t=stokrle
-	BaseMotd        string `json:"base_motd" yaml:"ascii_art_motd" default:false`
+	BaseMotd        string `json:"base_motd" yaml:"ascii_art_motd"`
 	BaseDescription string `json:"base_description" yaml:"host_description"`
 	BaseNSPrimary   string `json:"nameserver_primary" yaml:"nameserver_internal"`
 	BaseNSSecondary string `json:"nameserver_secondary" yaml:"nameserver_external"`
 
 	// container role
-	ContainerInstallk8sControl bool   `json:"install_k8s_control_node" yaml:"install_k8s_control_node" default:false`
-	ContainerInstallk8sWorker  bool   `json:"install_k8s_worker_node" yaml:"install_k8s_worker_node" default:false`
+	ContainerInstallk8sControl bool   `json:"install_k8s_control_node" yaml:"install_k8s_control_node" default:"false"`
+	ContainerInstallk8sWorker  bool   `json:"install_k8s_worker_node" yaml:"install_k8s_worker_node" default:"false"`
 	GolangVersion              string `json:"golang_version" yaml:"golang_version"`
 
 	// dialin-nas role
-	DialInPresent   bool `json:"dialin_present" yaml:"dialin_present" default:false`
-	AsteriskPresent bool `json:"asterisk_present" yaml:"asterisk_present" default:false`
+	DialInPresent   bool `json:"dialin_present" yaml:"dialin_present" default:"false"`
+	AsteriskPresent bool `json:"asterisk_present" yaml:"asterisk_present" default:"false"`
 
 	// dns role
-	DNSServerPresent bool   `json:"dns_server_present" yaml:"dns_server_present" default:false`
+	DNSServerPresent bool   `json:"dns_server_present" yaml:"dns_server_present" default:"false"`
 	DMSServerType    string `json:"dns_server_type" yaml:"dns_server_type"`
 	DNSMasterIP      string `json:"dns_master_ip" yaml:"master_ip"`
 	DNSSlaveIP       string `json:"dns_slave_ip" yaml:"slave_ip"`
 
 	// ghar role
-	RunnerPresent      bool   `json:"runner_present" yaml:"runner_present" default:false`
-	RunnerAction       string `json:"runner_action" yaml:"runner_action"`
-	RunnerVersion      string `json:"runner_version" yaml:"runner_version"`
-	RunnerUser         string `json:"runner_user" yaml:"runner_user"`
-	RunnerGroup        string `json:"runner_group" yaml:"runner_group"`
-	RunnerConfigName   string `json:"runner_config_name" yaml:"runner_config_name"`
-	RunnerConfigLabels string `json:"runner_config_labels" yaml:"runner_config_labels"`
-	RunnerConfigToken  string `json:"runner_config_token" yaml:"runner_config_token"`
+	RunnerPresent      bool        `json:"runner_present" yaml:"runner_present" default:"false"`
+	RunnerAction       string      `json:"runner_action" yaml:"runner_action"`
+	RunnerVersion      string      `json:"runner_version" yaml:"runner_version"`
+	RunnerUser         string      `json:"runner_user" yaml:"runner_user"`
+	RunnerGroup        string      `json:"runner_group" yaml:"runner_group"`
+	RunnerConfigName   string      `json:"runner_config_name" yaml:"runner_config_name"`
+	RunnerConfigLabels string      `json:"runner_config_labels" yaml:"runner_config_labels"`
+	RunnerConfigToken  core.Secret `json:"runner_config_token" yaml:"runner_config_token"`
 
 	// hyp vars
-	IsHypervisor      bool   `json:"is_hypervisor" yaml:"is_hypervisor" default:false`
+	IsHypervisor      bool   `json:"is_hypervisor" yaml:"is_hypervisor" default:"false"`
 	HypPublicIP       string `json:"public_ip" yaml:"public_ip"`
 	HypPrivateIP      string `json:"private_ip" yaml:"private_ip"`
 	HypPrivateGateway string `json:"private_gateway" yaml:"private_gateway"`
 	HypPrivateNetmask string `json:"private_netmask" yaml:"private_netmask"`
 	HypPrivateNetwork string `json:"private_network" yaml:"private_network"`
 	HypPrivateCIDR    int    `json:"private_cidr" yaml:"private_cidr"`
-	HypSetupIPSec     bool   `json:"setup_ipsec" yaml:"setup_ipsec" default:false`
+	HypSetupIPSec     bool   `json:"setup_ipsec" yaml:"setup_ipsec" default:"false"`
 	HypDatacentre     string `json:"dc" yaml:"dc"`
 	HypDomain         string `json:"domain" yaml:"domain"`
 	HypDisk1          string `json:"disk1" yaml:"disk1"`
 	HypDisk2          string `json:"disk2" yaml:"disk2"`
 	HypDisk3          string `json:"disk3" yaml:"disk3"`
 	HypDisk4          string `json:"disk4" yaml:"disk4"`
-	HypRAID           bool   `json:"raid" yaml:"raid" default:false`
+	HypRAID           bool   `json:"raid" yaml:"raid" default:"false"`
 
 	// kpu role
-	KPUPresent bool `json:"kpu_present" yaml:"kpu_present" default:false`
+	KPUPresent bool `json:"kpu_present" yaml:"kpu_present" default:"false"`
 
 	// metrics role
-	BindExporterPresent    bool   `json:"bind_exporter_present" yaml:"bind_exporter_present" default:false`
-	LokiPresent            bool   `json:"loki_present" yaml:"loki_present" default:false`
+	BindExporterPresent    bool   `json:"bind_exporter_present" yaml:"bind_exporter_present" default:"false"`
+	LokiPresent            bool   `json:"loki_present" yaml:"loki_present" default:"false"`
 	LokiDockerTag          string `json:"loki_image_tag" yaml:"loki_image_tag"`
 	LokiURL                string `json:"loki_url" yaml:"loki_url" default:"loki.vxn.su"`
-	LokiPort               int    `json:"loki_port" yaml:"loki_port" default:3000`
-	GrafanaPresent         bool   `json:"grafana_present" yaml:"grafana_present" default:false`
+	LokiPort               int    `json:"loki_port" yaml:"loki_port" default:"3000"`
+	GrafanaPresent         bool   `json:"grafana_present" yaml:"grafana_present" default:"false"`
 	GrafanaDockerTag       string `json:"grafana_docker_tag_version" yaml:"grafana_docker_tag_version"`
 	GrafanaWebuiURL        string `json:"grafana_webui_url" yaml:"grafana_webui_url"`
 	GrafanaDockerVolume    string `json:"grafana_docker_volume_name" yaml:"grafana_docker_volume_name"`
 	GrafanaContainer       string `json:"grafana_container_name" yaml:"grafana_container_name"`
-	PrometheusPresent      bool   `json:"prometheus_present" yaml:"prometheus_present" default:false`
+	PrometheusPresent      bool   `json:"prometheus_present" yaml:"prometheus_present" default:"false"`
 	PrometheusWebuiURL     string `json:"prometheus_webui_url" yaml:"prometheus_webui_url"`
 	PrometheusDockerVolume string `json:"prometheus_docker_volume_name" yaml:"prometheus_docker_volume_name"`
 	PrometheusContainer    string `json:"prometheus_container_name" yaml:"prometheus_container_name"`
 	PrometheusDockerTag    string `json:"prometheus_image_tag" yaml:"prometheus_image_tag"`
 	PrometheusConfigDir    string `json:"prometheus_config_dir" yaml:"prometheus_config_dir"`
-	PromtailPresent        bool   `json:"promtail_present" yaml:"promtail_present" default:false`
+	PromtailPresent        bool   `json:"promtail_present" yaml:"promtail_present" default:"false"`
 
 	// net role
-	NetWireguarded bool `json:"is_wireguarded" yaml:"is_wireguarded" default:false`
+	NetWireguarded bool `json:"is_wireguarded" yaml:"is_wireguarded" default:"false"`
 
 	// postfix role
 	PostfixMyhostame       string `json:"postfix_myhostname" yaml:"postfix_myhostname"`
 	PostfixBanner          string `json:"postfix_smtpd_banner" yaml:"postfix_smtpd_banner"`
-	HasTLS                 bool   `json:"has_tls" yaml:"has_tls" default:false`
-	IsEdgeRelay            bool   `json:"is_edge_relay" yaml:"is_edge_relay" default:false`
-	IsRelay                bool   `json:"is_relay" yaml:"is_relay" default:false`
+	HasTLS                 bool   `json:"has_tls" yaml:"has_tls" default:"false"`
+	IsEdgeRelay            bool   `json:"is_edge_relay" yaml:"is_edge_relay" default:"false"`
+	IsRelay                bool   `json:"is_relay" yaml:"is_relay" default:"false"`
 	DkimSelector           string `json:"dkim_selector" yaml:"dkim_selector"`
-	PostfixExporterPresent bool   `json:"postfix_exporter_present" yaml:"postfix_exporter_present" default:false`
+	PostfixExporterPresent bool   `json:"postfix_exporter_present" yaml:"postfix_exporter_present" default:"false"`
 
 	// proxy role
-	IsBehindCf             bool   `json:"is_behind_cloudflare" yaml:"is_behind_cloudflare" default:false`
-	IsCDN                  bool   `json:"is_cdn" yaml:"is_cdn" default:false`
-	NginxPresent           bool   `json:"nginx_present" yaml:"ngnix_present" default:false`
-	NginxUseGeoIP          bool   `json:"use_geoip" yaml:"use_geoip" default:false`
-	TraefikPresent         bool   `json:"traefik_present" yaml:"traefik_present" default:true`
+	IsBehindCf             bool   `json:"is_behind_cloudflare" yaml:"is_behind_cloudflare" default:"false"`
+	IsCDN                  bool   `json:"is_cdn" yaml:"is_cdn" default:"false"`
+	NginxPresent           bool   `json:"nginx_present" yaml:"ngnix_present" default:"false"`
+	NginxUseGeoIP          bool   `json:"use_geoip" yaml:"use_geoip" default:"false"`
+	TraefikPresent         bool   `json:"traefik_present" yaml:"traefik_present" default:"true"`
 	TraefikWebuiURL        string `json:"traefik_webui_url" yaml:"taefik_webui_url"`
 	TraefikWebuiPort       int    `json:"traefik_webui_external_port" yaml:"traefik_webui_external_port"`
 	TraefikDockerNet       string `json:"traefik_docker_network_name" yaml:"traefik_docker_network_name"`
@@ -265,14 +267,14 @@ type VMInstallConfig struct {
 	VirtType     string `json:"virt_type" yaml:"virt_type" default:"kvm"`
 	XMLFileName  string `json:"xml_filename" yaml:"xml"`
 	Timezone     string `json:"timezone" yaml:"timezone" default:"Europe/Vienna"`
-	Autostart    bool   `json:"autostart" yaml:"autostart" default:false`
+	Autostart    bool   `json:"autostart" yaml:"autostart" default:"false"`
 	BaseOSRepo   string `json:"baseos_repo" yaml:"baseos_repo"`
 	OSType       string `json:"os_type" yaml:"os_type" default:"linux"`
 	OsVariant    string `json:"os_veriant" yaml:"os_variant"`
-	LockRoot     bool   `json:"lock_root" yaml:"lock_root" default:false`
+	LockRoot     bool   `json:"lock_root" yaml:"lock_root" default:"false"`
 	VCPUCount    int    `json:"vcpu_count" yaml:"vcpu_count"`
 	MemoryUnit   string `json:"memory_unit" yaml:"memory_unit" default:"MB"`
-	MemorySize   int    `json:"memory_size" yaml:"memory_size" default:2048`
+	MemorySize   int    `json:"memory_size" yaml:"memory_size" default:"2048"`
 	DiskType     string `json:"disk_type" yaml:"disk_type" default:"raw"`
 	DiskSource   string `json:"disk_source" yaml:"disk_source"`
 	DiskBus      string `json:"disk_bus" yaml:"disk_bus" default:"virtio"`
@@ -26,6 +26,8 @@ func Routes(g *gin.RouterGroup) {
 		PostDomainMailReportByKey)
 	g.PUT("/domains/:key",
 		UpdateDomainByKey)
+	g.PATCH("/domains/:key",
+		PatchDomainByKey)
 	g.DELETE("/domains/:key",
 		DeleteDomainByKey)
 
@@ -48,6 +50,8 @@ func Routes(g *gin.RouterGroup) {
 		DeleteHostVMICByKeyAndVM)
 	g.PUT("/hosts/:key",
 		UpdateHostByKey)
+	g.PATCH("/hosts/:key",
+		PatchHostByKey)
 	g.DELETE("/hosts/:key",
 		DeleteHostByKey)
 
@@ -62,6 +66,8 @@ func Routes(g *gin.RouterGroup) {
 		GetNetworkByKey)
 	g.PUT("/networks/:key",
 		UpdateNetworkByKey)
+	g.PATCH("/networks/:key",
+		PatchNetworkByKey)
 	g.DELETE("/networks/:key",
 		DeleteNetworkByKey)
 }
@@ -9,26 +9,26 @@ import (
 )
 
 var (
-	Cache *core.Cache
+	Cache = &core.Cache[Link]{}
 
-	caches = []**core.Cache{
-		&Cache,
+	caches = []core.CacheInterface{
+		Cache,
 	}
 	pkgName string = "links"
 )
 
 var Package *core.Package = &core.Package{
 	Name:    pkgName,
+	Cache:   caches,
 	Routes:  Routes,
 	Generic: true,
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"Cache"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
 }
 
 // GetLinks returns JSON serialized list of links and their properties.
@@ -102,6 +102,18 @@ func UpdateLinkByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch link by its Key
+// @Description patch link by its Key (JSON merge patch)
+// @Tags links
+// @Produce json
+// @Param request body links.Link true "merge patch of the item"
+// @Success 200 {object} links.Link
+// @Router /links/{key} [patch]
+func PatchLinkByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Link](ctx, Cache, pkgName, Link{})
+	return
+}
+
 // @Summary Delete link by its Key
 // @Description delete link by its Key
 // @Tags links
@@ -125,7 +137,7 @@ func ActiveToggleByKey(ctx *gin.Context) {
 	var hash string = ctx.Param("key")
 	var link Link
 
-	rawLink, ok := Cache.Get(hash)
+	link, ok := Cache.Get(hash)
 	if !ok {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
@@ -134,19 +146,10 @@ func ActiveToggleByKey(ctx *gin.Context) {
 		return
 	}
 
-	link, ok = rawLink.(Link)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"message": "cannot assert data type, database internal error",
-		})
-		return
-	}
-
 	// inverse the Active field value
 	link.Active = !link.Active
 
-	if saved := Cache.Set(hash, link); !saved {
+	if saved := Cache.SetContext(ctx, hash, link); !saved {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "link couldn't be saved to database",
@@ -14,5 +14,5 @@ type Link struct {
 	URL string `json:"url" binding:"required" required:"true"`
 
 	// Link's activated status.
-	Active bool `json:"active" default:false`
+	Active bool `json:"active" default:"false"`
 }
@@ -14,6 +14,8 @@ func Routes(g *gin.RouterGroup) {
 		GetLinkByKey)
 	g.PUT("/:key",
 		UpdateLinkByKey)
+	g.PATCH("/:key",
+		PatchLinkByKey)
 	g.DELETE("/:key",
 		DeleteLinkByKey)
 	g.PUT("/:key/active",
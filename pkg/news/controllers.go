@@ -12,10 +12,13 @@ import (
 )
 
 var (
-	Cache *core.Cache
+	Cache = &core.Cache[UserSource]{}
 
-	caches = []**core.Cache{
-		&Cache,
+	caches = []core.CacheInterface{
+		Cache,
+	}
+	owners = map[core.CacheInterface]string{
+		Cache: "user_name",
 	}
 	pkgName string = "news"
 )
@@ -27,14 +30,17 @@ var Package *core.Package = &core.Package{
 	Subpackages: []string{
 		"sources",
 	},
+	Owners: owners,
+
+	// Every news listing fetches the remote feeds.
+	RateLimit: 30,
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"Cache"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
 }
 
 // GetSources
@@ -84,6 +90,18 @@ func UpdateSourcesByUserKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch news sources by user key
+// @Description patch news sources by user key (JSON merge patch)
+// @Tags news
+// @Produce json
+// @Param request body news.UserSource true "merge patch of the item"
+// @Success 200 {object} news.UserSource
+// @Router /news/sources/{key} [patch]
+func PatchSourcesByUserKey(ctx *gin.Context) {
+	core.PatchItemByParam[UserSource](ctx, Cache, pkgName, UserSource{})
+	return
+}
+
 // @Summary Delete user sources by user key
 // @Description delete user sources by user key
 // @Tags news
@@ -128,8 +146,8 @@ func ListTypesSources(ctx *gin.Context) {
 func GetNewsByUserKey(ctx *gin.Context) {
 	user := ctx.Param("key")
 
-	rawUserSources, ok := Cache.Get(user)
-	if !ok {
+	userSources, ok := Cache.Get(user)
+	if !ok || !core.CanAccess(ctx, Cache, userSources) {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
 			"key":     user,
@@ -139,17 +157,6 @@ func GetNewsByUserKey(ctx *gin.Context) {
 		return
 	}
 
-	userSources, ok := rawUserSources.(UserSource)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"key":     user,
-			"message": "cannot assert data type, internal database error",
-			"package": pkgName,
-		})
-		return
-	}
-
 	//var R = []Rss{}
 	var items = []Item{}
 
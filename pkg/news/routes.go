@@ -18,6 +18,8 @@ func Routes(g *gin.RouterGroup) {
 		GetSourcesByUserKey)
 	g.PUT("/sources/:key",
 		UpdateSourcesByUserKey)
+	g.PATCH("/sources/:key",
+		PatchSourcesByUserKey)
 	g.DELETE("/sources/:key",
 		DeleteSourcesByUserKey)
 	g.POST("/sources/restore",
@@ -7,10 +7,10 @@ import (
 )
 
 var (
-	Cache *core.Cache
+	Cache = &core.Cache[Project]{}
 
-	caches = []**core.Cache{
-		&Cache,
+	caches = []core.CacheInterface{
+		Cache,
 	}
 	pkgName string = "projects"
 )
@@ -23,11 +23,10 @@ var Package *core.Package = &core.Package{
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"Cache"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
 }
 
 // GetProjects function dumps the projects cache contents.
@@ -78,6 +77,18 @@ func UpdateProjectByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch project by its ID
+// @Description patch project by its ID (JSON merge patch)
+// @Tags projects
+// @Produce json
+// @Param request body projects.Project true "merge patch of the item"
+// @Success 200 {object} projects.Project
+// @Router /projects/{key} [patch]
+func PatchProjectByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Project](ctx, Cache, pkgName, Project{})
+	return
+}
+
 // @Summary Delete project by its ID
 // @Description delete project by its ID
 // @Tags projects
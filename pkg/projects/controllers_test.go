@@ -14,8 +14,8 @@ import (
 
 var TestPackage *core.Package = &core.Package{
 	Name: pkgName,
-	Cache: []**core.Cache{
-		&Cache,
+	Cache: []core.CacheInterface{
+		Cache,
 	},
 	Routes: Routes,
 }
@@ -203,7 +203,7 @@ func BenchmarkUpdateProjectByKey(b *testing.B) {
 	jsonValue, _ := json.Marshal(project)
 
 	for i := 0; i < b.N; i++ {
-		Cache = &core.Cache{}
+		Cache = &core.Cache[Project]{}
 		req, _ := http.NewRequest("POST", "/projects", bytes.NewBuffer(jsonValue))
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
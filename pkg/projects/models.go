@@ -17,7 +17,7 @@ type Project struct {
 	Manager string `json:"project_manager"`
 
 	// Published boolean.
-	Published bool `json:"project_published" default:false`
+	Published bool `json:"project_published" default:"false"`
 
 	// Git repository link (not URL, without HTTP scheme).
 	Repository string `json:"project_repo"`
@@ -29,7 +29,7 @@ type Project struct {
 	Kanban string `json:"kanban_link"`
 
 	// Projects backuped boolean.
-	Backuped bool `json:"backuped" default:false`
+	Backuped bool `json:"backuped" default:"false"`
 
 	// URL to base page of the project (project's URL).
 	URL string `json:"project_url"`
@@ -14,6 +14,8 @@ func Routes(g *gin.RouterGroup) {
 		GetProjectByKey)
 	g.PUT("/:key",
 		UpdateProjectByKey)
+	g.PATCH("/:key",
+		PatchProjectByKey)
 	g.DELETE("/:key",
 		DeleteProjectByKey)
 	g.POST("/restore",
@@ -11,10 +11,10 @@ import (
 )
 
 var (
-	CacheTasks *core.Cache
+	CacheTasks = &core.Cache[Task]{}
 
-	caches = []**core.Cache{
-		&CacheTasks,
+	caches = []core.CacheInterface{
+		CacheTasks,
 	}
 	pkgName string = "queue"
 )
@@ -29,11 +29,10 @@ var Package *core.Package = &core.Package{
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"CacheTasks"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"CacheTasks"},
+	Subpackages: []string{},
 }
 
 // GetLinks returns JSON serialized list of tasks and their properties.
@@ -99,7 +98,7 @@ func PostNewTask(ctx *gin.Context) {
 	newTask.ID = id
 	newTask.LastChangeTimestamp = time.Now()
 
-	if saved := CacheTasks.Set(id, newTask); !saved {
+	if saved := CacheTasks.SetContext(ctx, id, newTask); !saved {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "task couldn't be saved to database",
@@ -150,6 +149,18 @@ func UpdateTaskByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch task by its Key
+// @Description patch task by its Key (JSON merge patch)
+// @Tags queue
+// @Produce json
+// @Param request body queue.Task true "merge patch of the item"
+// @Success 200 {object} queue.Task
+// @Router /queue/tasks/{key} [patch]
+func PatchTaskByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Task](ctx, CacheTasks, pkgName, Task{})
+	return
+}
+
 // @Summary Delete task by its Key
 // @Description delete task by its Key
 // @Tags queue
@@ -173,7 +184,7 @@ func ProcessedToggleByKey(ctx *gin.Context) {
 	var key string = ctx.Param("key")
 	var task Task
 
-	rawTask, ok := CacheTasks.Get(key)
+	task, ok := CacheTasks.Get(key)
 	if !ok {
 		ctx.IndentedJSON(http.StatusNotFound, gin.H{
 			"code":    http.StatusNotFound,
@@ -182,20 +193,11 @@ func ProcessedToggleByKey(ctx *gin.Context) {
 		return
 	}
 
-	task, ok = rawTask.(Task)
-	if !ok {
-		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"message": "cannot assert data type, database internal error",
-		})
-		return
-	}
-
 	// inverse the Processed field value
 	task.Processed = !task.Processed
 	task.LastChangeTimestamp = time.Now()
 
-	if saved := CacheTasks.Set(key, task); !saved {
+	if saved := CacheTasks.SetContext(ctx, key, task); !saved {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "task couldn't be saved to database",
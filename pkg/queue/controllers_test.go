@@ -14,8 +14,8 @@ import (
 
 var TestPackage *core.Package = &core.Package{
 	Name: pkgName,
-	Cache: []**core.Cache{
-		&CacheTasks,
+	Cache: []core.CacheInterface{
+		CacheTasks,
 	},
 	Routes: Routes,
 }
@@ -16,6 +16,8 @@ func Routes(g *gin.RouterGroup) {
 		GetTaskByKey)
 	g.PUT("/tasks/:key",
 		UpdateTaskByKey)
+	g.PATCH("/tasks/:key",
+		PatchTaskByKey)
 	g.DELETE("/tasks/:key",
 		DeleteTaskByKey)
 	g.PUT("/tasks/:key/processed",
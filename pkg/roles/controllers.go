@@ -7,10 +7,10 @@ import (
 )
 
 var (
-	Cache *core.Cache
+	Cache = &core.Cache[Role]{}
 
-	caches = []**core.Cache{
-		&Cache,
+	caches = []core.CacheInterface{
+		Cache,
 	}
 	pkgName string = "roles"
 )
@@ -23,11 +23,10 @@ var Package *core.Package = &core.Package{
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"Cache"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
 }
 
 // GetRoles returns JSON serialized list of roles and their properties.
@@ -78,6 +77,18 @@ func UpdateRoleByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch role by its Key
+// @Description patch role by its Key (JSON merge patch)
+// @Tags roles
+// @Produce json
+// @Param request body roles.Role true "merge patch of the item"
+// @Success 200 {object} roles.Role
+// @Router /roles/{key} [patch]
+func PatchRoleByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Role](ctx, Cache, pkgName, Role{})
+	return
+}
+
 // @Summary Delete role by its Key
 // @Description delete role by its Key
 // @Tags roles
@@ -11,8 +11,22 @@ type Role struct {
 	Description string `json:"description"`
 
 	// Basic Access-Control List field.
-	Admin bool `json:"administrator" default:false`
+	Admin bool `json:"administrator" default:"false"`
 
 	// Role status, by default it is inactive.
-	Active bool `json:"active" default:false`
+	Active bool `json:"active" default:"false"`
+
+	// Permissions granted by the role, ignored for administrator roles.
+	Permissions []Permission `json:"permissions"`
+}
+
+type Permission struct {
+	// Package the permission applies to (e.g. dish), * stands for any package.
+	Package string `json:"package" binding:"required" required:"true"`
+
+	// Route of the package (e.g. /sockets/results or /sockets/:key), blank for all the package's routes.
+	Path string `json:"path"`
+
+	// Allowed methods: read, write, delete or plain HTTP methods (e.g. POST), * stands for any method.
+	Methods []string `json:"methods" binding:"required" required:"true"`
 }
@@ -0,0 +1,106 @@
+package roles
+
+import (
+	"net/http"
+	"strings"
+)
+
+// methodClasses groups the HTTP methods to the permission levels.
+var methodClasses = map[string][]string{
+	"read":   {http.MethodGet, http.MethodHead, http.MethodOptions},
+	"write":  {http.MethodPost, http.MethodPut, http.MethodPatch},
+	"delete": {http.MethodDelete},
+}
+
+// legacyRoles stand for the role names hard-coded before the roles were consulted, they apply only when such role
+// is not defined in the Cache.
+var legacyRoles = map[string]Role{
+	"admin": {
+		ID:     "admin",
+		Name:   "admin",
+		Admin:  true,
+		Active: true,
+	},
+	"power": {
+		ID:     "power",
+		Name:   "power",
+		Active: true,
+		Permissions: []Permission{
+			{Package: "*", Methods: []string{"read", "write"}},
+		},
+	},
+}
+
+// Resolve returns the active roles of such names, unknown and inactive roles are skipped.
+func Resolve(names []string) []Role {
+	var resolved []Role
+
+	for _, name := range names {
+		role, ok := Cache.Get(name)
+		if !ok {
+			role, ok = legacyRoles[name]
+		}
+
+		if ok && role.Active {
+			resolved = append(resolved, role)
+		}
+	}
+
+	return resolved
+}
+
+// IsAdmin reports whether any of the active roles of such names is an administrator role.
+func IsAdmin(names []string) bool {
+	for _, role := range Resolve(names) {
+		if role.Admin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allows reports whether the role grants such method on the package's route (the gin route pattern without the
+// package prefix, e.g. /sockets/:key).
+func (r Role) Allows(pkg, path, method string) bool {
+	if !r.Active {
+		return false
+	}
+
+	if r.Admin {
+		return true
+	}
+
+	for _, perm := range r.Permissions {
+		if perm.Allows(pkg, path, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allows reports whether the permission covers such method on the package's route.
+func (p Permission) Allows(pkg, path, method string) bool {
+	if p.Package != "*" && p.Package != pkg {
+		return false
+	}
+
+	if p.Path != "" && strings.TrimSuffix(p.Path, "/") != strings.TrimSuffix(path, "/") {
+		return false
+	}
+
+	for _, allowed := range p.Methods {
+		if allowed == "*" || strings.EqualFold(allowed, method) {
+			return true
+		}
+
+		for _, m := range methodClasses[strings.ToLower(allowed)] {
+			if m == method {
+				return true
+			}
+		}
+	}
+
+	return false
+}
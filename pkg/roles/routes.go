@@ -14,6 +14,8 @@ func Routes(g *gin.RouterGroup) {
 		GetRoleByKey)
 	g.PUT("/:key",
 		UpdateRoleByKey)
+	g.PATCH("/:key",
+		PatchRoleByKey)
 	g.DELETE("/:key",
 		DeleteRoleByKey)
 	g.POST("/restore",
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"net/http"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Cache       = &core.Cache[ServiceAccount]{}
+	CacheTokens = &core.Cache[users.Token]{}
+
+	caches = []core.CacheInterface{
+		Cache,
+		CacheTokens,
+	}
+	indexes = map[core.CacheInterface][]string{
+		CacheTokens: {"user_name"},
+	}
+	pkgName string = "services"
+)
+
+var Package *core.Package = &core.Package{
+	Name:  pkgName,
+	Cache: caches,
+	CacheNames: []string{
+		"",
+		"tokens",
+	},
+	Routes:  Routes,
+	Generic: true,
+	Indexes: indexes,
+}
+
+var restorePackage = &core.RestorePackage{
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
+}
+
+func init() {
+	CacheTokens.SetView(users.ViewToken)
+}
+
+// GetServiceAccounts returns JSON serialized list of service accounts and their properties.
+// @Summary Get all service accounts
+// @Description get service accounts complete list
+// @Tags services
+// @Produce  json
+// @Success 200 {object} []services.ServiceAccount
+// @Router /services [get]
+func GetServiceAccounts(ctx *gin.Context) {
+	core.PrintAllRootItems(ctx, Cache, pkgName)
+	return
+}
+
+// @Summary Get service account by Key
+// @Description get service account by :key param
+// @Tags services
+// @Produce  json
+// @Success 200 {object} services.ServiceAccount
+// @Router /services/{key} [get]
+func GetServiceAccountByKey(ctx *gin.Context) {
+	core.PrintItemByParam[ServiceAccount](ctx, Cache, pkgName, ServiceAccount{})
+	return
+}
+
+// @Summary Add new service account
+// @Description add new service account
+// @Tags services
+// @Produce json
+// @Param request body services.ServiceAccount true "query params"
+// @Success 200 {object} services.ServiceAccount
+// @Router /services [post]
+func PostNewServiceAccount(ctx *gin.Context) {
+	core.AddNewItem[ServiceAccount](ctx, Cache, pkgName, ServiceAccount{})
+	return
+}
+
+// @Summary Update service account by its Key
+// @Description update service account by its Key
+// @Tags services
+// @Produce json
+// @Param request body services.ServiceAccount true "query params"
+// @Success 200 {object} services.ServiceAccount
+// @Router /services/{key} [put]
+func UpdateServiceAccountByKey(ctx *gin.Context) {
+	core.UpdateItemByParam[ServiceAccount](ctx, Cache, pkgName, ServiceAccount{})
+	return
+}
+
+// @Summary Patch service account by its Key
+// @Description patch service account by its Key (JSON merge patch)
+// @Tags services
+// @Produce json
+// @Param request body services.ServiceAccount true "merge patch of the item"
+// @Success 200 {object} services.ServiceAccount
+// @Router /services/{key} [patch]
+func PatchServiceAccountByKey(ctx *gin.Context) {
+	core.PatchItemByParam[ServiceAccount](ctx, Cache, pkgName, ServiceAccount{})
+	return
+}
+
+// @Summary Delete service account by its Key
+// @Description delete service account by its Key
+// @Tags services
+// @Produce json
+// @Param id path string true "service account Key"
+// @Success 200 {object} services.ServiceAccount.ID
+// @Router /services/{key} [delete]
+func DeleteServiceAccountByKey(ctx *gin.Context) {
+	core.DeleteItemByParam(ctx, Cache, pkgName)
+	return
+}
+
+// PostDumpRestore
+// @Summary Upload service accounts dump backup -- restores all service accounts
+// @Description update service accounts JSON dump
+// @Tags services
+// @Accept json
+// @Produce json
+// @Router /services/restore [post]
+func PostDumpRestore(ctx *gin.Context) {
+	core.BatchRestoreItems[ServiceAccount](ctx, restorePackage)
+	return
+}
+
+// @Summary List package model's field types
+// @Description list package model's field types
+// @Tags services
+// @Accept json
+// @Produce json
+// @Router /services/types [get]
+func ListTypes(ctx *gin.Context) {
+	core.ParsePackageType(ctx, pkgName, ServiceAccount{})
+	return
+}
+
+// GetServiceAccountTokens lists the service account's tokens without their secrets.
+// @Summary List service account's tokens
+// @Description list service account's tokens (hashes omitted)
+// @Tags services
+// @Produce json
+// @Param  key  path  string  true  "service account key"
+// @Success 200 {object} []users.Token
+// @Router /services/{key}/tokens [get]
+func GetServiceAccountTokens(ctx *gin.Context) {
+	if findTokenOwner(ctx) {
+		users.PrintTokens(ctx, CacheTokens, ctx.Param("key"), pkgName)
+	}
+	return
+}
+
+// PostNewServiceAccountToken generates a new token for the service account, the token string is returned only once.
+// @Summary Create service account's token
+// @Description create a named token, the secret is shown only in this response
+// @Tags services
+// @Produce json
+// @Param  key  path  string  true  "service account key"
+// @Param request body users.Token true "token name and optional expiry"
+// @Success 201 {object} users.Token
+// @Router /services/{key}/tokens [post]
+func PostNewServiceAccountToken(ctx *gin.Context) {
+	if findTokenOwner(ctx) {
+		users.IssueToken(ctx, CacheTokens, ctx.Param("key"), pkgName)
+	}
+	return
+}
+
+// PutReplicatedServiceAccountToken stores the service account's token issued by a peer instance, see config.MirrorAs.
+// @Summary Store service account's replicated token
+// @Description store the token issued by a peer instance (replicated requests only)
+// @Tags services
+// @Produce json
+// @Param  key  path  string  true  "service account key"
+// @Param  id  path  string  true  "token ID"
+// @Param request body users.Token true "token with its hash"
+// @Success 200 {object} users.Token
+// @Router /services/{key}/tokens/{id} [put]
+func PutReplicatedServiceAccountToken(ctx *gin.Context) {
+	if findTokenOwner(ctx) {
+		users.StoreReplicatedToken(ctx, CacheTokens, ctx.Param("key"), pkgName)
+	}
+	return
+}
+
+// RevokeServiceAccountTokenByID revokes the service account's token, it is kept for the record.
+// @Summary Revoke service account's token
+// @Description revoke service account's token by its ID
+// @Tags services
+// @Produce json
+// @Param  key  path  string  true  "service account key"
+// @Param  id  path  string  true  "token ID"
+// @Success 200 {object} users.Token
+// @Router /services/{key}/tokens/{id} [delete]
+func RevokeServiceAccountTokenByID(ctx *gin.Context) {
+	users.RevokeToken(ctx, CacheTokens, ctx.Param("key"), pkgName)
+	return
+}
+
+// findTokenOwner checks the service account of the key param exists, it responds with 404 otherwise.
+func findTokenOwner(ctx *gin.Context) bool {
+	key := ctx.Param("key")
+
+	_, ok := Cache.Get(key)
+	if !ok {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"key":     key,
+			"message": "service account not found",
+			"package": pkgName,
+		})
+	}
+
+	return ok
+}
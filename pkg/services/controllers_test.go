@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var TestPackage *core.Package = &core.Package{
+	Name: pkgName,
+	Cache: []core.CacheInterface{
+		Cache,
+		CacheTokens,
+	},
+	Routes:  Routes,
+	Indexes: indexes,
+}
+
+/*
+ *  unit/integration tests
+ */
+
+func TestPostNewServiceAccount(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	var account ServiceAccount = ServiceAccount{
+		ID:        "dish-agent",
+		Name:      "dish agent",
+		Active:    true,
+		RateLimit: 60,
+		Scopes: []Scope{
+			{Method: "POST", Path: "/dish/sockets/results"},
+		},
+	}
+
+	jsonValue, _ := json.Marshal(account)
+	req, _ := http.NewRequest("POST", "/services", bytes.NewBuffer(jsonValue))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// scopes are required
+	account.ID, account.Scopes = "no-scopes", nil
+
+	jsonValue, _ = json.Marshal(account)
+	req, _ = http.NewRequest("POST", "/services", bytes.NewBuffer(jsonValue))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetServiceAccounts(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	req, _ := http.NewRequest("GET", "/services", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var items = struct {
+		Accounts map[string]ServiceAccount `json:"items"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &items)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, items.Accounts)
+}
+
+func TestServiceAccountTokens(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	req, _ := http.NewRequest("POST", "/services/dish-agent/tokens", bytes.NewBufferString(`{"name": "dish01"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var created = struct {
+		Token string `json:"token"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	if account := FindServiceAccountByToken(created.Token); assert.NotNil(t, account) {
+		assert.Equal(t, "dish-agent", account.ID)
+	}
+
+	req, _ = http.NewRequest("POST", "/services/unknown/tokens", bytes.NewBufferString(`{"name": "dish01"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServiceAccountScopes(t *testing.T) {
+	account := ServiceAccount{
+		Scopes: []Scope{
+			{Method: "POST", Path: "/infra/hosts/:key/facts", Params: map[string]string{"key": "myhost"}},
+			{Method: "*", Path: "/dish/sockets/results"},
+		},
+	}
+
+	params := func(key string) func(string) string {
+		return func(name string) string {
+			if name == "key" {
+				return key
+			}
+			return ""
+		}
+	}
+
+	assert.True(t, account.Allows("POST", "/infra/hosts/:key/facts", params("myhost")))
+	assert.False(t, account.Allows("POST", "/infra/hosts/:key/facts", params("otherhost")))
+	assert.False(t, account.Allows("GET", "/infra/hosts/:key/facts", params("myhost")))
+	assert.True(t, account.Allows("PUT", "/dish/sockets/results", params("")))
+	assert.False(t, account.Allows("GET", "/dish/sockets", params("")))
+}
@@ -0,0 +1,34 @@
+package services
+
+// ServiceAccount is a machine client (e.g. a dish instance or a backup script) allowed to call such routes only.
+type ServiceAccount struct {
+	// Service account's unique identifier.
+	ID string `json:"id" binding:"required" required:"true" readonly:"true"`
+
+	// Service account's more verbose name.
+	Name string `json:"name" binding:"required" required:"true"`
+
+	// Description of the client using the account.
+	Description string `json:"description"`
+
+	// Inactive accounts' tokens are rejected.
+	Active bool `json:"active" default:"false"`
+
+	// Scopes are the routes the account is allowed to call.
+	Scopes []Scope `json:"scopes" binding:"required,dive" required:"true"`
+
+	// RateLimit is the count of requests allowed per minute, zero means no limit.
+	RateLimit int `json:"rate_limit" binding:"min=0" default:"0"`
+}
+
+// Scope is a single route allowed to the service account.
+type Scope struct {
+	// HTTP method (e.g. POST), * stands for any method.
+	Method string `json:"method" binding:"required" required:"true"`
+
+	// Route as registered (e.g. /infra/hosts/:key/facts).
+	Path string `json:"path" binding:"required" required:"true"`
+
+	// Params pin the route params to such values (e.g. the account's own host {"key": "myhost"}).
+	Params map[string]string `json:"params"`
+}
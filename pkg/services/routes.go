@@ -0,0 +1,34 @@
+package services
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// services CRUD -- functions in controllers.go
+func Routes(g *gin.RouterGroup) {
+	g.GET("",
+		GetServiceAccounts)
+	g.POST("",
+		PostNewServiceAccount)
+	g.GET("/:key",
+		GetServiceAccountByKey)
+	g.PUT("/:key",
+		UpdateServiceAccountByKey)
+	g.PATCH("/:key",
+		PatchServiceAccountByKey)
+	g.DELETE("/:key",
+		DeleteServiceAccountByKey)
+	g.POST("/restore",
+		PostDumpRestore)
+	g.GET("/types",
+		ListTypes)
+
+	g.GET("/:key/tokens",
+		GetServiceAccountTokens)
+	g.POST("/:key/tokens",
+		PostNewServiceAccountToken)
+	g.PUT("/:key/tokens/:id",
+		PutReplicatedServiceAccountToken)
+	g.DELETE("/:key/tokens/:id",
+		RevokeServiceAccountTokenByID)
+}
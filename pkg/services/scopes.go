@@ -0,0 +1,54 @@
+package services
+
+import (
+	"strings"
+
+	"go.vxn.dev/swis/v5/pkg/users"
+)
+
+// ContextNamePrefix prefixes the service accounts' keys in the request context's user name (e.g. in the audit log),
+// so that they cannot be mistaken for the users.
+const ContextNamePrefix = "service:"
+
+// FindServiceAccountByToken returns the active service account owning such token string (<id>.<secret>), or nil.
+func FindServiceAccountByToken(token string) *ServiceAccount {
+	tok, ok := users.MatchToken(CacheTokens, token)
+	if !ok {
+		return nil
+	}
+
+	account, ok := Cache.Get(tok.User)
+	if !ok || !account.Active {
+		return nil
+	}
+
+	return &account
+}
+
+// Allows reports whether any of the account's scopes covers the request of such method to the route (e.g.
+// /infra/hosts/:key/facts), param returns the request's route params.
+func (a ServiceAccount) Allows(method, route string, param func(name string) string) bool {
+	for _, scope := range a.Scopes {
+		if scope.Method != "*" && !strings.EqualFold(scope.Method, method) {
+			continue
+		}
+
+		if strings.TrimSuffix(scope.Path, "/") != strings.TrimSuffix(route, "/") {
+			continue
+		}
+
+		pinned := true
+		for name, value := range scope.Params {
+			if param(name) != value {
+				pinned = false
+				break
+			}
+		}
+
+		if pinned {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,25 +1,31 @@
 package system
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
-	//"strconv"
+	"strconv"
+	"time"
 	//"time"
 
+	"go.vxn.dev/swis/v5/pkg/auth"
+	"go.vxn.dev/swis/v5/pkg/config"
 	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/roles"
 
 	"github.com/gin-gonic/gin"
 )
 
 var (
-	Cache   *core.Cache
+	Cache          = &core.Cache[[]string]{Volatile: true}
 	pkgName string = "system"
 )
 
 var Package *core.Package = &core.Package{
 	Name: pkgName,
-	Cache: []**core.Cache{
-		&Cache,
+	Cache: []core.CacheInterface{
+		Cache,
 	},
 	Routes:  Routes,
 	Generic: false,
@@ -48,3 +54,305 @@ func GetGenericMountedPackages(ctx *gin.Context) {
 	})
 	return
 }
+
+func GetWALSegments(ctx *gin.Context) {
+	segments, err := core.ListWALSegments()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusServiceUnavailable, gin.H{
+			"code":    http.StatusServiceUnavailable,
+			"error":   err.Error(),
+			"message": "cannot list write-ahead log segments",
+			"package": pkgName,
+		})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"count":   len(segments),
+		"items":   segments,
+		"message": "ok, listing write-ahead log segments",
+		"package": pkgName,
+	})
+	return
+}
+
+// ExportArchive streams a versioned archive of all mounted packages' data.
+func ExportArchive(ctx *gin.Context) {
+	// The archive holds the items of all the owners.
+	if _, scoped := core.OwnerScope(ctx); scoped {
+		core.PrintOwnerScopeError(ctx, pkgName, "")
+		return
+	}
+
+	fileName := fmt.Sprintf("swis-export-%s.json", time.Now().Format("20060102-150405"))
+
+	// The changes made while the archive is written are in the feed after this offset.
+	ctx.Header("X-Feed-Offset", strconv.FormatUint(core.FeedOffset(), 10))
+
+	ctx.Header("Content-Type", "application/json")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	ctx.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure can be only logged (and the archive is left truncated).
+	if err := core.WriteArchive(ctx.Writer); err != nil {
+		log.Printf("system: export failed: %s", err.Error())
+	}
+	return
+}
+
+// ImportArchive restores all packages' data from an archive produced by ExportArchive.
+func ImportArchive(ctx *gin.Context) {
+	var archive core.Archive
+
+	if _, scoped := core.OwnerScope(ctx); scoped {
+		core.PrintOwnerScopeError(ctx, pkgName, "")
+		return
+	}
+
+	if err := ctx.BindJSON(&archive); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   err.Error(),
+			"message": "cannot bind input JSON stream",
+			"package": pkgName,
+		})
+		return
+	}
+
+	reports, ok := core.ImportArchive(ctx, &archive)
+	if !ok {
+		ctx.IndentedJSON(http.StatusUnprocessableEntity, gin.H{
+			"code":    http.StatusUnprocessableEntity,
+			"items":   reports,
+			"message": "archive import failed",
+			"package": pkgName,
+		})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, gin.H{
+		"code":    http.StatusCreated,
+		"items":   reports,
+		"message": "archive imported successfully",
+		"package": pkgName,
+	})
+	return
+}
+
+// RevealSecrets prints the clear values of the item's secret fields. It is a POST, so that it takes the write
+// permission and it is recorded in the audit log. The requester has to be an administrator, or be allowed to read
+// the item.
+func RevealSecrets(ctx *gin.Context) {
+	var input struct {
+		Cache string `json:"cache" binding:"required"`
+		Key   string `json:"key" binding:"required"`
+	}
+
+	// The secrets are never revealed to the requests limited to their own items.
+	if _, scoped := core.OwnerScope(ctx); scoped {
+		core.PrintOwnerScopeError(ctx, pkgName, "")
+		return
+	}
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   err.Error(),
+			"message": "cannot bind input JSON stream",
+			"package": pkgName,
+		})
+		return
+	}
+
+	user, _ := ctx.Value(core.ContextUserName).(string)
+
+	if !canReveal(user, input.Cache, input.Key) {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{
+			"code":    http.StatusForbidden,
+			"key":     input.Key,
+			"message": "not allowed to reveal the item's secrets",
+			"package": pkgName,
+		})
+		return
+	}
+
+	secrets, err := core.RevealSecrets(input.Cache, input.Key)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"error":   err.Error(),
+			"key":     input.Key,
+			"message": "no such item to reveal",
+			"package": pkgName,
+		})
+		return
+	}
+
+	log.Printf("system: secrets of '%s' in '%s' revealed to '%s'", input.Key, input.Cache, user)
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"cache":   input.Cache,
+		"code":    http.StatusOK,
+		"count":   len(secrets),
+		"items":   secrets,
+		"key":     input.Key,
+		"message": "ok, revealing secrets",
+		"package": pkgName,
+	})
+	return
+}
+
+// GetReplicationStatus lists the replication peers with their queues, lag and failures.
+func GetReplicationStatus(ctx *gin.Context) {
+	instance, peers, ok := config.ReplicationStatus()
+	if !ok {
+		ctx.IndentedJSON(http.StatusOK, gin.H{
+			"code":    http.StatusOK,
+			"count":   0,
+			"items":   []config.PeerStatus{},
+			"message": "replication not configured, no MIRROR_PEERS set",
+			"package": pkgName,
+		})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":     http.StatusOK,
+		"count":    len(peers),
+		"instance": instance,
+		"items":    peers,
+		"message":  "ok, listing replication peers",
+		"package":  pkgName,
+	})
+	return
+}
+
+// GetConfig prints the applied configuration with the secret values redacted, the file it was read from and the
+// time it was loaded at (on start or on the last SIGHUP). The settings applied on start only are printed as started,
+// the changed ones are listed as pending the restart.
+func GetConfig(ctx *gin.Context) {
+	cfg, pending := config.Current().Applied()
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":            http.StatusOK,
+		"file":            cfg.File(),
+		"item":            cfg.Redacted(),
+		"loaded_at":       cfg.LoadedAt(),
+		"message":         "ok, printing the current configuration",
+		"package":         pkgName,
+		"pending_restart": pending,
+	})
+	return
+}
+
+// GetChanges lists the changes following the after offset, waiting up to the wait duration (e.g. 30s) for a new one.
+// The offset no longer held by the feed is answered with 410 Gone, the reader has to start over from an export.
+func GetChanges(ctx *gin.Context) {
+	var (
+		after uint64
+		limit = 1000
+		wait  time.Duration
+		err   error
+	)
+
+	// The feed holds the items of all the owners.
+	if _, scoped := core.OwnerScope(ctx); scoped {
+		core.PrintOwnerScopeError(ctx, pkgName, "")
+		return
+	}
+
+	if value := ctx.Query("after"); value != "" {
+		after, err = strconv.ParseUint(value, 10, 64)
+	}
+
+	if value := ctx.Query("limit"); value != "" && err == nil {
+		limit, err = strconv.Atoi(value)
+		if err == nil && limit <= 0 {
+			err = fmt.Errorf("limit has to be positive")
+		}
+	}
+
+	if value := ctx.Query("wait"); value != "" && err == nil {
+		wait, err = time.ParseDuration(value)
+		wait = min(wait, time.Minute)
+	}
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   err.Error(),
+			"message": "invalid query",
+			"package": pkgName,
+		})
+		return
+	}
+
+	if wait > 0 {
+		wctx, cancel := context.WithTimeout(ctx.Request.Context(), wait)
+		core.WaitFeed(wctx, after)
+		cancel()
+	}
+
+	events, err := core.FeedSince(after, limit)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusGone, gin.H{
+			"code":    http.StatusGone,
+			"error":   err.Error(),
+			"message": "changes no longer available, start over from an export",
+			"package": pkgName,
+		})
+		return
+	}
+
+	next := after
+	if len(events) > 0 {
+		next = events[len(events)-1].Offset
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"count":   len(events),
+		"items":   events,
+		"message": "ok, listing changes",
+		"next":    next,
+		"package": pkgName,
+	})
+	return
+}
+
+// GetOpenAPIDocument serves the OpenAPI 3 document generated from the mounted packages and their routes.
+func GetOpenAPIDocument(ctx *gin.Context) {
+	ctx.IndentedJSON(http.StatusOK, core.OpenAPI())
+	return
+}
+
+// GetModelSchemas lists the JSON schemas of the mounted packages' models by their cache names.
+func GetModelSchemas(ctx *gin.Context) {
+	schemas := core.JSONSchemas()
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"count":   len(schemas),
+		"items":   schemas,
+		"message": "ok, listing JSON schemas of the mounted packages' models",
+		"package": pkgName,
+	})
+	return
+}
+
+// canReveal reports whether the user may read the item's secrets: the administrators may, the others need to be
+// allowed to read the whole cache's item (not just their own ones).
+func canReveal(user, cacheName, key string) bool {
+	params, ok := auth.ParamsFor(user)
+	if !ok {
+		return false
+	}
+
+	if roles.IsAdmin(params.Roles) {
+		return true
+	}
+
+	allowed, own := params.CanReadItem(cacheName, key)
+	return allowed && !own
+}
@@ -0,0 +1,133 @@
+package system
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/users"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevealSecrets(t *testing.T) {
+	core.SetupTestEnv(users.Package)
+	core.SetupTestEnv(thingsPackage)
+
+	r := core.SetupTestEnv(Package)
+
+	things.Set("a", thing{Name: "a"})
+
+	for _, user := range []users.User{
+		{ID: "alice", Name: "alice", Active: true, Roles: []string{"admin"}},
+		{ID: "bob", Name: "bob", Active: true, ACL: []string{"things"}},
+		{ID: "carol", Name: "carol", Active: true, ACL: []string{"things:own"}},
+		{ID: "dave", Name: "dave", Active: true, ACL: []string{"users"}},
+	} {
+		users.Cache.Set(user.Name, user)
+	}
+
+	for _, tc := range []struct {
+		user    string
+		allowed bool
+	}{
+		{"root", true},
+		{"alice", true},
+		{"bob", true},
+		{"carol", false},
+		{"dave", false},
+		{"unknown", false},
+	} {
+		assert.Equal(t, tc.allowed, canReveal(tc.user, "things/parts", "a"), tc.user)
+	}
+
+	// the requests of no known user are refused
+	req, _ := http.NewRequest("POST", "/system/secrets/reveal", bytes.NewBufferString(`{"cache": "things/parts", "key": "a"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestExportImportArchive(t *testing.T) {
+	core.SetupTestEnv(users.Package)
+	core.SetupTestEnv(thingsPackage)
+
+	r := core.SetupTestEnv(Package)
+
+	// the users set by other tests have no e-mail, so they would not be valid in the archive
+	all, _ := users.Cache.GetAll()
+	for key := range all {
+		users.Cache.Delete(key)
+	}
+
+	things.Set("a", thing{Name: "a"})
+	things.Set("b", thing{Name: "b"})
+	users.Cache.Set("alice", users.User{ID: "alice", Name: "alice", EmailMain: "alice@example.com", Active: true})
+
+	req, _ := http.NewRequest("GET", "/system/export", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var archive core.Archive
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &archive))
+	assert.Equal(t, core.ArchiveVersion, archive.Version)
+	assert.Len(t, archive.Caches["things/parts"], 2)
+
+	// the round trip replaces the changes made since the export
+	exported := w.Body.Bytes()
+
+	things.Delete("b")
+	things.Set("c", thing{Name: "c"})
+
+	req, _ = http.NewRequest("POST", "/system/import", bytes.NewBuffer(exported))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	items, count := things.GetAll()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, thing{Name: "b"}, items["b"])
+
+	// an archive of an unsupported version is refused
+	body, _ := json.Marshal(core.Archive{Version: core.ArchiveVersion + 1, Caches: map[string]map[string]json.RawMessage{
+		"things/parts": {"d": json.RawMessage(`{"name": "d"}`)},
+	}})
+
+	req, _ = http.NewRequest("POST", "/system/import", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	_, count = things.GetAll()
+	assert.Equal(t, 2, count)
+
+	// an invalid item (the user has no name) leaves every cache unchanged
+	body, _ = json.Marshal(core.Archive{Version: core.ArchiveVersion, Caches: map[string]map[string]json.RawMessage{
+		"things/parts": {"d": json.RawMessage(`{"name": "d"}`)},
+		"users":        {"eve": json.RawMessage(`{"id": "eve", "email_main": "eve@example.com"}`)},
+	}})
+
+	req, _ = http.NewRequest("POST", "/system/import", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	items, count = things.GetAll()
+	assert.Equal(t, 2, count)
+	assert.NotContains(t, items, "d")
+
+	_, ok := users.Cache.Get("alice")
+	assert.True(t, ok)
+
+	_, ok = users.Cache.Get("eve")
+	assert.False(t, ok)
+}
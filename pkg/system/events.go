@@ -0,0 +1,269 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/auth"
+	"go.vxn.dev/swis/v5/pkg/config"
+	"go.vxn.dev/swis/v5/pkg/core"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// heartbeat is the idle period after which a comment is sent to the SSE stream, so that the proxies keep it open.
+var heartbeat = 15 * time.Second
+
+// eventFilter selects the change feed events by the comma-separated query params, a blank param matches all.
+type eventFilter struct {
+	// user is the requester, only the events of the items the user may read are served, as the user reads them.
+	user string
+
+	packages map[string]bool
+	caches   map[string]bool
+	keys     map[string]bool
+	ops      map[string]bool
+}
+
+func newEventFilter(ctx *gin.Context) eventFilter {
+	set := func(param string) map[string]bool {
+		var values map[string]bool
+
+		for _, value := range strings.Split(ctx.Query(param), ",") {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			if values == nil {
+				values = make(map[string]bool)
+			}
+			values[value] = true
+		}
+
+		return values
+	}
+
+	user, _ := ctx.Value(core.ContextUserName).(string)
+
+	return eventFilter{
+		user:     user,
+		packages: set("package"),
+		caches:   set("cache"),
+		keys:     set("key"),
+		ops:      set("op"),
+	}
+}
+
+func (f eventFilter) match(ev core.FeedEvent) bool {
+	return (f.packages == nil || f.packages[ev.Package]) &&
+		(f.caches == nil || f.caches[ev.Cache]) &&
+		(f.keys == nil || f.keys[ev.Key]) &&
+		(f.ops == nil || f.ops[ev.Op])
+}
+
+// streamEvents sends the matching events following the offset until the context is done or the sending fails. The
+// idle func (optional) is called when there is no change for the heartbeat period.
+func streamEvents(ctx context.Context, after uint64, filter eventFilter, send func(core.FeedEvent) error, idle func() error) error {
+	for {
+		events, err := core.FeedSince(after, 1000)
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range events {
+			after = ev.Offset
+
+			if !filter.match(ev) {
+				continue
+			}
+
+			ev, ok := auth.FeedEventFor(filter.user, ev)
+			if !ok {
+				continue
+			}
+
+			if err := send(ev); err != nil {
+				return err
+			}
+		}
+
+		if len(events) > 0 {
+			continue
+		}
+
+		wait := ctx
+		cancel := func() {}
+		if idle != nil {
+			wait, cancel = context.WithTimeout(ctx, heartbeat)
+		}
+
+		changed := core.WaitFeed(wait, after)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case !changed:
+			if err := idle(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GetEvents streams the changes of the persistent caches' items as they are made: over WebSocket if requested,
+// otherwise as server-sent events. The stream starts with the changes following the after param (or the SSE
+// Last-Event-ID header), or with the new changes if not set. The events can be filtered by the package, cache, key
+// and op params (comma-separated). Only the changes of the items the requester may read are streamed.
+func GetEvents(ctx *gin.Context) {
+	// The feed holds the items of all the owners.
+	if _, scoped := core.OwnerScope(ctx); scoped {
+		core.PrintOwnerScopeError(ctx, pkgName, "")
+		return
+	}
+
+	after := core.FeedOffset()
+
+	value := ctx.Query("after")
+	if value == "" {
+		value = ctx.GetHeader("Last-Event-ID")
+	}
+
+	if value != "" {
+		var err error
+
+		after, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"code":    http.StatusBadRequest,
+				"error":   err.Error(),
+				"message": "invalid query",
+				"package": pkgName,
+			})
+			return
+		}
+	}
+
+	if _, err := core.FeedSince(after, 0); err != nil {
+		ctx.IndentedJSON(http.StatusGone, gin.H{
+			"code":    http.StatusGone,
+			"error":   err.Error(),
+			"message": "changes no longer available, start over from an export",
+			"package": pkgName,
+		})
+		return
+	}
+
+	filter := newEventFilter(ctx)
+
+	if ctx.IsWebsocket() {
+		streamWebSocket(ctx, after, filter)
+		return
+	}
+
+	streamSSE(ctx, after, filter)
+	return
+}
+
+// errForbiddenOrigin refuses the WebSocket handshakes of the origins not allowed.
+var errForbiddenOrigin = errors.New("origin not allowed")
+
+// sameOrigin reports whether the origin is the requested host itself.
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == host
+}
+
+// goneMessage tells the stream's reader it fell behind the feed.
+var goneMessage = gin.H{
+	"code":    http.StatusGone,
+	"error":   core.ErrFeedGone.Error(),
+	"message": "changes no longer available, start over from an export",
+	"package": pkgName,
+}
+
+func streamSSE(ctx *gin.Context, after uint64, filter eventFilter) {
+	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+	ctx.Writer.Header().Set("Cache-Control", "no-cache")
+	ctx.Writer.Header().Set("Connection", "keep-alive")
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Flush()
+
+	write := func(format string, args ...any) error {
+		if _, err := fmt.Fprintf(ctx.Writer, format, args...); err != nil {
+			return err
+		}
+
+		ctx.Writer.Flush()
+		return nil
+	}
+
+	send := func(ev core.FeedEvent) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+
+		// The offset is the event's ID, so that the reconnecting clients resume by Last-Event-ID.
+		return write("id: %d\nevent: change\ndata: %s\n\n", ev.Offset, data)
+	}
+
+	idle := func() error {
+		return write(": heartbeat\n\n")
+	}
+
+	err := streamEvents(ctx.Request.Context(), after, filter, send, idle)
+	if errors.Is(err, core.ErrFeedGone) {
+		data, _ := json.Marshal(goneMessage)
+		write("event: gone\ndata: %s\n\n", data)
+	}
+}
+
+func streamWebSocket(ctx *gin.Context, after uint64, filter eventFilter) {
+	server := websocket.Server{
+		// The browsers connect from the same origin or the CORS origins only, the other clients send no origin.
+		Handshake: func(_ *websocket.Config, req *http.Request) error {
+			origin := req.Header.Get("Origin")
+			if origin == "" || config.AllowedOrigin(origin) || sameOrigin(origin, req.Host) {
+				return nil
+			}
+
+			return errForbiddenOrigin
+		},
+
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			// The hijacked connection keeps the server's read deadline otherwise.
+			ws.SetReadDeadline(time.Time{})
+
+			wctx, cancel := context.WithCancel(ctx.Request.Context())
+			defer cancel()
+
+			// The client sends nothing, the read ends when it goes away.
+			go func() {
+				io.Copy(io.Discard, ws)
+				cancel()
+			}()
+
+			send := func(ev core.FeedEvent) error {
+				return websocket.JSON.Send(ws, ev)
+			}
+
+			err := streamEvents(wctx, after, filter, send, nil)
+			if errors.Is(err, core.ErrFeedGone) {
+				websocket.JSON.Send(ws, goneMessage)
+			}
+		},
+	}
+
+	server.ServeHTTP(ctx.Writer, ctx.Request)
+}
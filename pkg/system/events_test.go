@@ -0,0 +1,150 @@
+package system
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/users"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+type thing struct {
+	Name string `json:"name"`
+}
+
+var things = &core.Cache[thing]{}
+
+var thingsPackage *core.Package = &core.Package{
+	Name: "things",
+	Cache: []core.CacheInterface{
+		things,
+	},
+	CacheNames: []string{"parts"},
+}
+
+// setupEventsRouter serves the package's routes to the root user, as the auth middleware would.
+func setupEventsRouter() *gin.Engine {
+	core.SetupTestEnv(Package)
+
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set(core.ContextUserName, "root")
+	})
+	Routes(router.Group("/system"))
+
+	return router
+}
+
+func TestGetEvents(t *testing.T) {
+	core.SetupTestEnv(thingsPackage)
+
+	t.Setenv("CORS_ORIGINS", "http://localhost")
+
+	server := httptest.NewServer(setupEventsRouter())
+	defer server.Close()
+
+	start := core.FeedOffset()
+
+	things.Set("a", thing{Name: "a"})
+	things.Set("b", thing{Name: "b"})
+
+	// resumed SSE stream, filtered by the key
+	resp, err := http.Get(server.URL + "/system/events?package=things&key=b&after=" + strconv.FormatUint(start, 10))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// the live changes follow
+	things.Delete("a")
+	things.Delete("b")
+
+	var ops []string
+
+	scanner := bufio.NewScanner(resp.Body)
+	for len(ops) < 2 && scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var ev core.FeedEvent
+		assert.Nil(t, json.Unmarshal([]byte(data), &ev))
+		assert.Equal(t, "b", ev.Key)
+		assert.Equal(t, "things/parts", ev.Cache)
+		assert.Equal(t, "parts", ev.Subpackage)
+
+		ops = append(ops, ev.Op)
+	}
+
+	assert.Equal(t, []string{"set", "delete"}, ops)
+
+	// WebSocket stream of the new changes, from the allowed origins only
+	_, err = websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/system/events?op=set", "", "http://evil.example")
+	assert.NotNil(t, err)
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/system/events?op=set", "", "http://localhost")
+	assert.Nil(t, err)
+	defer ws.Close()
+
+	things.Delete("c")
+	things.Set("c", thing{Name: "c"})
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var ev core.FeedEvent
+	assert.Nil(t, websocket.JSON.Receive(ws, &ev))
+	assert.Equal(t, "c", ev.Key)
+	assert.Equal(t, "set", ev.Op)
+	assert.Equal(t, `{"name":"c"}`, string(ev.Value))
+
+	// offsets preceding the feed
+	resp, err = http.Get(server.URL + "/system/events?after=1")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+}
+
+func TestStreamEventsAccess(t *testing.T) {
+	core.SetupTestEnv(users.Package)
+	core.SetupTestEnv(thingsPackage)
+
+	users.Cache.Set("bob", users.User{ID: "bob", Name: "bob", Active: true, ACL: []string{"things"}})
+	users.Cache.Set("carol", users.User{ID: "carol", Name: "carol", Active: true, ACL: []string{"users"}})
+
+	start := core.FeedOffset()
+	things.Set("d", thing{Name: "d"})
+
+	for _, tc := range []struct {
+		user string
+		keys []string
+	}{
+		{"root", []string{"d"}},
+		{"bob", []string{"d"}},
+		{"carol", nil},
+		{"", nil},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+		var keys []string
+		streamEvents(ctx, start, eventFilter{user: tc.user, packages: map[string]bool{"things": true}}, func(ev core.FeedEvent) error {
+			keys = append(keys, ev.Key)
+			return nil
+		}, nil)
+		cancel()
+
+		assert.Equal(t, tc.keys, keys, tc.user)
+	}
+}
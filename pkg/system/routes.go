@@ -1,6 +1,9 @@
 package system
 
 import (
+	"go.vxn.dev/swis/v5/pkg/audit"
+	"go.vxn.dev/swis/v5/pkg/follower"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -10,4 +13,32 @@ func Routes(g *gin.RouterGroup) {
 		GetAllMountedPackages)
 	g.GET("/packages/generic",
 		GetGenericMountedPackages)
+	g.GET("/wal",
+		GetWALSegments)
+	g.GET("/export",
+		ExportArchive)
+	g.POST("/import",
+		ImportArchive)
+	g.GET("/openapi.json",
+		GetOpenAPIDocument)
+	g.GET("/schemas",
+		GetModelSchemas)
+	g.GET("/audit",
+		audit.GetRecords)
+	g.GET("/audit/export",
+		audit.ExportRecords)
+	g.POST("/secrets/reveal",
+		RevealSecrets)
+	g.GET("/config",
+		GetConfig)
+	g.GET("/replication",
+		GetReplicationStatus)
+	g.GET("/changes",
+		GetChanges)
+	g.GET("/events",
+		GetEvents)
+	g.GET("/follower",
+		follower.GetStatus)
+	g.POST("/follower/promote",
+		follower.PostPromote)
 }
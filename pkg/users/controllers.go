@@ -1,6 +1,7 @@
 package users
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -10,44 +11,37 @@ import (
 )
 
 var (
-	Cache *core.Cache
+	Cache       = &core.Cache[User]{}
+	CacheTokens = &core.Cache[Token]{}
 
-	caches = []**core.Cache{
-		&Cache,
+	caches = []core.CacheInterface{
+		Cache,
+		CacheTokens,
+	}
+	indexes = map[core.CacheInterface][]string{
+		Cache:       {"name", "email_main", "token_hmac"},
+		CacheTokens: {"user_name"},
 	}
 	pkgName string = "users"
 )
 
 var Package *core.Package = &core.Package{
-	Name:    pkgName,
-	Cache:   caches,
+	Name:  pkgName,
+	Cache: caches,
+	CacheNames: []string{
+		"",
+		"tokens",
+	},
 	Routes:  Routes,
 	Generic: true,
+	Indexes: indexes,
 }
 
 var restorePackage = &core.RestorePackage{
-	Name:             pkgName,
-	Cache:            caches,
-	CacheNames:       []string{"Cache"},
-	Subpackages:      []string{},
-	SubpackageModels: map[string]any{},
-}
-
-func FindUserByToken(token string) *User {
-	rawUsers, _ := Cache.GetAll()
-
-	for _, rawUser := range rawUsers {
-		user, ok := rawUser.(User)
-		if !ok {
-			return nil
-		}
-
-		if user.TokenHash == token && user.Active {
-			return &user
-		}
-	}
-
-	return nil
+	Name:        pkgName,
+	Cache:       caches,
+	CacheNames:  []string{"Cache"},
+	Subpackages: []string{},
 }
 
 // GetUsers returns JSON serialized list of users and their properties.
@@ -100,6 +94,18 @@ func UpdateUserByKey(ctx *gin.Context) {
 	return
 }
 
+// @Summary Patch user by Key
+// @Description patch user by Key (JSON merge patch)
+// @Tags users
+// @Produce json
+// @Param request body users.User true "merge patch of the item"
+// @Success 200 {object} users.User
+// @Router /users/{key} [patch]
+func PatchUserByKey(ctx *gin.Context) {
+	core.PatchItemByParam[User](ctx, Cache, pkgName, User{})
+	return
+}
+
 // @Summary Delete user by Key
 // @Description delete user by Key
 // @Tags users
@@ -144,10 +150,9 @@ func ListTypes(ctx *gin.Context) {
 // @Success 200 {object} users.User
 // @Router /users/{key}/active [put]
 func ActiveToggleUserByKey(c *gin.Context) {
-	var user User
 	var userName string = c.Param("key")
 
-	rawUser, ok := Cache.Get(userName)
+	user, ok := Cache.Get(userName)
 	if !ok {
 		c.IndentedJSON(http.StatusNotFound, gin.H{
 			"message": "user not found",
@@ -157,19 +162,10 @@ func ActiveToggleUserByKey(c *gin.Context) {
 		return
 	}
 
-	user, ok = rawUser.(User)
-	if !ok {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"message": "cannot assert data type, database internal error",
-			"code":    http.StatusInternalServerError,
-		})
-		return
-	}
-
 	// inverse the Active field value
 	user.Active = !user.Active
 
-	if saved := Cache.Set(userName, user); !saved {
+	if saved := Cache.SetContext(c, userName, user); !saved {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "user couldn't be saved to database",
@@ -180,7 +176,7 @@ func ActiveToggleUserByKey(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
 		"message": "user active toggle pressed!",
-		"user":    user,
+		"user":    Cache.View(c, user),
 	})
 	return
 }
@@ -194,10 +190,9 @@ func ActiveToggleUserByKey(c *gin.Context) {
 // @Success 200 {object} users.User
 // @Router /users/{key}/keys/ssh [post]
 func PostUsersSSHKeys(c *gin.Context) {
-	var user User
 	var userName string = c.Param("key")
 
-	rawUser, ok := Cache.Get(userName)
+	user, ok := Cache.Get(userName)
 	if !ok {
 		c.IndentedJSON(http.StatusNotFound, gin.H{
 			"message": "user not found",
@@ -207,15 +202,6 @@ func PostUsersSSHKeys(c *gin.Context) {
 		return
 	}
 
-	user, ok = rawUser.(User)
-	if !ok {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"message": "cannot assert data type, database internal error",
-			"code":    http.StatusInternalServerError,
-		})
-		return
-	}
-
 	// to be reimplemented later
 	var sshKeys struct {
 		Keys []string `json:"keys"`
@@ -232,7 +218,7 @@ func PostUsersSSHKeys(c *gin.Context) {
 
 	user.SSHKeys = sshKeys.Keys
 
-	if saved := Cache.Set(userName, user); !saved {
+	if saved := Cache.SetContext(c, userName, user); !saved {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"message": "user couldn't be saved to database",
@@ -244,7 +230,7 @@ func PostUsersSSHKeys(c *gin.Context) {
 		"code":    http.StatusAccepted,
 		"message": "ssh keys for user (re)imported",
 		"name":    userName,
-		"user":    user,
+		"user":    Cache.View(c, user),
 	})
 	return
 }
@@ -257,10 +243,9 @@ func PostUsersSSHKeys(c *gin.Context) {
 // @Success 200 {object} users.User
 // @Router /users/{key}/keys/ssh [get]
 func GetUsersSSHKeysRaw(c *gin.Context) {
-	var user User
 	var userName string = c.Param("key")
 
-	rawUser, ok := Cache.Get(userName)
+	user, ok := Cache.Get(userName)
 	if !ok {
 		c.IndentedJSON(http.StatusNotFound, gin.H{
 			"message": "user not found",
@@ -270,18 +255,128 @@ func GetUsersSSHKeysRaw(c *gin.Context) {
 		return
 	}
 
-	user, ok = rawUser.(User)
-	if !ok {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"message": "cannot assert data type, database internal error",
+	// return SSH keys as plaintext
+	var responseBody = strings.Join(user.SSHKeys, "\n")
+	c.String(http.StatusOK, responseBody)
+
+	return
+}
+
+// GetUserTokens lists the user's API tokens without their secrets.
+// @Summary List user's API tokens
+// @Description list user's API tokens (hashes omitted)
+// @Tags users
+// @Produce json
+// @Param  key  path  string  true  "user key"
+// @Success 200 {object} []users.Token
+// @Router /users/{key}/tokens [get]
+func GetUserTokens(ctx *gin.Context) {
+	if findTokenOwner(ctx) {
+		PrintTokens(ctx, CacheTokens, ctx.Param("key"), pkgName)
+	}
+	return
+}
+
+// PostNewUserToken generates a new named API token for the user, the token string is returned only once.
+// @Summary Create user's API token
+// @Description create a named API token, the secret is shown only in this response
+// @Tags users
+// @Produce json
+// @Param  key  path  string  true  "user key"
+// @Param request body users.Token true "token name and optional expiry"
+// @Success 201 {object} users.Token
+// @Router /users/{key}/tokens [post]
+func PostNewUserToken(ctx *gin.Context) {
+	if findTokenOwner(ctx) {
+		IssueToken(ctx, CacheTokens, ctx.Param("key"), pkgName)
+	}
+	return
+}
+
+// PutReplicatedUserToken stores the user's token issued by a peer instance, see config.MirrorAs.
+// @Summary Store user's replicated API token
+// @Description store the token issued by a peer instance (replicated requests only)
+// @Tags users
+// @Produce json
+// @Param  key  path  string  true  "user key"
+// @Param  id  path  string  true  "token ID"
+// @Param request body users.Token true "token with its hash"
+// @Success 200 {object} users.Token
+// @Router /users/{key}/tokens/{id} [put]
+func PutReplicatedUserToken(ctx *gin.Context) {
+	if findTokenOwner(ctx) {
+		StoreReplicatedToken(ctx, CacheTokens, ctx.Param("key"), pkgName)
+	}
+	return
+}
+
+// RevokeUserTokenByID revokes the user's token, it is kept for the record. The legacy token is removed.
+// @Summary Revoke user's API token
+// @Description revoke user's API token by its ID, the 'legacy' ID removes the legacy token_hmac
+// @Tags users
+// @Produce json
+// @Param  key  path  string  true  "user key"
+// @Param  id  path  string  true  "token ID"
+// @Success 200 {object} users.Token
+// @Router /users/{key}/tokens/{id} [delete]
+func RevokeUserTokenByID(ctx *gin.Context) {
+	if ctx.Param("id") == LegacyTokenID {
+		revokeLegacyToken(ctx)
+		return
+	}
+
+	RevokeToken(ctx, CacheTokens, ctx.Param("key"), pkgName)
+	return
+}
+
+// revokeLegacyToken clears the user's legacy token.
+func revokeLegacyToken(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	user, _, err := Cache.Update(ctx, key, func(user User) User {
+		user.TokenHash = ""
+		return user
+	})
+	if errors.Is(err, core.ErrItemNotFound) {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"key":     key,
+			"message": "user not found",
+			"package": pkgName,
+		})
+		return
+	} else if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
+			"key":     key,
+			"message": "user couldn't be saved to database",
+			"package": pkgName,
 		})
 		return
 	}
 
-	// return SSH keys as plaintext
-	var responseBody = strings.Join(user.SSHKeys, "\n")
-	c.String(http.StatusOK, responseBody)
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"item":    Cache.View(ctx, user),
+		"key":     key,
+		"message": "legacy token removed",
+		"package": pkgName,
+	})
+}
 
-	return
+// findTokenOwner checks the user of the key param exists, it responds with 404 otherwise.
+func findTokenOwner(ctx *gin.Context) bool {
+	key := ctx.Param("key")
+
+	_, ok := Cache.Get(key)
+	if !ok {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"key":     key,
+			"message": "user not found",
+			"package": pkgName,
+		})
+	}
+
+	return ok
 }
@@ -2,22 +2,30 @@ package users
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"go.vxn.dev/swis/v5/pkg/config"
 	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/roles"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 var TestPackage *core.Package = &core.Package{
-	Name: pkgName,
-	Cache: []**core.Cache{
-		&Cache,
-	},
-	Routes: Routes,
+	Name:       pkgName,
+	Cache:      caches,
+	CacheNames: Package.CacheNames,
+	Routes:     Routes,
+	Indexes:    indexes,
 }
 
 /*
@@ -31,7 +39,8 @@ func TestPostNewUser(t *testing.T) {
 		ID:        "operator",
 		Name:      "operator",
 		FullName:  "Mr. Operator",
-		TokenHash: "",
+		EmailMain: "operator@example.com",
+		TokenHash: "0x33",
 	}
 
 	jsonValue, _ := json.Marshal(user)
@@ -41,6 +50,12 @@ func TestPostNewUser(t *testing.T) {
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// the legacy token is stored hashed, and never served
+	stored, _ := Cache.Get("operator")
+	assert.True(t, stored.TokenHash.Matches("0x33"))
+	assert.NotContains(t, string(stored.TokenHash), "0x33")
+	assert.NotContains(t, w.Body.String(), "token_hmac")
 }
 
 func TestGetUsers(t *testing.T) {
@@ -82,7 +97,7 @@ func TestUpdateUserByKey(t *testing.T) {
 		ID:        "operator",
 		Name:      "operator",
 		FullName:  "Mrs. Operator",
-		TokenHash: "0x33",
+		EmailMain: "operator@example.com",
 		Active:    false,
 	}
 
@@ -97,7 +112,19 @@ func TestUpdateUserByKey(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), &item)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, item.User.TokenHash, "0x33")
+	assert.Empty(t, item.User.TokenHash)
+
+	// the legacy token is kept, it cannot be replaced
+	stored, _ := Cache.Get("operator")
+	assert.True(t, stored.TokenHash.Matches("0x33"))
+
+	user.TokenHash = "0x44"
+	jsonValue, _ = json.Marshal(user)
+	req, _ = http.NewRequest("PUT", "/users/operator", bytes.NewBuffer(jsonValue))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
 func TestDeleteUserByKey(t *testing.T) {
@@ -212,3 +239,343 @@ func TestGetUserSSHKeys(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, keys, string(w.Body.Bytes()))
 }
+
+func TestUserTokens(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	// the operator has been deactivated by the toggle test
+	req, _ := http.NewRequest("PUT", "/users/operator/active", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	offset := core.FeedOffset()
+
+	req, _ = http.NewRequest("POST", "/users/operator/tokens", bytes.NewBufferString(`{"name": "ci"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var created = struct {
+		Token string `json:"token"`
+		Item  Token  `json:"item"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEmpty(t, created.Token)
+	assert.Empty(t, created.Item.Hash)
+
+	// only the hash is stored
+	stored, _ := CacheTokens.Get(created.Item.ID)
+	assert.NotContains(t, stored.Hash, created.Token)
+	assert.NotContains(t, w.Body.String(), stored.Hash)
+
+	if user := FindUserByToken(created.Token); assert.NotNil(t, user) {
+		assert.Equal(t, "operator", user.Name)
+	}
+	assert.Nil(t, FindUserByToken(created.Item.ID+".wrong_secret"))
+
+	stored, _ = CacheTokens.Get(created.Item.ID)
+	assert.NotNil(t, stored.LastUsedAt)
+
+	req, _ = http.NewRequest("GET", "/users/operator/tokens", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var list = struct {
+		Items map[string]Token `json:"items"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &list)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ci", list.Items[created.Item.ID].Name)
+	assert.Empty(t, list.Items[created.Item.ID].Hash)
+
+	req, _ = http.NewRequest("DELETE", "/users/operator/tokens/"+created.Item.ID, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, FindUserByToken(created.Token))
+
+	// the legacy token is accepted until removed
+	legacy, _ := HashToken("0x33")
+	Cache.Update(context.Background(), "operator", func(user User) User {
+		user.TokenHash = legacy
+		return user
+	})
+
+	if user := FindUserByToken("0x33"); assert.NotNil(t, user) {
+		assert.Equal(t, "operator", user.Name)
+	}
+
+	// the tokens are put to the change feed without their hashes
+	events, err := core.FeedSince(offset, 1000)
+	assert.NoError(t, err)
+
+	var fed int
+	for _, ev := range events {
+		if ev.Cache != CacheTokens.CacheName() || ev.Key != created.Item.ID {
+			continue
+		}
+
+		ev, ok := core.ViewFeedEvent(&gin.Context{}, ev)
+		assert.True(t, ok)
+		assert.NotContains(t, string(ev.Value), `"hash"`)
+		assert.NotContains(t, string(ev.Value), `"salt"`)
+		fed++
+	}
+	assert.NotZero(t, fed)
+
+	// the users are looked up by the hash's prefix, not scanned
+	assert.Contains(t, Cache.Lookup("token_hmac", tokenLookup("0x33")), "operator")
+	assert.Equal(t, tokenLookup("0x33"), legacy.IndexKey())
+	assert.Empty(t, TokenHash("sha512$salt$hash").IndexKey())
+
+	req, _ = http.NewRequest("DELETE", "/users/operator/tokens/"+LegacyTokenID, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, FindUserByToken("0x33"))
+
+	// expired tokens are rejected too
+	past := time.Now().Add(-time.Hour)
+	tok, secret, err := NewToken("operator", "expired", &past)
+	assert.NoError(t, err)
+
+	CacheTokens.Set(tok.ID, tok)
+	assert.Nil(t, FindUserByToken(secret))
+
+	// the tokens issued by the peers are stored as replicated, with their hashes
+	tok, secret, err = NewToken("operator", "replicated", nil)
+	assert.NoError(t, err)
+
+	data, _ := json.Marshal(tok)
+
+	req, _ = http.NewRequest("PUT", "/users/operator/tokens/"+tok.ID, bytes.NewReader(data))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Nil(t, FindUserByToken(secret))
+
+	Cache.Set("replica", User{ID: "replica", Name: "replica", Active: true})
+
+	mirrored := gin.New()
+	mirrored.Use(func(ctx *gin.Context) {
+		ctx.Set(config.ContextMirrored, "peer")
+	})
+	mirrored.PUT("/users/:key/tokens/:id", PutReplicatedUserToken)
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/users/operator/tokens/other", http.StatusBadRequest},
+		{"/users/replica/tokens/" + tok.ID, http.StatusBadRequest},
+		{"/users/operator/tokens/" + tok.ID, http.StatusOK},
+	} {
+		req, _ = http.NewRequest("PUT", tc.path, bytes.NewReader(data))
+		w = httptest.NewRecorder()
+		mirrored.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, tc.path)
+	}
+
+	if user := FindUserByToken(secret); assert.NotNil(t, user) {
+		assert.Equal(t, "operator", user.Name)
+	}
+}
+
+func TestSecretPrivateKey(t *testing.T) {
+	r := core.SetupTestEnv(TestPackage)
+
+	assert.NoError(t, core.SetSecretKey("test-master-key"))
+	defer core.SetSecretKey("")
+
+	user := `{"id": "wg", "name": "wg", "email_main": "wg@example.com", "gdpr_consent": true, "wireguard_vpn": [{"device_name": "laptop", "private_key": "wg-private-key"}]}`
+
+	req, _ := http.NewRequest("POST", "/users", bytes.NewBufferString(user))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// the secret is redacted when served
+	req, _ = http.NewRequest("GET", "/users/wg", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "wg-private-key")
+	assert.NotContains(t, w.Body.String(), "enc:v1:")
+	assert.Contains(t, w.Body.String(), `"private_key": "`+core.RedactedSecret+`"`)
+
+	stored, _ := Cache.Get("wg")
+	assert.Equal(t, "wg-private-key", stored.Wireguard[0].PrivateKey.Reveal())
+
+	var got = struct {
+		Item json.RawMessage `json:"item"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+
+	// the current value is kept when the item is sent back
+	req, _ = http.NewRequest("PUT", "/users/wg", bytes.NewBuffer(got.Item))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a redacted secret cannot be stored as a new one
+	req, _ = http.NewRequest("POST", "/users", bytes.NewBufferString(strings.ReplaceAll(string(got.Item), `"wg"`, `"wg2"`)))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	secrets, err := core.RevealSecrets("users", "wg")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"wireguard_vpn.0.private_key": "wg-private-key"}, secrets)
+
+	// the sealed value is persisted, another key cannot open it
+	stored, _ = Cache.Get("wg")
+	sealed, _ := json.Marshal(stored)
+	assert.Contains(t, string(sealed), `"private_key":"enc:v1:`)
+
+	assert.NoError(t, core.SetSecretKey("another-key"))
+	assert.ErrorIs(t, json.Unmarshal(sealed, &User{}), core.ErrSecretKey)
+}
+
+// note is an item owned by a user in another package.
+type note struct {
+	Text  string `json:"text"`
+	Owner string `json:"owner"`
+}
+
+func TestUserGDPR(t *testing.T) {
+	core.SetupTestEnv(TestPackage)
+
+	notes := &core.Cache[note]{}
+	core.SetupTestEnv(&core.Package{
+		Name:   "notes",
+		Cache:  []core.CacheInterface{notes},
+		Routes: func(r *gin.RouterGroup) {},
+		Owners: map[core.CacheInterface]string{notes: "owner"},
+	})
+
+	offset := core.FeedOffset()
+
+	Cache.Set("carol", User{ID: "carol", Name: "carol", FullName: "Carol", EmailMain: "carol@example.com"})
+	Cache.Set("dave", User{ID: "dave", Name: "dave", FullName: "Dave", EmailMain: "dave@example.com", GDPRConsent: true})
+	notes.Set("n1", note{Text: "carol's", Owner: "carol"})
+	notes.Set("n2", note{Text: "dave's", Owner: "dave"})
+
+	tok, _, _ := NewToken("carol", "laptop", nil)
+	CacheTokens.Set(tok.ID, tok)
+
+	// router authenticated as such user
+	as := func(name string, roles ...string) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(func(ctx *gin.Context) {
+			ctx.Set(core.ContextUserName, name)
+			ctx.Set(core.ContextUserRoles, roles)
+		})
+		Routes(r.Group(pkgName))
+		return r
+	}
+
+	get := func(r *gin.Engine, path string) (int, User) {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var item = struct {
+			User User `json:"item"`
+		}{}
+		json.Unmarshal(w.Body.Bytes(), &item)
+		return w.Code, item.User
+	}
+
+	// personal details of non-consenting users are omitted for others
+	_, user := get(as("dave"), "/users/carol")
+	assert.Empty(t, user.FullName)
+	assert.Empty(t, user.EmailMain)
+
+	_, user = get(as("carol"), "/users/carol")
+	assert.Equal(t, "carol@example.com", user.EmailMain)
+
+	_, user = get(as("erin", "admin"), "/users/carol")
+	assert.Equal(t, "carol@example.com", user.EmailMain)
+
+	// any administrator role will do
+	roles.Cache.Set("ops", roles.Role{ID: "ops", Name: "ops", Admin: true, Active: true})
+	defer roles.Cache.Delete("ops")
+
+	_, user = get(as("frank", "ops"), "/users/carol")
+	assert.Equal(t, "carol@example.com", user.EmailMain)
+
+	_, user = get(as("carol"), "/users/dave")
+	assert.Equal(t, "dave@example.com", user.EmailMain)
+
+	// the listings cannot be filtered by the omitted fields
+	req, _ := http.NewRequest("GET", "/users?email_main=carol@example.com", nil)
+	w := httptest.NewRecorder()
+	as("dave").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"count": 0`)
+
+	// the export is limited to the user and admins
+	req, _ = http.NewRequest("GET", "/users/carol/gdpr/export", nil)
+	w = httptest.NewRecorder()
+	as("dave").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req, _ = http.NewRequest("GET", "/users/carol/gdpr/export", nil)
+	w = httptest.NewRecorder()
+	as("carol").ServeHTTP(w, req)
+
+	var export = struct {
+		Items map[string]map[string]json.RawMessage `json:"items"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &export)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, export.Items["users"], "carol")
+	assert.Contains(t, export.Items["users/tokens"], tok.ID)
+	assert.NotContains(t, string(export.Items["users/tokens"][tok.ID]), tok.Hash)
+	assert.Equal(t, []string{"n1"}, slices.Collect(maps.Keys(export.Items["notes"])))
+
+	// the erasure drops the user and the tokens, the owned items are anonymised
+	req, _ = http.NewRequest("DELETE", "/users/carol/gdpr", nil)
+	w = httptest.NewRecorder()
+	as("root").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	_, ok := Cache.Get("carol")
+	assert.False(t, ok)
+
+	_, ok = CacheTokens.Get(tok.ID)
+	assert.False(t, ok)
+
+	n1, _ := notes.Get("n1")
+	assert.Equal(t, ErasedOwner, n1.Owner)
+
+	n2, _ := notes.Get("n2")
+	assert.Equal(t, "dave", n2.Owner)
+
+	// the change feed holds the erased user's values no more
+	events, err := core.FeedSince(offset, 1000)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, events)
+
+	for _, ev := range events {
+		assert.NotContains(t, string(ev.Value), "carol@example.com")
+		assert.NotContains(t, string(ev.Value), `"carol"`)
+	}
+}
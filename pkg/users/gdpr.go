@@ -0,0 +1,203 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.vxn.dev/swis/v5/pkg/audit"
+	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/roles"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErasedOwner replaces the erased user's name in the owner fields of the other packages' items.
+const ErasedOwner = "[erased]"
+
+var errDeleteFailed = errors.New("cannot delete the item")
+
+func init() {
+	Cache.SetView(viewUser)
+}
+
+// viewUser hides the legacy token's hash from all, and the personal details as redactPersonal does.
+func viewUser(ctx *gin.Context, user User) User {
+	user.TokenHash = ""
+	return redactPersonal(ctx, user)
+}
+
+// redactPersonal omits the personal details of the users without the GDPR consent, unless they are requested by
+// themselves or by an admin.
+func redactPersonal(ctx *gin.Context, user User) User {
+	if user.GDPRConsent || privileged(ctx, user.Name) {
+		return user
+	}
+
+	user.FullName = ""
+	user.EmailMain = ""
+	user.EmailAlias = ""
+	user.Country = ""
+	user.GitHubUser = ""
+	user.DiscordUser = ""
+	user.SpotifyLink = ""
+
+	return user
+}
+
+// privileged reports whether the request is made by such user, by root or by an admin.
+func privileged(ctx *gin.Context, name string) bool {
+	requester, _ := ctx.Value(core.ContextUserName).(string)
+	if requester == "root" || (requester != "" && requester == name) {
+		return true
+	}
+
+	names, _ := ctx.Value(core.ContextUserRoles).([]string)
+	return roles.IsAdmin(names)
+}
+
+// findDataSubject returns the user of the key param, if the request may handle their data.
+func findDataSubject(ctx *gin.Context) (User, bool) {
+	key := ctx.Param("key")
+
+	user, ok := Cache.Get(key)
+	if !ok {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"key":     key,
+			"message": "user not found",
+			"package": pkgName,
+		})
+		return user, false
+	}
+
+	if !privileged(ctx, user.Name) {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{
+			"code":    http.StatusForbidden,
+			"key":     key,
+			"message": "personal data can be handled by the user or an admin only",
+			"package": pkgName,
+		})
+		return user, false
+	}
+
+	return user, true
+}
+
+// ExportUserData gathers all the user's data: the user, their tokens and the items they own in other packages.
+// @Summary Export user's personal data
+// @Description export the user's data across the packages (GDPR access)
+// @Tags users
+// @Produce json
+// @Param  key  path  string  true  "user key"
+// @Success 200 {object} users.User
+// @Router /users/{key}/gdpr/export [get]
+func ExportUserData(ctx *gin.Context) {
+	user, ok := findDataSubject(ctx)
+	if !ok {
+		return
+	}
+
+	key := ctx.Param("key")
+
+	tokens := CacheTokens.Lookup("user_name", user.Name)
+	for id, tok := range tokens {
+		tokens[id] = tok.Public()
+	}
+
+	items := core.OwnedItems(user.Name)
+	items[pkgName] = map[string]any{key: Cache.View(ctx, user)}
+
+	if len(tokens) > 0 {
+		owned := make(map[string]any, len(tokens))
+		for id, tok := range tokens {
+			owned[id] = tok
+		}
+		items[pkgName+"/tokens"] = owned
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"items":   items,
+		"key":     key,
+		"message": "ok, exporting user's data",
+		"package": pkgName,
+	})
+	return
+}
+
+// EraseUserData deletes the user with their tokens, the items they own in other packages are kept anonymised. The
+// persisted logs and the change feed are compacted and the audit records anonymised, so that they do not keep the
+// erased values. The WAL segments and checkpoints are not rewritten, they keep the erased values until they are
+// pruned after the WAL retention (noted in the response).
+// @Summary Erase user's personal data
+// @Description delete the user and anonymise their items across the packages (GDPR erasure)
+// @Tags users
+// @Produce json
+// @Param  key  path  string  true  "user key"
+// @Success 200 {object} users.User.Name
+// @Router /users/{key}/gdpr [delete]
+func EraseUserData(ctx *gin.Context) {
+	user, ok := findDataSubject(ctx)
+	if !ok {
+		return
+	}
+
+	key := ctx.Param("key")
+
+	counts, err := core.DisownItems(ctx, user.Name, ErasedOwner)
+	if err == nil {
+		for id := range CacheTokens.Lookup("user_name", user.Name) {
+			if !CacheTokens.DeleteContext(ctx, id) {
+				err = errDeleteFailed
+				break
+			}
+			counts[pkgName+"/tokens"]++
+		}
+	}
+
+	if err == nil && !Cache.DeleteContext(ctx, key) {
+		err = errDeleteFailed
+	}
+
+	// The stores, the change feed and the audit log would keep the erased values otherwise.
+	if err == nil {
+		err = core.CompactStores()
+	}
+
+	if err == nil {
+		core.CompactFeed()
+	}
+
+	if err == nil {
+		err = audit.EraseUser(ctx, user.Name, ErasedOwner)
+	}
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"count":   counts,
+			"error":   err.Error(),
+			"key":     key,
+			"message": "user's data couldn't be erased completely",
+			"package": pkgName,
+		})
+		return
+	}
+
+	response := gin.H{
+		"code":    http.StatusOK,
+		"count":   counts,
+		"key":     key,
+		"message": "user erased, owned items anonymised",
+		"package": pkgName,
+	}
+
+	if retention, ok := core.WALRetention(); ok {
+		response["notice"] = fmt.Sprintf("the WAL segments and checkpoints keep the erased values until they are "+
+			"pruned after the retention of %s, see GET /system/wal", retention)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, response)
+	return
+}
@@ -1,5 +1,11 @@
 package users
 
+import (
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+)
+
 // Low-level User struct with all user's details.
 type User struct {
 	// User ID as an unique identifier.
@@ -20,10 +26,11 @@ type User struct {
 
 	// Presence/Absence boolean. If false, one is not allowed to log-in (token is rejected),
 	// to interract with vxn-dev infra in general (by default).
-	Active bool `json:"active" default:false`
+	Active bool `json:"active" default:"false"`
 
-	// Unique token used for auth purposes, SHA512 preferred.
-	TokenHash string `json:"token_hmac"`
+	// Legacy token used for auth purposes (deprecated in favour of the named tokens). It is accepted on creation only
+	// and kept as a salted SHA-512 hash, which is never served.
+	TokenHash TokenHash `json:"token_hmac,omitempty" readonly:"true"`
 
 	// GitHub account/profile name (used for SSH public keys importing).
 	GitHubUser string `json:"github_username"`
@@ -54,20 +61,19 @@ type User struct {
 
 	// Important GDPR consent boolean -- if false, user's details should be omitted!
 	// SEE more -- https://gdpr.eu/checklist/
-	GDPRConsent bool `json:"gdpr_consent" default:false`
+	GDPRConsent bool `json:"gdpr_consent" default:"false"`
 }
 
 // Wireguard struct for the proper VPN connection purposes (prolly to be imported by vpn_gateway_server).
 type Wireguard struct {
-	// Unique device name (for such user).
-	DeviceName string `json:"device_name"`
+	// Unique device name (for such user), the redacted private key is kept by it on updates.
+	DeviceName string `json:"device_name" key:"true"`
 
 	// Wireguard public key.
 	PublicKey string `json:"public_key"`
 
-	// Wireguard private key.
-	// TODO: should be encrypted?
-	PrivateKey string `json:"private_key"`
+	// Wireguard private key, encrypted at rest.
+	PrivateKey core.Secret `json:"private_key"`
 
 	// User's private IP address.
 	IPAddress string `json:"ip_address"`
@@ -76,5 +82,36 @@ type Wireguard struct {
 	AllowedIPs []string `json:"allowed_ips"`
 
 	// Is the user given permission to dial a connection?
-	Permission bool `json:"permission" default:false`
+	Permission bool `json:"permission" default:"false"`
+}
+
+// Token is a named API token of a user. Only the salted hash of its secret is stored, the secret is shown once
+// on creation.
+type Token struct {
+	// Token ID, the public part of the token string (<id>.<secret>).
+	ID string `json:"id" readonly:"true"`
+
+	// User is the key of the token's owner.
+	User string `json:"user_name" readonly:"true"`
+
+	// Name describes the token's purpose (e.g. ci-pipeline).
+	Name string `json:"name" binding:"required" required:"true"`
+
+	// Salt is a random hex-encoded salt of the hash.
+	Salt string `json:"salt,omitempty"`
+
+	// Hash is the hex-encoded SHA-512 hash of the salt and the secret.
+	Hash string `json:"hash,omitempty"`
+
+	// CreatedAt is the creation datetime.
+	CreatedAt time.Time `json:"created_at"`
+
+	// ExpiresAt is the optional expiry datetime, the token never expires if unset.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// LastUsedAt is the datetime of the last authentication using the token (updated once a minute at most).
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	// RevokedAt is the revocation datetime, revoked tokens are kept for the record.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
 }
@@ -14,6 +14,8 @@ func Routes(g *gin.RouterGroup) {
 		GetUserByKey)
 	g.PUT("/:key",
 		UpdateUserByKey)
+	g.PATCH("/:key",
+		PatchUserByKey)
 	g.DELETE("/:key",
 		DeleteUserByKey)
 	g.POST("/restore",
@@ -27,4 +29,16 @@ func Routes(g *gin.RouterGroup) {
 		PostUsersSSHKeys)
 	g.GET("/:key/keys/ssh",
 		GetUsersSSHKeysRaw)
+	g.GET("/:key/tokens",
+		GetUserTokens)
+	g.POST("/:key/tokens",
+		PostNewUserToken)
+	g.PUT("/:key/tokens/:id",
+		PutReplicatedUserToken)
+	g.DELETE("/:key/tokens/:id",
+		RevokeUserTokenByID)
+	g.GET("/:key/gdpr/export",
+		ExportUserData)
+	g.DELETE("/:key/gdpr",
+		EraseUserData)
 }
@@ -0,0 +1,403 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/config"
+	"go.vxn.dev/swis/v5/pkg/core"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// lastUsedPeriod limits how often is the token's last usage written to the cache (and to the logs).
+	lastUsedPeriod = time.Minute
+
+	// tokenHashPrefix marks the hashed legacy tokens: sha512$<lookup>$<salt>$<hash>.
+	tokenHashPrefix = "sha512$"
+
+	// tokenLookupSize is the length of the lookup prefix of the legacy tokens' hashes. The prefix is short, so that it
+	// narrows the users to check without giving the token away.
+	tokenLookupSize = 4
+
+	// LegacyTokenID revokes the user's legacy token (token_hmac) in place of a named token's ID.
+	LegacyTokenID = "legacy"
+)
+
+func init() {
+	CacheTokens.SetView(ViewToken)
+}
+
+// ViewToken hides the token's hash from all, so that it is served neither by the change feed nor by the audit
+// records.
+func ViewToken(ctx *gin.Context, tok Token) Token {
+	return tok.Public()
+}
+
+// TokenHash is the user's legacy token kept as a salted SHA-512 hash. The plain tokens are hashed when decoded, so
+// that the ones submitted, and the ones persisted before, are never stored as they are.
+type TokenHash string
+
+// HashToken returns the salted hash of the legacy token.
+func HashToken(token string) (TokenHash, error) {
+	salt, err := randomString(16, hex.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+
+	return TokenHash(tokenHashPrefix + tokenLookup(token) + "$" + salt + "$" + hashSecret(salt, token)), nil
+}
+
+// tokenLookup returns the unsalted lookup prefix the legacy token's hash is indexed by.
+func tokenLookup(token string) string {
+	return hashSecret("", token)[:tokenLookupSize]
+}
+
+func (h *TokenHash) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	if value == "" || strings.HasPrefix(value, tokenHashPrefix) {
+		*h = TokenHash(value)
+		return nil
+	}
+
+	hashed, err := HashToken(value)
+	if err != nil {
+		return err
+	}
+
+	*h = hashed
+	return nil
+}
+
+// IndexKey returns the hash's lookup prefix, so that the users are indexed by it. The hashes without one (written
+// before the prefix was introduced) are not indexed.
+func (h TokenHash) IndexKey() string {
+	parts := h.parts()
+	if len(parts) != 3 {
+		return ""
+	}
+
+	return parts[0]
+}
+
+// Matches compares the token to the hash in constant time, the unhashed values never match.
+func (h TokenHash) Matches(token string) bool {
+	parts := h.parts()
+	if len(parts) < 2 || token == "" {
+		return false
+	}
+
+	salt, hash := parts[len(parts)-2], parts[len(parts)-1]
+
+	return subtle.ConstantTimeCompare([]byte(hashSecret(salt, token)), []byte(hash)) == 1
+}
+
+// parts splits the hash to its lookup prefix (if any), salt and hash.
+func (h TokenHash) parts() []string {
+	rest, ok := strings.CutPrefix(string(h), tokenHashPrefix)
+	if !ok {
+		return nil
+	}
+
+	return strings.Split(rest, "$")
+}
+
+// NewToken generates a new token for such user, it returns the token record and the token string (<id>.<secret>)
+// to be shown once.
+func NewToken(user, name string, expiresAt *time.Time) (Token, string, error) {
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	salt, err := randomString(16, hex.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	token := Token{
+		ID:        id,
+		User:      user,
+		Name:      name,
+		Salt:      salt,
+		Hash:      hashSecret(salt, secret),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	return token, id + "." + secret, nil
+}
+
+// Valid reports whether the token can be used for authentication at such time.
+func (t Token) Valid(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// Matches compares the secret to the token's hash in constant time.
+func (t Token) Matches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashSecret(t.Salt, secret)), []byte(t.Hash)) == 1
+}
+
+// Public returns the token without its hash, to be listed.
+func (t Token) Public() Token {
+	t.Salt, t.Hash = "", ""
+	return t
+}
+
+func hashSecret(salt, secret string) string {
+	sum := sha512.Sum512([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(size int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return encode(buf), nil
+}
+
+// FindUserByToken returns the active user owning such token string, or nil. Named tokens (<id>.<secret>) are
+// checked first, the legacy token_hmac field is still accepted. The legacy tokens are looked up by their hashes'
+// prefix, only the few users sharing it are checked.
+func FindUserByToken(token string) *User {
+	if user := findUserByNamedToken(token); user != nil {
+		return user
+	}
+
+	for _, user := range Cache.Lookup("token_hmac", tokenLookup(token)) {
+		if user.Active && user.TokenHash.Matches(token) {
+			return &user
+		}
+	}
+
+	return nil
+}
+
+func findUserByNamedToken(token string) *User {
+	tok, ok := MatchToken(CacheTokens, token)
+	if !ok {
+		return nil
+	}
+
+	user, ok := Cache.Get(tok.User)
+	if !ok || !user.Active {
+		return nil
+	}
+
+	return &user
+}
+
+// MatchToken finds the valid token of such token string (<id>.<secret>) in the cache, its last usage is recorded.
+func MatchToken(tokens *core.Cache[Token], token string) (Token, bool) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok {
+		return Token{}, false
+	}
+
+	now := time.Now()
+
+	tok, ok := tokens.Get(id)
+	if !ok || !tok.Valid(now) || !tok.Matches(secret) {
+		return Token{}, false
+	}
+
+	if tok.LastUsedAt == nil || now.Sub(*tok.LastUsedAt) >= lastUsedPeriod {
+		tokens.Update(context.Background(), id, func(tok Token) Token {
+			tok.LastUsedAt = &now
+			return tok
+		})
+	}
+
+	return tok, true
+}
+
+// PrintTokens lists the tokens of such owner without their hashes.
+func PrintTokens(ctx *gin.Context, tokens *core.Cache[Token], owner, pkgName string) {
+	items := tokens.Lookup("user_name", owner)
+	for id, tok := range items {
+		items[id] = tok.Public()
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"count":   len(items),
+		"items":   items,
+		"key":     owner,
+		"message": "ok, listing tokens",
+		"package": pkgName,
+	})
+}
+
+// IssueToken creates a new token of such owner by the request's name and optional expiry (expires_at). The token
+// string is printed only once.
+func IssueToken(ctx *gin.Context, tokens *core.Cache[Token], owner, pkgName string) {
+	var input struct {
+		Name      string     `json:"name" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   err.Error(),
+			"key":     owner,
+			"message": "cannot bind input JSON stream",
+			"package": pkgName,
+		})
+		return
+	}
+
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"key":     owner,
+			"message": "token expiry has to be in the future",
+			"package": pkgName,
+		})
+		return
+	}
+
+	tok, secret, err := NewToken(owner, input.Name, input.ExpiresAt)
+	if err == nil {
+		var loaded bool
+		if _, loaded, err = tokens.LoadOrStore(ctx, tok.ID, tok); loaded {
+			err = errors.New("token ID collision")
+		}
+	}
+
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"key":     owner,
+			"message": "token couldn't be saved to database",
+			"package": pkgName,
+		})
+		return
+	}
+
+	// The peers store the same token, they would generate their own otherwise.
+	if data, err := json.Marshal(tok); err == nil {
+		config.MirrorAs(ctx, http.MethodPut, strings.TrimSuffix(ctx.Request.URL.Path, "/")+"/"+tok.ID, data)
+	}
+
+	ctx.IndentedJSON(http.StatusCreated, gin.H{
+		"code":    http.StatusCreated,
+		"item":    tok.Public(),
+		"key":     owner,
+		"message": "new token created, store the secret now, it cannot be shown again",
+		"package": pkgName,
+		"token":   secret,
+	})
+}
+
+// StoreReplicatedToken stores the token of the id param issued by a peer instance (with its hash), see IssueToken.
+// The tokens are issued by the peers only, other requests are refused.
+func StoreReplicatedToken(ctx *gin.Context, tokens *core.Cache[Token], owner, pkgName string) {
+	if !config.IsMirrored(ctx) {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{
+			"code":    http.StatusForbidden,
+			"key":     owner,
+			"message": "tokens are issued by POST only",
+			"package": pkgName,
+		})
+		return
+	}
+
+	var tok Token
+	err := ctx.ShouldBindJSON(&tok)
+
+	// The token of another owner is not overwritten.
+	if current, ok := tokens.Get(tok.ID); ok && current.User != owner {
+		err = errors.New("token ID collision")
+	}
+
+	if err != nil || tok.ID != ctx.Param("id") || tok.User != owner || tok.Hash == "" {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"key":     owner,
+			"message": "invalid replicated token",
+			"package": pkgName,
+		})
+		return
+	}
+
+	if !tokens.SetContext(ctx, tok.ID, tok) {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"key":     owner,
+			"message": "token couldn't be saved to database",
+			"package": pkgName,
+		})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"item":    tok.Public(),
+		"key":     owner,
+		"message": "replicated token stored",
+		"package": pkgName,
+	})
+}
+
+// RevokeToken revokes the token of the id param, it has to be owned by such owner. Revoked tokens are kept for
+// the record.
+func RevokeToken(ctx *gin.Context, tokens *core.Cache[Token], owner, pkgName string) {
+	id := ctx.Param("id")
+
+	if tok, ok := tokens.Get(id); !ok || tok.User != owner {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"key":     owner,
+			"message": "token not found",
+			"package": pkgName,
+		})
+		return
+	}
+
+	tok, _, err := tokens.Update(ctx, id, func(tok Token) Token {
+		if tok.RevokedAt == nil {
+			now := time.Now()
+			tok.RevokedAt = &now
+		}
+		return tok
+	})
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"key":     owner,
+			"message": "token couldn't be saved to database",
+			"package": pkgName,
+		})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"item":    tok.Public(),
+		"key":     owner,
+		"message": "token revoked",
+		"package": pkgName,
+	})
+}
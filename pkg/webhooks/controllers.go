@@ -0,0 +1,250 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/roles"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Cache = &core.Cache[Webhook]{}
+
+	// Deliveries hold the latest delivery records only, they are neither persisted nor put to the change feed.
+	Deliveries = &core.Cache[Delivery]{Volatile: true}
+
+	caches = []core.CacheInterface{
+		Cache,
+		Deliveries,
+	}
+	indexes = map[core.CacheInterface][]string{
+		Deliveries: {"webhook_id"},
+	}
+	owners = map[core.CacheInterface]string{
+		Cache:      "user_name",
+		Deliveries: "user_name",
+	}
+	pkgName string = "webhooks"
+)
+
+var Package *core.Package = &core.Package{
+	Name:  pkgName,
+	Cache: caches,
+	CacheNames: []string{
+		"hooks",
+		"deliveries",
+	},
+	Routes: Routes,
+	Subpackages: []string{
+		"hooks",
+	},
+	Indexes: indexes,
+	Owners:  owners,
+}
+
+func init() {
+	Cache.SetGuard(guardWebhook)
+}
+
+// guardWebhook checks the webhook's owner and its target, see guardOwner and checkURL.
+func guardWebhook(ctx *gin.Context, hook Webhook) (Webhook, error) {
+	hook, err := guardOwner(ctx, hook)
+	if err != nil {
+		return hook, err
+	}
+
+	if err := checkURL(hook.URL); err != nil {
+		return hook, &core.ValidationError{Fields: []core.FieldError{{Field: "url", Message: err.Error()}}}
+	}
+
+	return hook, nil
+}
+
+// guardOwner registers the webhook as the requester's. The events are delivered as the owner may read them, so only
+// root and admins may register webhooks of other users.
+func guardOwner(ctx *gin.Context, hook Webhook) (Webhook, error) {
+	requester, _ := ctx.Value(core.ContextUserName).(string)
+	if requester == "" {
+		return hook, errors.New("the requester is not known")
+	}
+
+	if hook.UserName == "" || hook.UserName == requester {
+		hook.UserName = requester
+		return hook, nil
+	}
+
+	names, _ := ctx.Value(core.ContextUserRoles).([]string)
+	if requester == "root" || roles.IsAdmin(names) {
+		return hook, nil
+	}
+
+	return hook, fmt.Errorf("webhook cannot be registered as user '%s'", hook.UserName)
+}
+
+// GetWebhooks returns JSON serialized list of webhooks and their properties.
+// @Summary Get all webhooks
+// @Description get webhooks complete list
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} webhooks.Webhook
+// @Router /webhooks/hooks [get]
+func GetWebhooks(ctx *gin.Context) {
+	core.PrintAllRootItems(ctx, Cache, pkgName)
+	return
+}
+
+// GetWebhookByKey returns webhook's properties, given sent key exists in database.
+// @Summary Get webhook by key
+// @Description get webhook by its key param
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} webhooks.Webhook
+// @Router /webhooks/hooks/{key} [get]
+func GetWebhookByKey(ctx *gin.Context) {
+	core.PrintItemByParam[Webhook](ctx, Cache, pkgName, Webhook{})
+	return
+}
+
+// PostNewWebhook registers a new webhook.
+// @Summary Add new webhook
+// @Description add new webhook, its events are delivered to the URL signed with the secret
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Success 201 {object} webhooks.Webhook
+// @Router /webhooks/hooks [post]
+func PostNewWebhook(ctx *gin.Context) {
+	core.AddNewItem[Webhook](ctx, Cache, pkgName, Webhook{})
+	return
+}
+
+// @Summary Update webhook by key
+// @Description update webhook by key
+// @Tags webhooks
+// @Produce json
+// @Param request body webhooks.Webhook true "query params"
+// @Success 200 {object} webhooks.Webhook
+// @Router /webhooks/hooks/{key} [put]
+func UpdateWebhookByKey(ctx *gin.Context) {
+	core.UpdateItemByParam[Webhook](ctx, Cache, pkgName, Webhook{})
+	return
+}
+
+// @Summary Patch webhook by key
+// @Description patch webhook by key (JSON merge patch)
+// @Tags webhooks
+// @Produce json
+// @Param request body webhooks.Webhook true "merge patch of the item"
+// @Success 200 {object} webhooks.Webhook
+// @Router /webhooks/hooks/{key} [patch]
+func PatchWebhookByKey(ctx *gin.Context) {
+	core.PatchItemByParam[Webhook](ctx, Cache, pkgName, Webhook{})
+	return
+}
+
+// @Summary Delete webhook by key
+// @Description delete webhook by key
+// @Tags webhooks
+// @Produce json
+// @Success 200 {string} string "ok"
+// @Router /webhooks/hooks/{key} [delete]
+func DeleteWebhookByKey(ctx *gin.Context) {
+	core.DeleteItemByParam(ctx, Cache, pkgName)
+	return
+}
+
+// @Summary List package model's field types
+// @Description list package model's field types
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Router /webhooks/hooks/types [get]
+func ListTypesWebhooks(ctx *gin.Context) {
+	core.ParsePackageType(ctx, pkgName, Webhook{})
+	return
+}
+
+// PostTestDelivery queues a ping event to the webhook, so that its target can be tested.
+// @Summary Send test delivery
+// @Description queue a ping event to the webhook
+// @Tags webhooks
+// @Produce json
+// @Success 202 {object} webhooks.Delivery
+// @Router /webhooks/hooks/{key}/test [post]
+func PostTestDelivery(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	hook, ok := Cache.Get(key)
+	if !ok {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"key":     key,
+			"message": "webhook not found",
+			"package": pkgName,
+		})
+		return
+	}
+
+	if !core.CanAccess(ctx, Cache, hook) {
+		core.PrintOwnerScopeError(ctx, pkgName, key)
+		return
+	}
+
+	if !hook.Active {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{
+			"code":    http.StatusConflict,
+			"key":     key,
+			"message": "webhook is not active",
+			"package": pkgName,
+		})
+		return
+	}
+
+	id := enqueue(hook, core.FeedEvent{
+		Timestamp: time.Now(),
+		Package:   pkgName,
+		Cache:     Cache.CacheName(),
+		Key:       key,
+		Op:        opPing,
+	})
+
+	delivery, _ := Deliveries.Get(id)
+
+	ctx.IndentedJSON(http.StatusAccepted, gin.H{
+		"code":    http.StatusAccepted,
+		"item":    delivery,
+		"key":     id,
+		"message": "test delivery queued",
+		"package": pkgName,
+	})
+	return
+}
+
+// GetDeliveries returns the latest delivery records.
+// @Summary Get webhook deliveries
+// @Description get the latest delivery records, e.g. ?webhook_id=mybot&state=failed
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} webhooks.Delivery
+// @Router /webhooks/deliveries [get]
+func GetDeliveries(ctx *gin.Context) {
+	core.PrintAllRootItems(ctx, Deliveries, pkgName)
+	return
+}
+
+// GetDeliveryByKey returns the delivery record with its attempts.
+// @Summary Get webhook delivery by key
+// @Description get delivery record by its key param
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} webhooks.Delivery
+// @Router /webhooks/deliveries/{key} [get]
+func GetDeliveryByKey(ctx *gin.Context) {
+	core.PrintItemByParam[Delivery](ctx, Deliveries, pkgName, Delivery{})
+	return
+}
@@ -0,0 +1,314 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var TestPackage *core.Package = &core.Package{
+	Name:       pkgName,
+	Cache:      caches,
+	CacheNames: Package.CacheNames,
+	Routes:     Routes,
+	Indexes:    indexes,
+	Owners:     owners,
+}
+
+var setupOnce sync.Once
+
+// setupPackage mounts the package's caches once, as the deliveries started by a test read them meanwhile.
+func setupPackage() {
+	setupOnce.Do(func() {
+		core.SetupTestEnv(TestPackage)
+	})
+}
+
+// routerAs returns a router serving the package's routes as such user.
+func routerAs(name string, roles ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set(core.ContextUserName, name)
+		ctx.Set(core.ContextUserRoles, roles)
+	})
+	Routes(router.Group(pkgName))
+
+	return router
+}
+
+/*
+ *  unit/integration tests
+ */
+
+func TestWebhookDeliveries(t *testing.T) {
+	setupPackage()
+	r := routerAs("root")
+	retryBackoff = time.Millisecond
+
+	// the test target listens at the loopback
+	t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "127.0.0.0/8,::1/128")
+
+	Start(context.Background())
+
+	var (
+		mu       sync.Mutex
+		payloads []Payload
+		attempts int
+	)
+
+	// the target fails once first, the signatures are checked as a receiver would
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(req.Body)
+
+		if err := Verify("s3cret", req.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var payload Payload
+		json.Unmarshal(body, &payload)
+		payloads = append(payloads, payload)
+	}))
+	defer target.Close()
+
+	received := func(count int) func() bool {
+		return func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(payloads) == count
+		}
+	}
+
+	// the webhook is notified of its own creation
+	hook := Webhook{
+		ID:       "bot",
+		UserName: "root",
+		URL:      target.URL,
+		Caches:   []string{"webhooks/hooks"},
+		Active:   true,
+	}
+	hook.Secret, _ = core.NewSecret("s3cret")
+
+	jsonValue, _ := json.Marshal(hook)
+	req, _ := http.NewRequest("POST", "/webhooks/hooks", bytes.NewBuffer(jsonValue))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	assert.Eventually(t, received(1), 5*time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	payload := payloads[0]
+	mu.Unlock()
+
+	assert.Equal(t, "bot", payload.WebhookID)
+	assert.Equal(t, "bot", payload.Event.Key)
+	assert.Equal(t, "set", payload.Event.Op)
+
+	// the delivery is recorded once the target has responded
+	assert.Eventually(t, func() bool {
+		delivery, _ := Deliveries.Get(payload.ID)
+		return delivery.State == stateDelivered
+	}, 5*time.Second, 5*time.Millisecond)
+
+	delivery, ok := Deliveries.Get(payload.ID)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusOK, delivery.StatusCode)
+	assert.Equal(t, 2, len(delivery.Attempts))
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.Attempts[0].StatusCode)
+
+	// the webhooks of unknown users are delivered nothing
+	ghost := hook
+	ghost.ID = "ghost"
+	ghost.UserName = "nobody"
+
+	jsonValue, _ = json.Marshal(ghost)
+	req, _ = http.NewRequest("POST", "/webhooks/hooks", bytes.NewBuffer(jsonValue))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	assert.Eventually(t, received(2), 5*time.Second, 5*time.Millisecond)
+	assert.Empty(t, Deliveries.Lookup("webhook_id", "ghost"))
+
+	// test delivery
+	req, _ = http.NewRequest("POST", "/webhooks/hooks/bot/test", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	assert.Eventually(t, received(3), 5*time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, opPing, payloads[2].Event.Op)
+	mu.Unlock()
+
+	req, _ = http.NewRequest("GET", "/webhooks/deliveries?webhook_id=bot", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var ret = struct {
+		Items map[string]Delivery `json:"items"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &ret)
+	assert.Equal(t, 3, len(ret.Items))
+}
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	header := Sign("s3cret", time.Now().Unix(), body)
+
+	assert.Nil(t, Verify("s3cret", header, body, time.Minute))
+	assert.NotNil(t, Verify("other", header, body, time.Minute))
+	assert.NotNil(t, Verify("s3cret", header, []byte(`{"id":"2"}`), time.Minute))
+	assert.NotNil(t, Verify("s3cret", Sign("s3cret", time.Now().Add(-time.Hour).Unix(), body), body, time.Minute))
+}
+
+func TestWebhookOwner(t *testing.T) {
+	setupPackage()
+
+	post := func(r *gin.Engine, hook Webhook) (int, Webhook) {
+		jsonValue, _ := json.Marshal(hook)
+		req, _ := http.NewRequest("POST", "/webhooks/hooks", bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var ret = struct {
+			Item Webhook `json:"item"`
+		}{}
+		json.Unmarshal(w.Body.Bytes(), &ret)
+		return w.Code, ret.Item
+	}
+
+	hook := Webhook{
+		ID:       "spy",
+		UserName: "root",
+		URL:      "https://hooks.example.com/hook",
+	}
+	hook.Secret, _ = core.NewSecret("s3cret")
+
+	// non-admins cannot register webhooks of others
+	code, _ := post(routerAs("mallory"), hook)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	_, ok := Cache.Get("spy")
+	assert.False(t, ok)
+
+	// the requester owns the webhook by default
+	hook.UserName = ""
+	code, item := post(routerAs("mallory"), hook)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "mallory", item.UserName)
+
+	// nor can they hand their webhooks over
+	jsonValue, _ := json.Marshal(map[string]string{"user_name": "root"})
+	req, _ := http.NewRequest("PATCH", "/webhooks/hooks/spy", bytes.NewBuffer(jsonValue))
+	w := httptest.NewRecorder()
+	routerAs("mallory").ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	stored, _ := Cache.Get("spy")
+	assert.Equal(t, "mallory", stored.UserName)
+
+	// admins can
+	hook.ID = "ops"
+	hook.UserName = "mallory"
+	code, item = post(routerAs("erin", "admin"), hook)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "mallory", item.UserName)
+}
+
+func TestWebhookTarget(t *testing.T) {
+	setupPackage()
+	r := routerAs("root")
+
+	var hits int
+	var mu sync.Mutex
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+	}))
+	defer target.Close()
+
+	hook := Webhook{ID: "internal", UserName: "root", Active: true}
+	hook.Secret, _ = core.NewSecret("s3cret")
+
+	// the targets other than the public http(s) ones are refused on save
+	for _, url := range []string{
+		target.URL,
+		"ftp://example.com/hook",
+		"http://localhost:8050/users",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hook",
+		"http://[::1]/hook",
+	} {
+		hook.URL = url
+
+		jsonValue, _ := json.Marshal(hook)
+		req, _ := http.NewRequest("POST", "/webhooks/hooks", bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+
+	_, ok := Cache.Get("internal")
+	assert.False(t, ok)
+
+	// the allowed networks can be targeted
+	t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "127.0.0.0/8")
+	hook.URL = target.URL
+
+	jsonValue, _ := json.Marshal(hook)
+	req, _ := http.NewRequest("POST", "/webhooks/hooks", bytes.NewBuffer(jsonValue))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// the target is checked again before each delivery
+	t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "")
+
+	id := enqueue(hook, core.FeedEvent{Package: pkgName, Cache: "webhooks/hooks", Key: "internal", Op: opPing})
+
+	assert.Eventually(t, func() bool {
+		delivery, _ := Deliveries.Get(id)
+		return delivery.State == stateFailed
+	}, 5*time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, 0, hits)
+	mu.Unlock()
+
+	delivery, _ := Deliveries.Get(id)
+	assert.Contains(t, delivery.Attempts[0].Error, errTarget.Error())
+
+	// the drained lanes are dropped
+	assert.Eventually(t, func() bool {
+		disp.mu.Lock()
+		defer disp.mu.Unlock()
+		return len(disp.lanes) == 0
+	}, 5*time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,465 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/auth"
+	"go.vxn.dev/swis/v5/pkg/config"
+	"go.vxn.dev/swis/v5/pkg/core"
+	"go.vxn.dev/swis/v5/pkg/follower"
+)
+
+// SignatureHeader carries the delivery's signature: t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">
+// keyed by the webhook's secret.
+const SignatureHeader = "X-Swis-Signature"
+
+const (
+	stateQueued    = "queued"
+	stateDelivered = "delivered"
+	stateFailed    = "failed"
+
+	// opPing is the operation of the test events, see PostTestDelivery.
+	opPing = "ping"
+)
+
+var (
+	// retryBackoff is the delay before the first retry of a failed delivery, it doubles with each retry up to
+	// maxBackoff.
+	retryBackoff = time.Second
+	maxBackoff   = time.Minute
+
+	// retries is the count of delivery attempts after the first one, queueSize the limit of pending deliveries per
+	// webhook and deliveriesKept the count of the latest delivery records kept.
+	retries        = 8
+	queueSize      = 1000
+	deliveriesKept = 1000
+
+	// client dials the allowed addresses only, so that the host names resolved to the internal ones (and the
+	// redirects to them) are refused as well, see checkAddr.
+	client = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: 5 * time.Second,
+				Control: func(network, address string, _ syscall.RawConn) error {
+					host, _, err := net.SplitHostPort(address)
+					if err != nil {
+						return err
+					}
+
+					addr, err := netip.ParseAddr(host)
+					if err != nil {
+						return err
+					}
+
+					return checkAddr(addr)
+				},
+			}).DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+	}
+
+	errInactive = errors.New("webhook removed or deactivated")
+
+	errTarget = errors.New("target address not allowed")
+)
+
+// dispatcher queues the deliveries per webhook, so that the events are delivered to a webhook in order.
+type dispatcher struct {
+	mu    sync.Mutex
+	lanes map[string]*lane
+
+	// kept lists the delivery records by age, the oldest are dropped.
+	kept []string
+}
+
+// lane holds the webhook's pending deliveries, its worker runs while there are any. The drained lane is dropped,
+// so that the lanes of the removed webhooks are not left behind.
+type lane struct {
+	mu      sync.Mutex
+	queue   []*pending
+	running bool
+}
+
+// pending is a delivery waiting in the lane.
+type pending struct {
+	id   string
+	hook string
+	body []byte
+	name string
+}
+
+var (
+	disp      = &dispatcher{lanes: make(map[string]*lane)}
+	startOnce sync.Once
+)
+
+// Start delivers the changes of the items to the webhooks as they are made, it is configured by the webhooks section
+// (WEBHOOK_RETRIES and WEBHOOK_QUEUE_SIZE). The followers of another instance deliver nothing, the leader does.
+func Start(ctx context.Context) {
+	startOnce.Do(func() {
+		cfg := config.Current().Webhooks
+		retries, queueSize = cfg.Retries, cfg.QueueSize
+
+		// The offset is taken now, so that no change made after the start is missed.
+		go tail(ctx, core.FeedOffset())
+	})
+}
+
+// tail reads the change feed following the offset.
+func tail(ctx context.Context, after uint64) {
+	for {
+		events, err := core.FeedSince(after, 1000)
+		if err != nil {
+			log.Printf("webhooks: %s, skipping to the latest changes", err.Error())
+			after = core.FeedOffset()
+			continue
+		}
+
+		for _, ev := range events {
+			after = ev.Offset
+
+			if status, ok := follower.CurrentStatus(); ok && status.Following {
+				continue
+			}
+			dispatch(ev)
+		}
+
+		if len(events) == 0 && !core.WaitFeed(ctx, after) {
+			return
+		}
+	}
+}
+
+// dispatch queues the event to the active webhooks it matches.
+func dispatch(ev core.FeedEvent) {
+	hooks, _ := Cache.GetAll()
+
+	for _, hook := range hooks {
+		if !hook.Active || !hook.matches(ev) {
+			continue
+		}
+
+		if ev, ok := auth.FeedEventFor(hook.UserName, ev); ok {
+			enqueue(hook, ev)
+		}
+	}
+}
+
+func (w Webhook) matches(ev core.FeedEvent) bool {
+	return (len(w.Packages) == 0 || slices.Contains(w.Packages, ev.Package)) &&
+		(len(w.Caches) == 0 || slices.Contains(w.Caches, ev.Cache)) &&
+		(len(w.Keys) == 0 || slices.Contains(w.Keys, ev.Key)) &&
+		(len(w.Ops) == 0 || slices.Contains(w.Ops, ev.Op))
+}
+
+// enqueue records the delivery and queues it to the webhook's lane, it returns the delivery's ID.
+func enqueue(hook Webhook, ev core.FeedEvent) string {
+	now := time.Now()
+	id := fmt.Sprintf("%s-%d", hook.ID, now.UnixNano())
+
+	delivery := Delivery{
+		ID:        id,
+		WebhookID: hook.ID,
+		UserName:  hook.UserName,
+		Offset:    ev.Offset,
+		Cache:     ev.Cache,
+		Key:       ev.Key,
+		Op:        ev.Op,
+		State:     stateQueued,
+		Attempts:  []Attempt{},
+		CreatedAt: now,
+	}
+
+	body, err := json.Marshal(Payload{ID: id, WebhookID: hook.ID, Event: ev})
+	if err != nil {
+		delivery.State = stateFailed
+		delivery.Attempts = append(delivery.Attempts, Attempt{Timestamp: now, Error: err.Error()})
+	}
+
+	disp.keep(delivery)
+
+	if err == nil {
+		disp.push(&pending{id: id, hook: hook.ID, body: body, name: ev.Cache + "." + ev.Op})
+	}
+
+	return id
+}
+
+// keep stores the delivery record, the oldest records over deliveriesKept are dropped.
+func (d *dispatcher) keep(delivery Delivery) {
+	Deliveries.Set(delivery.ID, delivery)
+
+	d.mu.Lock()
+	d.kept = append(d.kept, delivery.ID)
+
+	var dropped []string
+	if len(d.kept) > deliveriesKept {
+		dropped = slices.Clone(d.kept[:len(d.kept)-deliveriesKept])
+		d.kept = slices.Delete(d.kept, 0, len(dropped))
+	}
+	d.mu.Unlock()
+
+	for _, id := range dropped {
+		Deliveries.Delete(id)
+	}
+}
+
+// push queues the delivery to the webhook's lane, the lane's worker is started if it is not running.
+func (d *dispatcher) push(p *pending) {
+	d.mu.Lock()
+	l, ok := d.lanes[p.hook]
+	if !ok {
+		l = &lane{}
+		d.lanes[p.hook] = l
+	}
+
+	l.mu.Lock()
+	full := len(l.queue) >= queueSize
+	if !full {
+		l.queue = append(l.queue, p)
+	}
+
+	if !full && !l.running {
+		l.running = true
+		go d.work(p.hook, l)
+	}
+	l.mu.Unlock()
+	d.mu.Unlock()
+
+	if full {
+		record(p.id, stateFailed, Attempt{Timestamp: time.Now(), Error: "delivery queue full"})
+	}
+}
+
+// work delivers the lane's deliveries one by one, so that their order is kept. The drained lane is dropped.
+func (d *dispatcher) work(hook string, l *lane) {
+	for {
+		l.mu.Lock()
+		if len(l.queue) > 0 {
+			p := l.queue[0]
+			l.mu.Unlock()
+
+			deliver(p)
+
+			l.mu.Lock()
+			l.queue[0] = nil
+			l.queue = l.queue[1:]
+			l.mu.Unlock()
+			continue
+		}
+		l.mu.Unlock()
+
+		// The dispatcher's lock is taken first, as push takes it, so that no delivery is queued meanwhile.
+		d.mu.Lock()
+		l.mu.Lock()
+
+		if len(l.queue) > 0 {
+			l.mu.Unlock()
+			d.mu.Unlock()
+			continue
+		}
+
+		l.running = false
+		if d.lanes[hook] == l {
+			delete(d.lanes, hook)
+		}
+
+		l.mu.Unlock()
+		d.mu.Unlock()
+		return
+	}
+}
+
+// deliver sends the delivery, the failures are retried with a backoff unless the target refuses it.
+func deliver(p *pending) {
+	backoff := retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		// The webhook is read again, so that the changes of its URL and secret apply to the retries.
+		hook, ok := Cache.Get(p.hook)
+		if !ok || !hook.Active {
+			record(p.id, stateFailed, Attempt{Timestamp: time.Now(), Error: errInactive.Error()})
+			return
+		}
+
+		result, retry := send(hook, p)
+		if result.Error == "" {
+			record(p.id, stateDelivered, result)
+			return
+		}
+
+		if !retry || attempt >= retries {
+			record(p.id, stateFailed, result)
+			log.Printf("webhooks: giving up delivery %s to %s: %s", p.id, hook.URL, result.Error)
+			return
+		}
+
+		record(p.id, stateQueued, result)
+
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// send makes a single delivery attempt, it reports whether a failure is worth a retry.
+func send(hook Webhook, p *pending) (Attempt, bool) {
+	now := time.Now()
+	result := Attempt{Timestamp: now}
+
+	// The URL is checked again, as the allowed networks may have changed since it was saved.
+	if err := checkURL(hook.URL); err != nil {
+		result.Error = err.Error()
+		return result, false
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(p.body))
+	if err != nil {
+		result.Error = err.Error()
+		return result, false
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "swis-api-webhooks")
+	req.Header.Set("X-Swis-Delivery", p.id)
+	req.Header.Set("X-Swis-Event", p.name)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret.Reveal(), now.Unix(), p.body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result, true
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	result.StatusCode = resp.StatusCode
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return result, false
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500:
+		result.Error = resp.Status
+		return result, true
+	}
+
+	result.Error = "refused: " + resp.Status
+	return result, false
+}
+
+// checkURL refuses the targets other than the http(s) ones, and the ones at the loopback, link-local and private
+// addresses unless their networks are allowed (WEBHOOK_ALLOWED_NETWORKS). The addresses of the host names are
+// checked as they are dialed.
+func checkURL(raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme '%s', use http or https", target.Scheme)
+	}
+
+	host := target.Hostname()
+	if host == "" {
+		return errors.New("target has no host")
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return checkAddr(addr)
+	}
+
+	if host = strings.ToLower(strings.TrimSuffix(host, ".")); host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return checkAddr(netip.IPv6Loopback())
+	}
+
+	return nil
+}
+
+// checkAddr refuses the loopback, link-local, private and unspecified addresses out of the allowed networks.
+func checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+
+	if !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() && !addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() && !addr.IsUnspecified() {
+		return nil
+	}
+
+	for _, network := range config.Current().Webhooks.AllowedNetworks {
+		if prefix, err := netip.ParsePrefix(network); err == nil && prefix.Contains(addr) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", errTarget, addr)
+}
+
+// record adds the attempt to the delivery and sets its state.
+func record(id, state string, attempt Attempt) {
+	Deliveries.Update(context.Background(), id, func(d Delivery) Delivery {
+		d.State = state
+		d.StatusCode = attempt.StatusCode
+		d.Attempts = append(slices.Clone(d.Attempts), attempt)
+
+		if state == stateDelivered {
+			d.DeliveredAt = &attempt.Timestamp
+		}
+		return d
+	})
+}
+
+// Sign returns the signature header value of the body sent at such time, see SignatureHeader.
+func Sign(secret string, timestamp int64, body []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header value of the received body, the signatures older than the tolerance are
+// refused, so that the deliveries cannot be replayed.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts int64
+
+	for _, part := range strings.Split(header, ",") {
+		if value, ok := strings.CutPrefix(part, "t="); ok {
+			ts, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+
+	if ts == 0 {
+		return errors.New("signature has no timestamp")
+	}
+
+	if age := time.Since(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return errors.New("signature timestamp out of tolerance")
+	}
+
+	if !hmac.Equal([]byte(Sign(secret, ts, body)), []byte(header)) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package webhooks
+
+import (
+	"time"
+
+	"go.vxn.dev/swis/v5/pkg/core"
+)
+
+// Webhook is a subscription of a target URL to the changes of the items.
+type Webhook struct {
+	// ID is the unique identifier of the webhook.
+	ID string `json:"id" binding:"required" required:"true" readonly:"true"`
+
+	// UserName is the owner of the webhook, only the changes the user may read are delivered. It defaults to the
+	// requester, only root and admins may register webhooks of other users.
+	UserName string `json:"user_name"`
+
+	// URL is the target the events are POSTed to.
+	URL string `json:"url" binding:"required,url" required:"true"`
+
+	// Secret is the key the deliveries are signed with (HMAC-SHA256), see the X-Swis-Signature header.
+	Secret core.Secret `json:"secret" required:"true"`
+
+	// Description of the webhook in human-readable format.
+	Description string `json:"description"`
+
+	// Packages, Caches, Keys and Ops filter the delivered events (e.g. infra, backups/backups, mybackup and
+	// delete), an empty list matches all.
+	Packages []string `json:"packages"`
+	Caches   []string `json:"caches"`
+	Keys     []string `json:"keys"`
+	Ops      []string `json:"ops"`
+
+	// Active webhooks are delivered the events.
+	Active bool `json:"active"`
+}
+
+// Delivery is a record of an event's delivery to a webhook.
+type Delivery struct {
+	// ID is the unique identifier of the delivery, sent in the X-Swis-Delivery header.
+	ID string `json:"id" readonly:"true"`
+
+	WebhookID string `json:"webhook_id"`
+	UserName  string `json:"user_name"`
+
+	// Offset, Cache, Key and Op identify the delivered event.
+	Offset uint64 `json:"offset"`
+	Cache  string `json:"cache"`
+	Key    string `json:"key"`
+	Op     string `json:"op"`
+
+	// State is one of queued, delivered or failed.
+	State string `json:"state"`
+
+	// StatusCode is the response code of the last attempt, zero if the target could not be reached.
+	StatusCode int `json:"status_code"`
+
+	// Attempts lists the delivery attempts, the oldest first.
+	Attempts []Attempt `json:"attempts"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Attempt is a single delivery attempt.
+type Attempt struct {
+	Timestamp  time.Time `json:"timestamp"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Payload is the body POSTed to the webhook's URL.
+type Payload struct {
+	// ID is the delivery's ID, the retried deliveries keep it.
+	ID        string         `json:"id"`
+	WebhookID string         `json:"webhook_id"`
+	Event     core.FeedEvent `json:"event"`
+}
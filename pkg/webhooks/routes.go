@@ -0,0 +1,29 @@
+package webhooks
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// webhooks CRUD -- functions in controllers.go
+func Routes(g *gin.RouterGroup) {
+	g.GET("/hooks",
+		GetWebhooks)
+	g.POST("/hooks",
+		PostNewWebhook)
+	g.GET("/hooks/types",
+		ListTypesWebhooks)
+	g.GET("/hooks/:key",
+		GetWebhookByKey)
+	g.PUT("/hooks/:key",
+		UpdateWebhookByKey)
+	g.PATCH("/hooks/:key",
+		PatchWebhookByKey)
+	g.DELETE("/hooks/:key",
+		DeleteWebhookByKey)
+	g.POST("/hooks/:key/test",
+		PostTestDelivery)
+	g.GET("/deliveries",
+		GetDeliveries)
+	g.GET("/deliveries/:key",
+		GetDeliveryByKey)
+}